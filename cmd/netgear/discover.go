@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"netgearcli/internal/errs"
+	"netgearcli/internal/nsdp"
+	"netgearcli/internal/probe"
+)
+
+// runDiscover scans a network for Netgear PoE switches, or asks them to
+// answer an NSDP broadcast, and prints config entries for the ones found.
+func runDiscover(args []string) error {
+	fs := flag.NewFlagSet("discover", flag.ExitOnError)
+	port := fs.Int("port", 80, "HTTP port to probe")
+	concurrency := fs.Int("concurrency", 64, "How many hosts to probe at once")
+	timeout := fs.Duration("timeout", 2*time.Second, "How long to wait for each host, or for NSDP replies")
+	useNSDP := fs.Bool("nsdp", false, "Also find switches by NSDP broadcast; the CIDR is then optional")
+	nsdpInterface := fs.String("nsdp-interface", "", "Network interface whose MAC address NSDP requests are sent with")
+	nsdpTarget := fs.String("nsdp-target", "", "Address NSDP requests are sent to (default 255.255.255.255:63322)")
+	output := fs.String("output", "text", "Output format: text, json or config")
+	fs.StringVar(output, "o", "text", "Output format (shorthand)")
+	fs.Parse(args)
+	if fs.NArg() > 1 || (fs.NArg() == 0 && !*useNSDP) {
+		return fmt.Errorf("%w: usage: discover [options] <CIDR>, e.g. 192.168.1.0/24, or discover --nsdp [<CIDR>]", errs.ErrUsage)
+	}
+	if *output != "text" && *output != "json" && *output != "config" {
+		return fmt.Errorf("%w: invalid --output %q: must be text, json or config", errs.ErrUsage, *output)
+	}
+	var prefix netip.Prefix
+	if fs.NArg() == 1 {
+		var err error
+		if prefix, err = parsePrefix(fs.Arg(0)); err != nil {
+			return fmt.Errorf("%w: %v", errs.ErrUsage, err)
+		}
+		if _, err := probe.Hosts(prefix); err != nil {
+			return fmt.Errorf("%w: %v", errs.ErrUsage, err)
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	// Switches already in the config file are reported but not suggested
+	configured := make(map[string]string)
+	for _, sw := range cfg.Switches {
+		configured[firstNonEmpty(sw.Address, sw.Name)] = sw.Name
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	type candidate struct {
+		Name       string            `json:"name"`
+		Address    string            `json:"address"`
+		Model      string            `json:"model,omitempty"`
+		Series     string            `json:"series,omitempty"`
+		MAC        string            `json:"mac,omitempty"`
+		Firmware   string            `json:"firmware,omitempty"`
+		Ports      []nsdp.PortStatus `json:"ports,omitempty"`
+		Configured string            `json:"configured_as,omitempty"`
+	}
+	candidates := []candidate{}
+	byAddress := make(map[string]int)
+
+	if *useNSDP {
+		debugMessage("Broadcasting an NSDP discovery request")
+		devices, err := nsdp.Discover(ctx, nsdp.Options{Target: *nsdpTarget, Interface: *nsdpInterface, Timeout: *timeout})
+		if err != nil {
+			return fmt.Errorf("NSDP discovery: %w", err)
+		}
+		logMessage("%d switch(es) answered the NSDP broadcast", len(devices))
+		for _, d := range devices {
+			// Plus switches without PoE answer NSDP too
+			series := probe.ModelSeries(d.Model)
+			if series == "" || d.IP == "" {
+				debugMessage("Skipping %s %s at %s: not a supported PoE switch", d.Model, d.MAC, dash(d.IP))
+				continue
+			}
+			byAddress[d.IP] = len(candidates)
+			candidates = append(candidates, candidate{
+				Address:  d.IP,
+				Model:    d.Model,
+				Series:   series,
+				MAC:      d.MAC,
+				Firmware: d.Firmware,
+				Ports:    d.Ports,
+			})
+		}
+	}
+
+	if prefix.IsValid() {
+		debugMessage("Probing %s on port %d", prefix, *port)
+		found, err := probe.Scan(ctx, prefix, probe.ScanOptions{Port: *port, Concurrency: *concurrency, Timeout: *timeout})
+		if err != nil {
+			return err
+		}
+		logMessage("Found %d switch(es) in %s", len(found), prefix)
+		for _, id := range found {
+			if _, ok := byAddress[id.Address]; ok {
+				continue
+			}
+			byAddress[id.Address] = len(candidates)
+			candidates = append(candidates, candidate{Address: id.Address, Model: id.Model, Series: id.Series})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return hostAddr(candidates[i].Address).Less(hostAddr(candidates[j].Address))
+	})
+	for i, c := range candidates {
+		candidates[i].Name = suggestName(probe.Identity{Address: c.Address, Series: c.Series, Model: c.Model})
+		candidates[i].Configured = configured[c.Address]
+	}
+
+	switch *output {
+	case "json":
+		return json.NewEncoder(os.Stdout).Encode(candidates)
+	case "config":
+		// Entries for the "switches" list of the config file
+		type entry struct {
+			Name    string `json:"name"`
+			Address string `json:"address"`
+			Model   string `json:"model,omitempty"`
+		}
+		entries := []entry{}
+		for _, c := range candidates {
+			if c.Configured == "" {
+				entries = append(entries, entry{c.Name, c.Address, c.Model})
+			}
+		}
+		data, err := json.MarshalIndent(map[string][]entry{"switches": entries}, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Printf("%s\n", data)
+		return err
+	}
+
+	if len(candidates) == 0 {
+		if prefix.IsValid() {
+			fmt.Printf("No Netgear switches found in %s\n", prefix)
+		} else {
+			fmt.Println("No Netgear switches answered the NSDP broadcast")
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if *useNSDP {
+		fmt.Fprintln(tw, "ADDRESS\tSERIES\tMODEL\tMAC\tFIRMWARE\tCONFIGURED AS\tSUGGESTED NAME")
+	} else {
+		fmt.Fprintln(tw, "ADDRESS\tSERIES\tMODEL\tCONFIGURED AS\tSUGGESTED NAME")
+	}
+	for _, c := range candidates {
+		if *useNSDP {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", c.Address, c.Series, dash(c.Model), dash(c.MAC), dash(c.Firmware), dash(c.Configured), c.Name)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", c.Address, c.Series, dash(c.Model), dash(c.Configured), c.Name)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Println("\nRun with --output config for entries to paste into the config file.")
+	return nil
+}
+
+// parsePrefix accepts a CIDR prefix or a single address.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if !strings.Contains(s, "/") {
+		a, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid network %q: want a CIDR such as 192.168.1.0/24", s)
+		}
+		return netip.PrefixFrom(a, a.BitLen()), nil
+	}
+	p, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid network %q: want a CIDR such as 192.168.1.0/24", s)
+	}
+	return p, nil
+}
+
+// hostAddr parses the host of an address with or without a port.
+func hostAddr(address string) netip.Addr {
+	if ap, err := netip.ParseAddrPort(address); err == nil {
+		return ap.Addr()
+	}
+	a, _ := netip.ParseAddr(strings.Trim(address, "[]"))
+	return a
+}
+
+// suggestName names a found switch after its model and address, e.g.
+// "gs316epp-192-168-1-16".
+func suggestName(id probe.Identity) string {
+	kind := strings.ToLower(firstNonEmpty(id.Model, id.Series))
+	host := strings.NewReplacer(".", "-", ":", "-", "[", "", "]", "").Replace(id.Address)
+	return kind + "-" + host
+}
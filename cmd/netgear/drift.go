@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"netgearcli/internal/config"
+	"netgearcli/internal/drift"
+	"netgearcli/internal/errs"
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/hooks"
+	"netgearcli/internal/monitor"
+	"netgearcli/internal/session"
+	"netgearcli/internal/snapshot"
+)
+
+// runDrift compares PoE settings with a baseline snapshot, once with
+// "check" or on an interval with "watch".
+func runDrift(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "check":
+			return runDriftCheck(args[1:])
+		case "watch":
+			return runDriftWatch(args[1:])
+		}
+	}
+	return fmt.Errorf("%w: usage: drift check|watch [options] [switch...]", errs.ErrUsage)
+}
+
+// runDriftCheck checks once and exits with the drift code when any setting
+// differs from the baseline, for cron jobs and CI.
+func runDriftCheck(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	dc := config.Drift{}
+	if cfg.Drift != nil {
+		dc = *cfg.Drift
+	}
+
+	fs := flag.NewFlagSet("drift check", flag.ExitOnError)
+	baseline := fs.String("baseline", dc.Baseline, "Snapshot file to compare against")
+	remediate := fs.Bool("remediate", dc.Remediate, "Put drifted admin states, priorities, modes, limits and detection types back to the baseline; labels are only reported")
+	timeout := fs.Duration("timeout", time.Minute, "How long to wait for each switch")
+	output := fs.String("output", "text", "Output format: text or json")
+	fs.StringVar(output, "o", "text", "Output format (shorthand)")
+	fs.Parse(args)
+	if *output != "text" && *output != "json" {
+		return fmt.Errorf("%w: invalid --output %q: must be text or json", errs.ErrUsage, *output)
+	}
+	dc.Baseline = *baseline
+	dc.Remediate = *remediate
+
+	ctx, stop := signalContext()
+	defer stop()
+	session.BindDefaultTransport(ctx, 0)
+
+	f, err := loadFleet(cfg, fleet.Options{LockTimeout: *timeout})
+	if err != nil {
+		return err
+	}
+	c, err := newDriftChecker(&dc, f, fs.Args())
+	if err != nil {
+		return err
+	}
+	c.Timeout = *timeout
+	results := c.Check(ctx)
+
+	if *output == "json" {
+		err = json.NewEncoder(os.Stdout).Encode(struct {
+			Baseline string         `json:"baseline"`
+			Results  []drift.Result `json:"results"`
+		}{dc.Baseline, results})
+	} else {
+		err = writeDrift(results, dc.Baseline, dc.Remediate)
+	}
+	if err != nil {
+		return err
+	}
+
+	drifted, failed := 0, 0
+	for _, r := range results {
+		drifted += len(r.Remaining())
+		if r.Error != "" {
+			failed++
+		}
+	}
+	switch {
+	case drifted > 0:
+		return fmt.Errorf("%w: %d setting(s)", errs.ErrDrift, drifted)
+	case failed > 0:
+		return fmt.Errorf("%w: %d of %d switch(es) could not be checked", errs.ErrPartial, failed, len(results))
+	}
+	return nil
+}
+
+// writeDrift prints each switch's drift, one setting per line. With
+// remediate, drift that --remediate does not fix is marked as such.
+func writeDrift(results []drift.Result, baseline string, remediate bool) error {
+	for _, r := range results {
+		switch {
+		case len(r.Drift) > 0:
+			fmt.Printf("%s: %d setting(s) drifted from %s\n", r.Switch, len(r.Drift), baseline)
+		case r.Error != "":
+			fmt.Printf("%s: check failed: %s\n", r.Switch, r.Error)
+			continue
+		default:
+			fmt.Printf("%s: no drift\n", r.Switch)
+		}
+		for _, d := range r.Drift {
+			where := fmt.Sprintf("port %d", d.Port)
+			if d.Name != "" {
+				where += " (" + d.Name + ")"
+			}
+			note := ""
+			switch {
+			case r.Fixed(d):
+				note = " (remediated)"
+			case remediate && !drift.Remediable(d):
+				note = " (reported only)"
+			}
+			fmt.Printf("  %s: %s%s\n", where, drift.Describe(d), note)
+		}
+		if r.Error != "" {
+			fmt.Printf("  %s\n", r.Error)
+		}
+	}
+	return nil
+}
+
+// runDriftWatch checks on an interval and alerts on drift until
+// interrupted. "netgear serve" also watches when a drift section is
+// configured.
+func runDriftWatch(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	dc := config.Drift{}
+	if cfg.Drift != nil {
+		dc = *cfg.Drift
+	}
+
+	fs := flag.NewFlagSet("drift watch", flag.ExitOnError)
+	baseline := fs.String("baseline", dc.Baseline, "Snapshot file to compare against")
+	remediate := fs.Bool("remediate", dc.Remediate, "Put drifted admin states, priorities, modes, limits and detection types back to the baseline; labels are only reported")
+	interval := fs.Duration("interval", durationOr(dc.Interval, 5*time.Minute), "How often to check each switch")
+	fs.Parse(args)
+	if *interval <= 0 {
+		return fmt.Errorf("%w: --interval must be positive", errs.ErrUsage)
+	}
+	dc.Baseline = *baseline
+	dc.Remediate = *remediate
+	dc.Interval = config.Duration(*interval)
+
+	ctx, stop := signalContext()
+	defer stop()
+	session.BindDefaultTransport(ctx, 0)
+
+	f, err := loadFleet(cfg, fleet.Options{LockTimeout: *interval})
+	if err != nil {
+		return err
+	}
+	c, err := newDriftChecker(&dc, f, fs.Args())
+	if err != nil {
+		return err
+	}
+	sinks, err := monitor.Sinks(dc.Alerts)
+	if err != nil {
+		return err
+	}
+	logMessage("Checking %d switches against %s every %s", len(c.Members), dc.Baseline, *interval)
+	c.Watch(ctx, *interval, sinks)
+	return nil
+}
+
+// newDriftChecker loads the baseline and picks the switches to check: those
+// named, or every configured switch in the baseline.
+func newDriftChecker(cfg *config.Drift, f *fleet.Fleet, names []string) (*drift.Checker, error) {
+	if cfg.Baseline == "" {
+		return nil, fmt.Errorf("%w: no baseline: pass --baseline or set drift.baseline in the config file", errs.ErrUsage)
+	}
+	baseline, err := snapshot.Load(cfg.Baseline)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []*fleet.Member
+	if len(names) > 0 {
+		if members, err = selectMembers(f, names); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, name := range baseline.Names() {
+			m, ok := f.Get(name)
+			if !ok {
+				logMessage("Switch %s is in the baseline but not the config file", name)
+				continue
+			}
+			members = append(members, m)
+		}
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("%w: none of the switches in %s are in the config file", errs.ErrUsage, cfg.Baseline)
+	}
+	return &drift.Checker{
+		Baseline:  baseline,
+		Members:   members,
+		Timeout:   durationOr(cfg.Interval, 5*time.Minute),
+		Remediate: cfg.Remediate,
+		Actor:     hooks.CurrentActor("drift"),
+		Logf:      logMessage,
+	}, nil
+}
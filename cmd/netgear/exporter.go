@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+
+	"netgearcli/internal/config"
+	"netgearcli/internal/errs"
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/metrics"
+	"netgearcli/internal/session"
+)
+
+// Defaults for the exporter section of the config file
+const (
+	defaultExporterListen   = ":9731"
+	defaultExporterInterval = 30 * time.Second
+)
+
+// runExporter polls PoE status from every configured switch and serves it
+// to Prometheus until interrupted.
+func runExporter(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	exp := cfg.Exporter
+	if exp == nil {
+		exp = &config.Exporter{}
+	}
+
+	fs := flag.NewFlagSet("exporter", flag.ExitOnError)
+	listen := fs.String("listen", firstNonEmpty(exp.Listen, defaultExporterListen), "Address serving /metrics")
+	interval := fs.Duration("interval", durationOr(exp.Interval, defaultExporterInterval), "How often to poll each switch")
+	timeout := fs.Duration("timeout", time.Duration(exp.Timeout), "Give up on one poll after this long (default the interval)")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		return fmt.Errorf("%w: exporter takes no arguments", errs.ErrUsage)
+	}
+	if *interval <= 0 {
+		return fmt.Errorf("%w: --interval must be positive", errs.ErrUsage)
+	}
+	if *timeout <= 0 {
+		*timeout = *interval
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	session.BindDefaultTransport(ctx, *timeout)
+
+	// A poll waits at most its own timeout for the lock
+	f, err := loadFleet(cfg, fleet.Options{LockTimeout: *timeout})
+	if err != nil {
+		return err
+	}
+
+	exporter := &metrics.Exporter{Fleet: f, Interval: *interval, Timeout: *timeout, Logf: logMessage}
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", exporter)
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `<html><body><h1>netgear exporter</h1><a href="/metrics">Metrics</a></body></html>`)
+	})
+	server := &http.Server{Addr: *listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	polling := make(chan struct{})
+	go func() {
+		exporter.Run(ctx)
+		close(polling)
+	}()
+	logMessage("Exporting %d switches every %s on http://%s/metrics", len(f.Names()), *interval, *listen)
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	// Stop taking requests before waiting for the poller, so nothing new
+	// starts while they drain
+	logMessage("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	err = server.Shutdown(shutdownCtx)
+	cancel()
+	<-polling
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
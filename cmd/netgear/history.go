@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"netgearcli/internal/config"
+	"netgearcli/internal/errs"
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/history"
+	"netgearcli/internal/poe"
+	"netgearcli/internal/session"
+)
+
+// defaultRecordInterval is how often the recorder samples when not configured
+const defaultRecordInterval = time.Minute
+
+// runRecord samples PoE draw from every configured switch into the history
+// store until interrupted. "netgear serve" also records when a recorder
+// section is configured.
+func runRecord(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	rc := config.Recorder{}
+	if cfg.Recorder != nil {
+		rc = *cfg.Recorder
+	}
+
+	fs := flag.NewFlagSet("record", flag.ExitOnError)
+	dir := fs.String("dir", firstNonEmpty(rc.Dir, history.DefaultDir()), "Directory for the monthly CSV files")
+	interval := fs.Duration("interval", durationOr(rc.Interval, defaultRecordInterval), "How often to sample each switch")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		return fmt.Errorf("%w: record takes no arguments", errs.ErrUsage)
+	}
+	if *interval <= 0 {
+		return fmt.Errorf("%w: --interval must be positive", errs.ErrUsage)
+	}
+	rc.Dir = *dir
+	rc.Interval = config.Duration(*interval)
+
+	ctx, stop := signalContext()
+	defer stop()
+	session.BindDefaultTransport(ctx, 0)
+
+	f, err := loadFleet(cfg, fleet.Options{LockTimeout: *interval})
+	if err != nil {
+		return err
+	}
+	r := newRecorder(&rc, f)
+	logMessage("Recording %d switches every %s to %s", len(f.Names()), r.Interval, r.Store.Dir)
+	r.Run(ctx)
+	return nil
+}
+
+// newRecorder builds the recorder for the recorder section of the config
+func newRecorder(cfg *config.Recorder, f *fleet.Fleet) *history.Recorder {
+	interval := durationOr(cfg.Interval, defaultRecordInterval)
+	return &history.Recorder{
+		Fleet:     f,
+		Store:     &history.Store{Dir: firstNonEmpty(cfg.Dir, history.DefaultDir())},
+		Interval:  interval,
+		Timeout:   durationOr(cfg.Timeout, interval),
+		Retention: time.Duration(cfg.Retention),
+		Logf:      logMessage,
+	}
+}
+
+// runHistory summarizes recorded samples per port over a time range.
+func runHistory(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	dirDefault := history.DefaultDir()
+	if cfg.Recorder != nil && cfg.Recorder.Dir != "" {
+		dirDefault = cfg.Recorder.Dir
+	}
+
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	dir := fs.String("dir", dirDefault, "Directory holding the recorded history")
+	fromFlag := fs.String("from", "", "Start of the range, e.g. 2025-03-01 or \"2025-03-01 08:00\" (default --last before --to)")
+	toFlag := fs.String("to", "", "End of the range (default now)")
+	last := fs.String("last", "24h", "Length of the range when --from is not given, e.g. 24h or 30d")
+	switchName := fs.String("switch", "", "Only this switch")
+	portsFlag := fs.String("ports", "", "Only these ports, e.g. 1-4,8")
+	maxGap := fs.Duration("max-gap", history.DefaultMaxGap, "Longest gap between samples counted as continuous draw")
+	output := fs.String("output", "text", "Output format: text, json or csv")
+	fs.StringVar(output, "o", "text", "Output format (shorthand)")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		return fmt.Errorf("%w: history takes no arguments", errs.ErrUsage)
+	}
+	if *output != "text" && *output != "json" && *output != "csv" {
+		return fmt.Errorf("%w: invalid --output %q: must be text, json or csv", errs.ErrUsage, *output)
+	}
+
+	from, to, err := timeRange(*fromFlag, *toFlag, *last)
+	if err != nil {
+		return err
+	}
+	var ports map[int]bool
+	if *portsFlag != "" {
+		list, err := poe.ParsePorts([]string{*portsFlag})
+		if err != nil {
+			return fmt.Errorf("%w: %v", errs.ErrUsage, err)
+		}
+		ports = make(map[int]bool, len(list))
+		for _, p := range list {
+			ports[p] = true
+		}
+	}
+
+	summary := &history.Summary{MaxGap: *maxGap}
+	store := &history.Store{Dir: *dir}
+	err = store.Scan(from, to, func(s history.Sample) error {
+		if (*switchName == "" || s.Switch == *switchName) && (ports == nil || ports[s.Port]) {
+			summary.Add(s)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	stats := summary.Ports()
+
+	switch *output {
+	case "json":
+		return json.NewEncoder(os.Stdout).Encode(struct {
+			From  time.Time           `json:"from"`
+			To    time.Time           `json:"to"`
+			Ports []history.PortStats `json:"ports"`
+		}{from, to, stats})
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"switch", "port", "name", "samples", "min_w", "avg_w", "max_w", "energy_kwh"})
+		for _, p := range stats {
+			w.Write([]string{p.Switch, strconv.Itoa(p.Port), p.Name, strconv.Itoa(p.Samples),
+				fmt.Sprintf("%.2f", p.Min), fmt.Sprintf("%.2f", p.Avg), fmt.Sprintf("%.2f", p.Max), fmt.Sprintf("%.4f", p.Energy)})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	fmt.Printf("Power from %s to %s\n\n", from.Format("2006-01-02 15:04"), to.Format("2006-01-02 15:04"))
+	if len(stats) == 0 {
+		fmt.Printf("No samples recorded in %s for this range\n", *dir)
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SWITCH\tPORT\tLABEL\tSAMPLES\tMIN W\tAVG W\tMAX W\tkWh")
+	var total float64
+	for _, p := range stats {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t%.2f\t%.2f\t%.2f\t%.3f\n", p.Switch, p.Port, p.Name, p.Samples, p.Min, p.Avg, p.Max, p.Energy)
+		total += p.Energy
+	}
+	fmt.Fprintf(tw, "TOTAL\t\t\t\t\t\t\t%.3f\n", total)
+	return tw.Flush()
+}
+
+// timeRange resolves --from, --to and --last into a half-open range
+func timeRange(fromFlag, toFlag, last string) (from, to time.Time, err error) {
+	to = time.Now()
+	if toFlag != "" {
+		if to, err = history.ParseTime(toFlag); err != nil {
+			return from, to, fmt.Errorf("%w: --to: %v", errs.ErrUsage, err)
+		}
+	}
+	if fromFlag != "" {
+		if from, err = history.ParseTime(fromFlag); err != nil {
+			return from, to, fmt.Errorf("%w: --from: %v", errs.ErrUsage, err)
+		}
+	} else {
+		span, err := history.ParseSpan(last)
+		if err != nil {
+			return from, to, fmt.Errorf("%w: --last: %v", errs.ErrUsage, err)
+		}
+		from = to.Add(-span)
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("%w: --from must be before --to", errs.ErrUsage)
+	}
+	return from, to, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"netgearcli/internal/errs"
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/inventory"
+	"netgearcli/internal/session"
+)
+
+// runInventory logs in to every configured switch, or to the switches
+// named, and lists what each one is.
+func runInventory(args []string) error {
+	fs := flag.NewFlagSet("inventory", flag.ExitOnError)
+	timeout := fs.Duration("timeout", time.Minute, "How long to wait for each switch")
+	output := fs.String("output", "text", "Output format: text or json")
+	fs.StringVar(output, "o", "text", "Output format (shorthand)")
+	fs.Parse(args)
+	if *output != "text" && *output != "json" {
+		return fmt.Errorf("%w: invalid --output %q: must be text or json", errs.ErrUsage, *output)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signalContext()
+	defer stop()
+	session.BindDefaultTransport(ctx, 0)
+
+	f, err := loadFleet(cfg, fleet.Options{LockTimeout: *timeout})
+	if err != nil {
+		return err
+	}
+	members, err := selectMembers(f, fs.Args())
+	if err != nil {
+		return err
+	}
+	c := &inventory.Collector{Members: members, Timeout: *timeout, Logf: logMessage}
+	entries := c.Collect(ctx)
+
+	if *output == "json" {
+		err = json.NewEncoder(os.Stdout).Encode(entries)
+	} else {
+		err = writeInventory(entries)
+	}
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, e := range entries {
+		if e.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d switch(es) could not be read", errs.ErrPartial, failed, len(entries))
+	}
+	return nil
+}
+
+// writeInventory prints one row per switch, then any errors.
+func writeInventory(entries []inventory.Entry) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tADDRESS\tMODEL\tSERIES\tFIRMWARE\tPORTS\tBUDGET\tTOKEN")
+	for _, e := range entries {
+		ports, budget := "-", "-"
+		if e.Ports > 0 {
+			ports = fmt.Sprint(e.Ports)
+		}
+		if e.Budget > 0 {
+			budget = fmt.Sprintf("%.0f W", e.Budget)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Name, e.Address, dash(e.Model), dash(e.Series),
+			dash(e.Firmware), ports, budget, e.Token)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	first := true
+	for _, e := range entries {
+		if e.Error == "" {
+			continue
+		}
+		if first {
+			fmt.Println()
+			first = false
+		}
+		fmt.Printf("%s: %s\n", e.Name, e.Error)
+	}
+	return nil
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
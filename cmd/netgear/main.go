@@ -0,0 +1,184 @@
+// netgear - fleet and daemon modes for the switches in the config file.
+//
+// Usage: netgear [--config file] [--debug|-d] [--log file] [--audit-log file] <command> [options]
+//
+// Unlike the single-switch examples, every netgear command works on the
+// switches listed in ~/.config/netgear/config.json and resolves their
+// passwords through the same credential providers as poe-management.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"netgearcli/internal/audit"
+	"netgearcli/internal/config"
+	"netgearcli/internal/errs"
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/hooks"
+)
+
+// Global options shared by every command
+var (
+	globalDebug      bool
+	globalConfigPath string
+	globalAuditPath  string
+	logger           *log.Logger
+)
+
+// command is one netgear subcommand. run receives the arguments after the
+// command name and returns an error whose class decides the exit status.
+type command struct {
+	summary string
+	run     func(args []string) error
+}
+
+var commands = map[string]command{
+	"serve":     {"Run the REST API daemon", runServe},
+	"exporter":  {"Serve PoE telemetry as Prometheus metrics", runExporter},
+	"mqtt":      {"Bridge PoE ports to MQTT and Home Assistant", runMQTT},
+	"schedule":  {"List or run scheduled PoE actions", runSchedule},
+	"watchdog":  {"Power cycle ports whose devices stop responding", runWatchdog},
+	"monitor":   {"Alert on unusual power draw and port status changes", runMonitor},
+	"top":       {"Show a live dashboard of PoE ports", runTop},
+	"record":    {"Record PoE power draw to local history", runRecord},
+	"history":   {"Summarize recorded power draw and energy per port", runHistory},
+	"report":    {"Report energy use and cost per team from the history", runReport},
+	"snapshot":  {"Save the PoE state of every port to a file", runSnapshot},
+	"diff":      {"Compare PoE state between snapshots or the live switches", runDiff},
+	"drift":     {"Check PoE settings against a baseline snapshot", runDrift},
+	"inventory": {"List the model, firmware, ports and budget of every switch", runInventory},
+	"discover":  {"Scan a network for Netgear PoE switches", runDiscover},
+}
+
+func main() {
+	var logFilePath string
+	flag.StringVar(&globalConfigPath, "config", "", "Config file path (default $NETGEAR_CONFIG or ~/.config/netgear/config.json)")
+	flag.BoolVar(&globalDebug, "debug", false, "Enable debug output")
+	flag.BoolVar(&globalDebug, "d", false, "Enable debug output (shorthand)")
+	flag.StringVar(&logFilePath, "log", "", "Log file path for activity logging (default stderr)")
+	flag.StringVar(&logFilePath, "l", "", "Log file path for activity logging (shorthand)")
+	flag.StringVar(&globalAuditPath, "audit-log", "", "Append a JSON audit record of every PoE change to this file (default audit.file in config)")
+	flag.Usage = printUsage
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		printUsage()
+		os.Exit(errs.ExitUsage)
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", args[0])
+		printUsage()
+		os.Exit(errs.ExitUsage)
+	}
+
+	logger = log.New(os.Stderr, "", log.LstdFlags)
+	if logFilePath != "" {
+		logFile, err := os.OpenFile(logFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Fatalf("Failed to open log file %s: %v", logFilePath, err)
+		}
+		defer logFile.Close()
+		logger = log.New(logFile, "", log.LstdFlags)
+	}
+
+	if err := cmd.run(args[1:]); err != nil {
+		log.Printf("%s: %v", args[0], err)
+		os.Exit(errs.ExitCode(err))
+	}
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [options] <command> [command options]\n\nCommands:\n", os.Args[0])
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s - %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(os.Stderr, `
+Options:
+  --config        - Config file path (default ~/.config/netgear/config.json)
+  --debug, -d     - Enable debug output
+  --log, -l       - Log file path for activity logging (default stderr)
+  --audit-log     - JSON lines audit log of PoE changes (default audit.file in config)
+
+Run "%s <command> -h" for a command's options.
+`, os.Args[0])
+}
+
+// logMessage writes to the activity log
+func logMessage(format string, args ...interface{}) {
+	logger.Printf(format, args...)
+}
+
+// debugMessage writes to the activity log with --debug
+func debugMessage(format string, args ...interface{}) {
+	if globalDebug {
+		logger.Printf(format, args...)
+	}
+}
+
+// loadConfig reads the config file named by --config
+func loadConfig() (*config.Config, error) {
+	return config.Load(globalConfigPath)
+}
+
+// loadFleet creates sessions for every configured switch, with the
+// configured hooks notified of every change and the audit log recording it
+func loadFleet(cfg *config.Config, opts fleet.Options) (*fleet.Fleet, error) {
+	opts.Debug = globalDebug
+	opts.Logf = debugMessage
+	d, err := hooks.New(cfg.Hooks)
+	if err != nil {
+		return nil, err
+	}
+	d.Logf = logMessage
+	// The audit log stays open until the process exits
+	auditLog, err := audit.Open(cfg.Audit, globalAuditPath)
+	if err != nil {
+		return nil, err
+	}
+	if auditLog != nil {
+		auditLog.Logf = logMessage
+		d.Recorders = append(d.Recorders, auditLog)
+	}
+	opts.Hooks = d
+	return fleet.New(cfg, opts)
+}
+
+// selectMembers returns the members named, or every member when names is
+// empty
+func selectMembers(f *fleet.Fleet, names []string) ([]*fleet.Member, error) {
+	if len(names) == 0 {
+		return f.Members(), nil
+	}
+	var members []*fleet.Member
+	for _, name := range names {
+		m, ok := f.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: switch %s is not in the config file", errs.ErrUsage, name)
+		}
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+// signalContext returns a context canceled by Ctrl-C or SIGTERM. A second
+// signal kills the process immediately.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+	return ctx, stop
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"netgearcli/internal/config"
+	"netgearcli/internal/errs"
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/monitor"
+	"netgearcli/internal/session"
+)
+
+// runMonitor polls PoE status and raises alerts on unusual power draw and
+// status changes until interrupted. "netgear serve" also runs the monitor
+// when a monitor section is configured.
+func runMonitor(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	mc := config.Monitor{}
+	if cfg.Monitor != nil {
+		mc = *cfg.Monitor
+	}
+
+	fs := flag.NewFlagSet("monitor", flag.ExitOnError)
+	interval := fs.Duration("interval", durationOr(mc.Interval, 30*time.Second), "How often to poll each switch")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		return fmt.Errorf("%w: monitor takes no arguments", errs.ErrUsage)
+	}
+	mc.Interval = config.Duration(*interval)
+
+	ctx, stop := signalContext()
+	defer stop()
+	session.BindDefaultTransport(ctx, 0)
+
+	f, err := loadFleet(cfg, fleet.Options{LockTimeout: *interval})
+	if err != nil {
+		return err
+	}
+	m, err := newMonitor(&mc, f)
+	if err != nil {
+		return err
+	}
+	logMessage("Monitoring %d switches every %s", len(f.Names()), *interval)
+	return m.Run(ctx)
+}
+
+// newMonitor builds the monitor for the monitor section of the config
+func newMonitor(cfg *config.Monitor, f *fleet.Fleet) (*monitor.Monitor, error) {
+	if err := monitor.Validate(cfg); err != nil {
+		return nil, err
+	}
+	sinks, err := monitor.Sinks(cfg.Alerts)
+	if err != nil {
+		return nil, err
+	}
+	return &monitor.Monitor{Fleet: f, Config: *cfg, Sinks: sinks, Logf: debugMessage}, nil
+}
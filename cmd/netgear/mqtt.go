@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"netgearcli/internal/bridge"
+	"netgearcli/internal/config"
+	"netgearcli/internal/errs"
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/mqtt"
+	"netgearcli/internal/session"
+)
+
+// runMQTT bridges every configured switch to an MQTT broker until
+// interrupted.
+func runMQTT(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	mc := cfg.MQTT
+	if mc == nil {
+		mc = &config.MQTT{}
+	}
+
+	fs := flag.NewFlagSet("mqtt", flag.ExitOnError)
+	broker := fs.String("broker", mc.Broker, "Broker URL, e.g. tcp://broker:1883 or tls://broker:8883")
+	username := fs.String("username", mc.Username, "Broker user name")
+	passwordFile := fs.String("password-file", mc.PasswordFile, "File holding the broker password")
+	prefix := fs.String("prefix", mc.TopicPrefix, "Topic prefix (default netgear)")
+	discovery := fs.String("discovery-prefix", mc.DiscoveryPrefix, `Home Assistant discovery prefix, or "-" to disable (default homeassistant)`)
+	interval := fs.Duration("interval", durationOr(mc.Interval, 30*time.Second), "How often to republish port state")
+	timeout := fs.Duration("timeout", 30*time.Second, "Give up on one poll or command after this long")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		return fmt.Errorf("%w: mqtt takes no arguments", errs.ErrUsage)
+	}
+	if *broker == "" {
+		return fmt.Errorf("%w: no broker; set mqtt.broker in the config file or pass --broker", errs.ErrUsage)
+	}
+
+	password := mc.Password
+	if *passwordFile != "" {
+		data, err := os.ReadFile(*passwordFile)
+		if err != nil {
+			return fmt.Errorf("failed to read MQTT password: %w", err)
+		}
+		password = strings.TrimSpace(string(data))
+	}
+	clientID := mc.ClientID
+	if clientID == "" {
+		host, _ := os.Hostname()
+		clientID = "netgear-" + host
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	session.BindDefaultTransport(ctx, *timeout)
+
+	f, err := loadFleet(cfg, fleet.Options{LockTimeout: *timeout})
+	if err != nil {
+		return err
+	}
+
+	b := &bridge.Bridge{
+		Fleet: f,
+		MQTT: mqtt.Options{
+			Broker:   *broker,
+			ClientID: clientID,
+			Username: *username,
+			Password: password,
+		},
+		Prefix:          *prefix,
+		DiscoveryPrefix: *discovery,
+		Interval:        *interval,
+		Timeout:         *timeout,
+		Logf:            logMessage,
+	}
+	logMessage("Bridging %d switches to %s", len(f.Names()), *broker)
+	err = b.Run(ctx)
+	logMessage("Shutting down")
+	return err
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"netgearcli/internal/config"
+	"netgearcli/internal/errs"
+	"netgearcli/internal/history"
+	"netgearcli/internal/report"
+)
+
+// runReport writes reports built from the recorded history. The only
+// report so far is "energy".
+func runReport(args []string) error {
+	if len(args) == 0 || args[0] != "energy" {
+		return fmt.Errorf("%w: usage: report energy [options]", errs.ErrUsage)
+	}
+	return runEnergyReport(args[1:])
+}
+
+// runEnergyReport charges the energy each port used over a period to its
+// team, for facilities' monthly chargeback.
+func runEnergyReport(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	rc := config.Report{}
+	if cfg.Report != nil {
+		rc = *cfg.Report
+	}
+	dirDefault := history.DefaultDir()
+	if cfg.Recorder != nil && cfg.Recorder.Dir != "" {
+		dirDefault = cfg.Recorder.Dir
+	}
+
+	fs := flag.NewFlagSet("report energy", flag.ExitOnError)
+	dir := fs.String("dir", dirDefault, "Directory holding the recorded history")
+	month := fs.String("month", "", "Report on one month, e.g. 2025-03 (default the previous month)")
+	fromFlag := fs.String("from", "", "Start of the period, e.g. 2025-03-01")
+	toFlag := fs.String("to", "", "End of the period (default now)")
+	price := fs.Float64("price", rc.PricePerKWh, "Price per kWh; 0 leaves costs out")
+	currency := fs.String("currency", rc.Currency, "Currency printed with costs, e.g. EUR")
+	groupBy := fs.String("group-by", report.ByTeam, "Group ports by team, label, switch or port")
+	maxGap := fs.Duration("max-gap", history.DefaultMaxGap, "Longest gap between samples counted as continuous draw")
+	output := fs.String("output", "markdown", "Output format: markdown or csv")
+	fs.StringVar(output, "o", "markdown", "Output format (shorthand)")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		return fmt.Errorf("%w: report energy takes no arguments", errs.ErrUsage)
+	}
+	switch *groupBy {
+	case report.ByTeam, report.ByLabel, report.BySwitch, report.ByPort:
+	default:
+		return fmt.Errorf("%w: invalid --group-by %q: must be team, label, switch or port", errs.ErrUsage, *groupBy)
+	}
+	if *output != "markdown" && *output != "csv" {
+		return fmt.Errorf("%w: invalid --output %q: must be markdown or csv", errs.ErrUsage, *output)
+	}
+	if *price < 0 {
+		return fmt.Errorf("%w: --price must not be negative", errs.ErrUsage)
+	}
+
+	from, to, err := reportPeriod(*month, *fromFlag, *toFlag)
+	if err != nil {
+		return err
+	}
+	teams, err := report.NewTeams(rc.Teams)
+	if err != nil {
+		return err
+	}
+
+	summary := &history.Summary{MaxGap: *maxGap}
+	store := &history.Store{Dir: *dir}
+	err = store.Scan(from, to, func(s history.Sample) error {
+		summary.Add(s)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	e := report.Build(summary.Ports(), report.Options{
+		From:        from,
+		To:          to,
+		PricePerKWh: *price,
+		Currency:    *currency,
+		GroupBy:     *groupBy,
+		Teams:       teams,
+	})
+	if len(e.Ports) == 0 {
+		logMessage("No samples recorded in %s between %s and %s", *dir, from.Format(time.DateTime), to.Format(time.DateTime))
+	}
+
+	if *output == "csv" {
+		return report.WriteCSV(os.Stdout, e)
+	}
+	return report.WriteMarkdown(os.Stdout, e)
+}
+
+// reportPeriod resolves --month, --from and --to. With none of them the
+// report covers the previous calendar month.
+func reportPeriod(month, fromFlag, toFlag string) (from, to time.Time, err error) {
+	switch {
+	case month != "":
+		if fromFlag != "" || toFlag != "" {
+			return from, to, fmt.Errorf("%w: --month cannot be combined with --from or --to", errs.ErrUsage)
+		}
+		from, err = time.ParseInLocation("2006-01", month, time.Local)
+		if err != nil {
+			return from, to, fmt.Errorf("%w: --month: expected YYYY-MM, got %q", errs.ErrUsage, month)
+		}
+		return from, from.AddDate(0, 1, 0), nil
+	case fromFlag != "":
+		return timeRange(fromFlag, toFlag, "")
+	case toFlag != "":
+		return from, to, fmt.Errorf("%w: --to needs --from", errs.ErrUsage)
+	}
+	now := time.Now()
+	to = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	return to.AddDate(0, -1, 0), to, nil
+}
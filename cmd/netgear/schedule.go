@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"netgearcli/internal/config"
+	"netgearcli/internal/errs"
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/schedule"
+	"netgearcli/internal/session"
+)
+
+// runSchedule lists the configured schedule or runs it in the foreground.
+// "netgear serve" also runs the schedule.
+func runSchedule(args []string) error {
+	fs := flag.NewFlagSet("schedule", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s schedule [list|run]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  list - Show each rule's last and next run (default)\n")
+		fmt.Fprintf(os.Stderr, "  run  - Execute rules as they fall due until interrupted\n")
+	}
+	fs.Parse(args)
+	action := "list"
+	if fs.NArg() > 0 {
+		action = fs.Arg(0)
+	}
+	if fs.NArg() > 1 || (action != "list" && action != "run") {
+		fs.Usage()
+		return fmt.Errorf("%w: unknown schedule command %q", errs.ErrUsage, action)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.Schedule == nil || len(cfg.Schedule.Rules) == 0 {
+		return fmt.Errorf("%w: no schedule rules in the config file", errs.ErrUsage)
+	}
+
+	if action == "list" {
+		return listSchedule(cfg)
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	session.BindDefaultTransport(ctx, 0)
+
+	f, err := loadFleet(cfg, fleet.Options{LockTimeout: time.Minute})
+	if err != nil {
+		return err
+	}
+	s, err := newScheduler(cfg.Schedule, f)
+	if err != nil {
+		return err
+	}
+	logMessage("Running %d schedule rules", len(s.Rules))
+	return s.Run(ctx)
+}
+
+// newScheduler builds the scheduler for the schedule section of the config
+func newScheduler(cfg *config.Schedule, f *fleet.Fleet) (*schedule.Scheduler, error) {
+	rules, err := schedule.Rules(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &schedule.Scheduler{
+		Fleet:      f,
+		Rules:      rules,
+		StateFile:  firstNonEmpty(cfg.StateFile, schedule.DefaultStateFile()),
+		CatchUp:    time.Duration(cfg.CatchUp),
+		SkipMissed: cfg.SkipMissed,
+		Logf:       logMessage,
+	}, nil
+}
+
+func listSchedule(cfg *config.Config) error {
+	rules, err := schedule.Rules(cfg.Schedule)
+	if err != nil {
+		return err
+	}
+	s := &schedule.Scheduler{Rules: rules, StateFile: firstNonEmpty(cfg.Schedule.StateFile, schedule.DefaultStateFile())}
+	if err := s.Load(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RULE\tSWITCH\tPORTS\tACTIONS\tLAST RUN\tNEXT RUN")
+	for _, rule := range rules {
+		for i, action := range rule.Actions {
+			name, sw, ports, last, next := "", "", "", "", ""
+			if i == 0 {
+				name, sw, ports = rule.Name, rule.Switch, rule.PortList()
+				if t := s.LastRun(rule.Name); !t.IsZero() {
+					last = t.In(rule.Location).Format("Mon 2006-01-02 15:04 MST")
+				} else {
+					last = "never"
+				}
+			}
+			if t := action.Next(now, rule.Location); !t.IsZero() {
+				next = t.Format("Mon 2006-01-02 15:04 MST")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", name, sw, ports, action, last, next)
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"netgearcli/internal/api"
+	"netgearcli/internal/config"
+	"netgearcli/internal/errs"
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/monitor"
+	"netgearcli/internal/session"
+)
+
+// Defaults for the serve section of the config file
+const (
+	defaultListen         = "127.0.0.1:8080"
+	defaultRequestTimeout = 30 * time.Second
+	defaultLockTimeout    = 10 * time.Second
+)
+
+// runServe holds a session for every configured switch and serves the
+// REST API until interrupted.
+func runServe(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	serve := cfg.Serve
+	if serve == nil {
+		serve = &config.Serve{}
+	}
+
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := fs.String("listen", firstNonEmpty(serve.Listen, defaultListen), "Address to listen on")
+	tokenFile := fs.String("token-file", serve.APITokenFile, "File holding the API bearer token")
+	requestTimeout := fs.Duration("request-timeout", durationOr(serve.RequestTimeout, defaultRequestTimeout), "Give up on an API request after this long")
+	lockTimeout := fs.Duration("lock-timeout", durationOr(serve.LockTimeout, defaultLockTimeout), "How long a request waits for another run against the same switch")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		return fmt.Errorf("%w: serve takes no arguments", errs.ErrUsage)
+	}
+
+	token := serve.APIToken
+	if *tokenFile != "" {
+		data, err := os.ReadFile(*tokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read API token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token == "" && !isLoopback(*listen) {
+		logMessage("Warning: serving on %s without an API token; anyone who can reach it can change PoE ports", *listen)
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	session.BindDefaultTransport(ctx, *requestTimeout)
+
+	f, err := loadFleet(cfg, fleet.Options{LockTimeout: *lockTimeout})
+	if err != nil {
+		return err
+	}
+
+	// Run the schedule, watchdog, monitor, recorder and drift check
+	// alongside the API when configured
+	var background sync.WaitGroup
+	if cfg.Schedule != nil && len(cfg.Schedule.Rules) > 0 {
+		s, err := newScheduler(cfg.Schedule, f)
+		if err != nil {
+			return err
+		}
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			if err := s.Run(ctx); err != nil {
+				logMessage("Schedule stopped: %v", err)
+			}
+		}()
+		logMessage("Running %d schedule rules", len(s.Rules))
+	}
+	if cfg.Watchdog != nil && len(cfg.Watchdog.Targets) > 0 {
+		w, err := newWatchdog(cfg.Watchdog, f)
+		if err != nil {
+			return err
+		}
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			if err := w.Run(ctx); err != nil {
+				logMessage("Watchdog stopped: %v", err)
+			}
+		}()
+		logMessage("Watching %d devices", len(w.Targets))
+	}
+	if cfg.Monitor != nil {
+		m, err := newMonitor(cfg.Monitor, f)
+		if err != nil {
+			return err
+		}
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			m.Run(ctx)
+		}()
+		logMessage("Monitoring power draw on %d switches", len(f.Names()))
+	}
+	if cfg.Recorder != nil {
+		r := newRecorder(cfg.Recorder, f)
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			r.Run(ctx)
+		}()
+		logMessage("Recording power draw every %s to %s", r.Interval, r.Store.Dir)
+	}
+	if cfg.Drift != nil {
+		c, err := newDriftChecker(cfg.Drift, f, nil)
+		if err != nil {
+			return err
+		}
+		sinks, err := monitor.Sinks(cfg.Drift.Alerts)
+		if err != nil {
+			return err
+		}
+		interval := durationOr(cfg.Drift.Interval, 5*time.Minute)
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			c.Watch(ctx, interval, sinks)
+		}()
+		logMessage("Checking for drift from %s every %s", cfg.Drift.Baseline, interval)
+	}
+
+	// Log in up front so the first API call does not pay for it. A switch
+	// that is down now may come back, so failures are only logged.
+	for _, m := range f.Members() {
+		loginCtx, cancel := context.WithTimeout(ctx, *requestTimeout)
+		err := m.Locked(loginCtx, m.Session.EnsureAuthenticated)
+		cancel()
+		if err != nil {
+			logMessage("Login to %s failed: %v", m.Config.Name, err)
+			continue
+		}
+		logMessage("Logged in to %s (%s)", m.Config.Name, m.Config.Address)
+	}
+
+	server := &http.Server{
+		Addr: *listen,
+		Handler: (&api.Server{
+			Fleet:          f,
+			Token:          token,
+			RequestTimeout: *requestTimeout,
+			Logf:           logMessage,
+		}).Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	logMessage("Serving %d switches on http://%s", len(f.Names()), *listen)
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	// Stop taking requests before waiting for background tasks, so nothing
+	// new starts while they drain
+	logMessage("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	err = server.Shutdown(shutdownCtx)
+	cancel()
+	background.Wait()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// durationOr returns d, or def when d is unset
+func durationOr(d config.Duration, def time.Duration) time.Duration {
+	if d > 0 {
+		return time.Duration(d)
+	}
+	return def
+}
+
+// isLoopback reports whether addr only listens on the local machine
+func isLoopback(addr string) bool {
+	host := addr
+	if i := strings.LastIndex(addr, ":"); i >= 0 {
+		host = addr[:i]
+	}
+	host = strings.Trim(host, "[]")
+	return host == "localhost" || strings.HasPrefix(host, "127.") || host == "::1"
+}
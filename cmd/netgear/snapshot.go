@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"netgearcli/internal/ansi"
+	"netgearcli/internal/errs"
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/session"
+	"netgearcli/internal/snapshot"
+)
+
+// runSnapshot writes the PoE state of the configured switches, or of the
+// switches named, as JSON for a later "netgear diff".
+func runSnapshot(args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	file := fs.String("file", "", "Write the snapshot to this file (default stdout)")
+	fs.StringVar(file, "f", "", "Write the snapshot to this file (shorthand)")
+	timeout := fs.Duration("timeout", time.Minute, "How long to wait for each switch")
+	fs.Parse(args)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signalContext()
+	defer stop()
+	session.BindDefaultTransport(ctx, 0)
+
+	f, err := loadFleet(cfg, fleet.Options{LockTimeout: *timeout})
+	if err != nil {
+		return err
+	}
+	members, err := selectMembers(f, fs.Args())
+	if err != nil {
+		return err
+	}
+
+	// A switch that cannot be read is saved with its error so the diff
+	// shows it
+	snap, takeErr := snapshot.Take(ctx, members, *timeout)
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if *file == "" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = os.WriteFile(*file, data, 0644)
+	}
+	if err != nil {
+		return err
+	}
+	if takeErr != nil {
+		return fmt.Errorf("%w: %v", errs.ErrPartial, takeErr)
+	}
+	if *file != "" {
+		logMessage("Saved %d switches to %s", len(snap.Switches), *file)
+	}
+	return nil
+}
+
+// runDiff compares two snapshots, or a snapshot with the live switches
+// when --live is given.
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	live := fs.Bool("live", false, "Compare the snapshot with the switches as they are now")
+	output := fs.String("output", "text", "Output format: text or json")
+	fs.StringVar(output, "o", "text", "Output format (shorthand)")
+	colorMode := fs.String("color", "auto", "Color the text output: auto, always or never")
+	timeout := fs.Duration("timeout", time.Minute, "How long to wait for each switch with --live")
+	fs.Parse(args)
+
+	want := 2
+	usage := "diff <snapshotA> <snapshotB>"
+	if *live {
+		want = 1
+		usage = "diff --live <snapshot>"
+	}
+	if fs.NArg() != want {
+		return fmt.Errorf("%w: usage: %s", errs.ErrUsage, usage)
+	}
+	if *output != "text" && *output != "json" {
+		return fmt.Errorf("%w: invalid --output %q: must be text or json", errs.ErrUsage, *output)
+	}
+	color, err := ansi.UseColor(*colorMode)
+	if err != nil {
+		return err
+	}
+
+	a, err := snapshot.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	aName, bName := fs.Arg(0), "live"
+	var b *snapshot.Snapshot
+	var notInConfig []string
+	var liveErr error
+	if *live {
+		if b, notInConfig, liveErr = liveSnapshot(a, *timeout); b == nil {
+			return liveErr
+		}
+	} else {
+		bName = fs.Arg(1)
+		if b, err = snapshot.Load(bName); err != nil {
+			return err
+		}
+	}
+
+	changes := snapshot.MarkNotCompared(snapshot.Diff(a, b), notInConfig...)
+	from, to := snapshot.Side{Source: aName, Time: a.Time}, snapshot.Side{Source: bName, Time: b.Time}
+	if *output == "json" {
+		err = json.NewEncoder(os.Stdout).Encode(struct {
+			From    snapshot.Side     `json:"from"`
+			To      snapshot.Side     `json:"to"`
+			Changes []snapshot.Change `json:"changes"`
+		}{from, to, append([]snapshot.Change{}, changes...)})
+	} else {
+		err = snapshot.WriteText(os.Stdout, changes, from, to, color)
+	}
+	if err != nil {
+		return err
+	}
+	if liveErr != nil {
+		return fmt.Errorf("%w: %v", errs.ErrPartial, liveErr)
+	}
+	return nil
+}
+
+// liveSnapshot reads the switches in s that are still in the config file
+// and returns the names of those that are not. It returns a nil snapshot
+// only when none can be compared.
+func liveSnapshot(s *snapshot.Snapshot, timeout time.Duration) (*snapshot.Snapshot, []string, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, stop := signalContext()
+	defer stop()
+	session.BindDefaultTransport(ctx, 0)
+
+	f, err := loadFleet(cfg, fleet.Options{LockTimeout: timeout})
+	if err != nil {
+		return nil, nil, err
+	}
+	var members []*fleet.Member
+	var missing []string
+	for _, name := range s.Names() {
+		m, ok := f.Get(name)
+		if !ok {
+			logMessage("Switch %s is in the snapshot but not the config file; not comparing it", name)
+			missing = append(missing, name)
+			continue
+		}
+		members = append(members, m)
+	}
+	if len(members) == 0 {
+		return nil, nil, fmt.Errorf("%w: none of the switches in the snapshot are in the config file", errs.ErrUsage)
+	}
+	live, err := snapshot.Take(ctx, members, timeout)
+	return live, missing, err
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"netgearcli/internal/errs"
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/hooks"
+	"netgearcli/internal/session"
+	"netgearcli/internal/top"
+)
+
+// runTop shows a live full-screen dashboard of the configured switches, or
+// of the switches named on the command line.
+func runTop(args []string) error {
+	fs := flag.NewFlagSet("top", flag.ExitOnError)
+	interval := fs.Duration("interval", 5*time.Second, "How often to refresh each switch")
+	fs.Parse(args)
+	if *interval <= 0 {
+		return fmt.Errorf("%w: --interval must be positive", errs.ErrUsage)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	// Log lines on stderr would scribble over the screen; hold them until
+	// the dashboard has restored the terminal
+	if logger.Writer() == os.Stderr {
+		held := &top.HeldLog{}
+		logger.SetOutput(held)
+		defer held.Flush(os.Stderr)
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	session.BindDefaultTransport(ctx, 0)
+
+	f, err := loadFleet(cfg, fleet.Options{LockTimeout: *interval})
+	if err != nil {
+		return err
+	}
+	members, err := selectMembers(f, fs.Args())
+	if err != nil {
+		return err
+	}
+	// --debug output still reaches the activity log through Logf, but not
+	// the library's own prints to stdout. Port changes capture what the
+	// library prints, and with debug off it is not echoed either, so
+	// nothing lands on the dashboard's screen.
+	for _, m := range members {
+		m.Session.Debug = false
+		m.Session.Opts.Verbose = false
+	}
+
+	d := &top.Dashboard{
+		Members:  members,
+		Interval: *interval,
+		Actor:    hooks.CurrentActor("top"),
+		Title:    "netgear top",
+	}
+	return d.Run(ctx)
+}
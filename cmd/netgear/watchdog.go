@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"netgearcli/internal/config"
+	"netgearcli/internal/errs"
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/session"
+	"netgearcli/internal/watchdog"
+)
+
+// runWatchdog checks the devices behind configured ports and power cycles
+// those that stop responding, until interrupted. "netgear serve" also runs
+// the watchdog.
+func runWatchdog(args []string) error {
+	fs := flag.NewFlagSet("watchdog", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Log the ports that would be cycled without cycling them")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		return fmt.Errorf("%w: watchdog takes no arguments", errs.ErrUsage)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.Watchdog == nil || len(cfg.Watchdog.Targets) == 0 {
+		return fmt.Errorf("%w: no watchdog targets in the config file", errs.ErrUsage)
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	session.BindDefaultTransport(ctx, 0)
+
+	f, err := loadFleet(cfg, fleet.Options{LockTimeout: time.Minute})
+	if err != nil {
+		return err
+	}
+	w, err := newWatchdog(cfg.Watchdog, f)
+	if err != nil {
+		return err
+	}
+	w.DryRun = *dryRun
+	logMessage("Watching %d devices", len(w.Targets))
+	return w.Run(ctx)
+}
+
+// newWatchdog builds the watchdog for the watchdog section of the config
+func newWatchdog(cfg *config.Watchdog, f *fleet.Fleet) (*watchdog.Watchdog, error) {
+	targets, err := watchdog.Targets(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &watchdog.Watchdog{Fleet: f, Targets: targets, Logf: logMessage}, nil
+}
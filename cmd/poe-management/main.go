@@ -8,46 +8,103 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"hash/adler32"
 	"io"
 	"log"
 	"os"
-	"strconv"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
 	go_netgear "github.com/gherlein/go-netgear"
+
+	"netgearcli/internal/audit"
+	"netgearcli/internal/config"
+	"netgearcli/internal/credentials"
+	"netgearcli/internal/errs"
+	"netgearcli/internal/hooks"
+	"netgearcli/internal/poe"
+	"netgearcli/internal/retry"
+	"netgearcli/internal/session"
 )
 
-// Global variables for authentication
+// Global variables for output and logging
 var (
-	globalPassword     string
-	globalSwitchAddr   string
-	globalDebug        bool
-	globalOpts         *go_netgear.GlobalOptions
-	loginAttempted     bool
-	logFile            *os.File
-	logger             *log.Logger
+	globalSwitchAddr string
+	globalDebug      bool
+	logFile          *os.File
+	logger           *log.Logger
+	globalOutput     string
+	globalCommand    string
+	globalVerify     bool
+	globalSwitchName string
+	globalSwitch     config.Switch
+	globalBudget     string
+	globalHooks      *hooks.Dispatcher
+	globalAudit      *audit.Logger
+	globalAuditReads bool
+	// globalStart and globalPorts describe the command for its audit
+	// record; audited is set once the record is written
+	globalStart time.Time
+	globalPorts []int
+	audited     bool
+	// globalUnlock releases the switch lock; pendingEvent is the change
+	// event delivered once it is released
+	globalUnlock func()
+	pendingEvent *hooks.Event
 )
 
 func main() {
 	// Parse command line flags
 	var password string
+	var passwordStdin bool
+	var configPath string
 	var logFilePath string
+	var auditLogPath string
+	var retries int
+	var retryDelay, retryMaxElapsed time.Duration
+	var timeout time.Duration
+	var lockTimeout time.Duration
 	flag.BoolVar(&globalDebug, "debug", false, "Enable debug output")
 	flag.BoolVar(&globalDebug, "d", false, "Enable debug output (shorthand)")
 	flag.StringVar(&password, "password", "", "Admin password for authentication")
 	flag.StringVar(&password, "p", "", "Admin password for authentication (shorthand)")
+	flag.BoolVar(&passwordStdin, "password-stdin", false, "Read the admin password from stdin")
+	flag.StringVar(&configPath, "config", "", "Config file path (default $NETGEAR_CONFIG or ~/.config/netgear/config.json)")
 	flag.StringVar(&logFilePath, "log", "", "Log file path for activity logging")
 	flag.StringVar(&logFilePath, "l", "", "Log file path for activity logging (shorthand)")
+	flag.StringVar(&auditLogPath, "audit-log", "", "Append a JSON audit record of the command to this file (default audit.file in config)")
+	flag.StringVar(&globalOutput, "output", "text", "Result and error format: text or json")
+	flag.StringVar(&globalOutput, "o", "text", "Result and error format: text or json (shorthand)")
+	flag.IntVar(&retries, "retries", 0, "Maximum attempts per switch operation (default 4, or retry.max_attempts in config)")
+	flag.DurationVar(&retryDelay, "retry-delay", 0, "Initial delay between attempts; doubles with jitter (default 200ms)")
+	flag.DurationVar(&retryMaxElapsed, "retry-max-elapsed", 0, "Stop retrying after this long (default 30s)")
+	flag.DurationVar(&timeout, "timeout", 0, "Give up on the whole command after this long, e.g. 30s (default none)")
+	flag.DurationVar(&timeout, "t", 0, "Give up on the whole command after this long (shorthand)")
+	flag.DurationVar(&lockTimeout, "lock-timeout", time.Minute, "How long to wait for another run against the same switch to finish")
+	flag.BoolVar(&globalVerify, "verify", false, "Re-read settings after enable/disable and check the change took effect")
+	flag.StringVar(&globalBudget, "budget-check", "warn", "Before enable, check the PoE budget: warn, refuse or off")
 	flag.Parse()
+	globalStart = time.Now()
+
+	if globalOutput != "text" && globalOutput != "json" {
+		fatal(errs.ErrUsage, "Invalid --output %q: must be text or json", globalOutput)
+	}
+	if globalBudget != "warn" && globalBudget != "refuse" && globalBudget != "off" {
+		fatal(errs.ErrUsage, "Invalid --budget-check %q: must be warn, refuse or off", globalBudget)
+	}
 
 	args := flag.Args()
 	if len(args) < 2 {
 		printUsage()
-		os.Exit(1)
+		os.Exit(errs.ExitUsage)
 	}
 
 	// Set up logging if log file specified
@@ -55,7 +112,7 @@ func main() {
 		var err error
 		logFile, err = os.OpenFile(logFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
-			log.Fatalf("Failed to open log file %s: %v", logFilePath, err)
+			fatal(err, "Failed to open log file %s: %v", logFilePath, err)
 		}
 		defer logFile.Close()
 
@@ -67,8 +124,46 @@ func main() {
 		logger.Printf("Command: %s", cmdLine)
 	}
 
-	globalSwitchAddr = args[0]
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		fatal(err, "%v", err)
+	}
+	sw := cfg.Lookup(args[0])
+	globalSwitchAddr = sw.Address
+	globalSwitchName = sw.Name
+	globalSwitch = sw
+	globalHooks, err = hooks.New(cfg.Hooks)
+	if err != nil {
+		fatal(err, "%v", err)
+	}
+	globalHooks.Logf = func(format string, args ...interface{}) {
+		log.Printf(format, args...)
+		logMessage(format, args...)
+	}
+	globalAudit, err = audit.Open(cfg.Audit, auditLogPath)
+	if err != nil {
+		fatal(err, "%v", err)
+	}
+	if globalAudit != nil {
+		globalAudit.Logf = func(format string, args ...interface{}) {
+			log.Printf(format, args...)
+			logMessage(format, args...)
+		}
+		globalAuditReads = cfg.Audit != nil && cfg.Audit.Reads
+		globalHooks.Recorders = append(globalHooks.Recorders, globalAudit)
+	}
 	command := args[1]
+	globalCommand = command
+	// Best effort, so a change that fails before its ports are checked is
+	// still audited with the ports asked for
+	globalPorts, _ = poe.ParsePorts(args[2:])
+
+	switch command {
+	case "status", "settings", "budget", "enable", "disable", "cycle":
+	default:
+		printUsage()
+		fatal(errs.ErrUsage, "Unknown command: %s", command)
+	}
 
 	if globalDebug {
 		fmt.Printf("Debug mode enabled\n")
@@ -76,41 +171,82 @@ func main() {
 	}
 	logMessage("Debug mode: %v, Switch: %s, Command: %s", globalDebug, globalSwitchAddr, command)
 
-	// Set up global options for all commands
-	globalOpts = &go_netgear.GlobalOptions{
-		Verbose:      globalDebug,
-		OutputFormat: go_netgear.JsonFormat,
+	// Ctrl-C or SIGTERM cancels in-flight requests; a second Ctrl-C kills
+	// the process immediately
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
+	session.BindDefaultTransport(ctx, 0)
 
-	// Priority: 1. CLI flag, 2. Environment variable
+	// Priority: 1. CLI flag, 2. Credential providers for this switch
 	if password == "" {
-		password = getPasswordFromEnv(globalSwitchAddr, globalDebug)
+		var stdin io.Reader
+		if passwordStdin {
+			stdin = os.Stdin
+		}
+		password, err = lookupPassword(cfg, sw, stdin)
+		if err != nil {
+			fatal(err, "Failed to look up password for %s: %v", sw.Name, err)
+		}
 	}
-	globalPassword = password
+
+	// Set up the session used by all commands
+	sess := session.New(globalSwitchAddr, password)
+	sess.Opts.Verbose = globalDebug
+	sess.Debug = globalDebug
+	sess.Logf = logMessage
+
+	// Retry policy: defaults, then config file, then flags
+	sess.Retry = retry.Default.WithConfig(cfg.Retry)
+	if retries > 0 {
+		sess.Retry.MaxAttempts = retries
+	}
+	if retryDelay > 0 {
+		sess.Retry.InitialDelay = retryDelay
+	}
+	if retryMaxElapsed > 0 {
+		sess.Retry.MaxElapsed = retryMaxElapsed
+	}
+
+	// Serialise with other runs against this switch so they cannot race on
+	// the cached token or the switch's single login session
+	unlock, err := sess.Lock(ctx, lockTimeout, func(holder int) {
+		fmt.Fprintf(os.Stderr, "Waiting for another run against %s (pid %d) to finish...\n", globalSwitchAddr, holder)
+		logMessage("Waiting for lock on %s held by pid %d", globalSwitchAddr, holder)
+	})
+	if err != nil {
+		fatal(err, "Failed to lock %s: %v", globalSwitchAddr, err)
+	}
+	globalUnlock = sync.OnceFunc(unlock)
+	defer flushHooks()
 
 	// Ensure we're logged in before executing commands
-	err := ensureAuthenticated()
+	err = sess.EnsureAuthenticated(ctx)
 	if err != nil {
-		log.Fatalf("Authentication failed: %v", err)
+		fatal(err, "Authentication failed: %v", err)
 	}
 
 	// Execute command
 	switch command {
 	case "status":
-		showStatus(globalOpts, globalSwitchAddr)
+		showStatus(ctx, sess)
 	case "settings":
-		showSettings(globalOpts, globalSwitchAddr)
+		showSettings(ctx, sess)
+	case "budget":
+		showBudget(ctx, sess)
 	case "enable":
-		enablePorts(globalOpts, globalSwitchAddr, args[2:])
+		setPorts(ctx, sess, args[2:], true)
 	case "disable":
-		disablePorts(globalOpts, globalSwitchAddr, args[2:])
+		setPorts(ctx, sess, args[2:], false)
 	case "cycle":
-		cyclePorts(globalOpts, globalSwitchAddr, args[2:])
-	default:
-		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
-		printUsage()
-		os.Exit(1)
+		cyclePorts(ctx, sess, args[2:])
 	}
+	auditCommand(nil, "", nil)
 }
 
 // logMessage logs a message to the log file if logging is enabled
@@ -120,199 +256,60 @@ func logMessage(format string, args ...interface{}) {
 	}
 }
 
-// ensureAuthenticated ensures we have a valid session, logging in if necessary
-func ensureAuthenticated() error {
-	logMessage("Ensuring authentication for %s", globalSwitchAddr)
-	// Check if cached token exists
-	if hasValidToken(globalSwitchAddr, globalDebug) {
-		// Validate the token with a keep-alive check
-		if validateToken() {
-			if globalDebug {
-				fmt.Printf("Using cached token\n")
-			}
-			logMessage("Using cached token for %s", globalSwitchAddr)
-			return nil
-		}
-
-		// Token is invalid, remove it
-		if globalDebug {
-			fmt.Printf("Cached token is invalid, will re-login\n")
-		}
-		logMessage("Cached token invalid, re-authenticating to %s", globalSwitchAddr)
-		removeToken(globalSwitchAddr)
-	}
-
-	// No valid token, need to login
-	return performLogin()
-}
-
-// performLogin executes the login command with retry logic
-func performLogin() error {
-	if globalPassword == "" {
-		logMessage("Login failed: no password available for %s", globalSwitchAddr)
-		return fmt.Errorf("no password available for authentication")
-	}
-
-	// Retry delays: 200ms, 500ms, 1000ms
-	retryDelays := []time.Duration{200 * time.Millisecond, 500 * time.Millisecond, 1000 * time.Millisecond}
-	maxAttempts := len(retryDelays) + 1 // Initial attempt + retries
-
-	var lastErr error
-	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		if globalDebug {
-			if attempt == 1 {
-				fmt.Printf("Logging in to %s...\n", globalSwitchAddr)
-			} else {
-				fmt.Printf("Retry attempt %d of %d for %s...\n", attempt-1, len(retryDelays), globalSwitchAddr)
-			}
-		}
-		if attempt == 1 {
-			logMessage("Logging in to %s", globalSwitchAddr)
-		} else {
-			logMessage("Retry attempt %d of %d for %s", attempt-1, len(retryDelays), globalSwitchAddr)
-		}
-
-		loginCmd := &go_netgear.LoginCommand{
-			Address:  globalSwitchAddr,
-			Password: globalPassword,
-		}
-
-		err := loginCmd.Run(globalOpts)
-		if err == nil {
-			loginAttempted = true
-			if globalDebug {
-				fmt.Printf("Login successful\n")
-			}
-			logMessage("Login successful to %s", globalSwitchAddr)
-			return nil
-		}
-
-		lastErr = err
-		if globalDebug {
-			fmt.Printf("Login attempt %d failed: %v\n", attempt, err)
-		}
-		logMessage("Login attempt %d failed for %s: %v", attempt, globalSwitchAddr, err)
-
-		// If we have more attempts remaining, wait before retrying
-		if attempt < maxAttempts {
-			delay := retryDelays[attempt-1]
-			if globalDebug {
-				fmt.Printf("Waiting %v before retry...\n", delay)
-			}
-			logMessage("Waiting %v before retry", delay)
-			time.Sleep(delay)
-		}
-	}
-
-	// All attempts failed
-	logMessage("Giving up after %d failed login attempts for %s: %v", maxAttempts, globalSwitchAddr, lastErr)
-	if globalDebug {
-		fmt.Printf("Giving up after %d failed login attempts\n", maxAttempts)
-	}
-	return fmt.Errorf("login failed after %d attempts: %w", maxAttempts, lastErr)
+// errorReport is the error object written to stderr with --output json
+type errorReport struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Class   string `json:"class"`
+		Message string `json:"message"`
+		Switch  string `json:"switch,omitempty"`
+		Command string `json:"command,omitempty"`
+		// Ports says which ports were and were not changed
+		Ports *session.PortResult `json:"ports,omitempty"`
+	} `json:"error"`
 }
 
-// validateToken checks if the current token is still valid by making a lightweight request
-func validateToken() bool {
-	if globalDebug {
-		fmt.Printf("Validating cached token...\n")
-	}
-
-	// Make a lightweight status request to check if token is valid
-	cmd := &go_netgear.PoeStatusCommand{
-		Address: globalSwitchAddr,
-	}
-
-	// Temporarily disable verbose AND redirect output to suppress JSON
-	savedVerbose := globalOpts.Verbose
-	savedFormat := globalOpts.OutputFormat
-	globalOpts.Verbose = false
-	globalOpts.OutputFormat = go_netgear.MarkdownFormat // Quieter than JSON
-
-	// Redirect stdout to discard output during validation
-	oldStdout := os.Stdout
-	r, w, _ := os.Pipe()
-	os.Stdout = w
-
-	// Consume pipe output in goroutine to prevent blocking
-	done := make(chan bool)
-	go func() {
-		io.Copy(io.Discard, r)
-		done <- true
-	}()
-
-	err := cmd.Run(globalOpts)
-	w.Close()
-	<-done
-	os.Stdout = oldStdout
-
-	globalOpts.Verbose = savedVerbose
-	globalOpts.OutputFormat = savedFormat
-
-	if err != nil {
-		// Check if error indicates login required
-		if strings.Contains(err.Error(), "no content") ||
-		   strings.Contains(err.Error(), "login") ||
-		   strings.Contains(err.Error(), "no session") {
-			if globalDebug {
-				fmt.Printf("Token validation failed: %v\n", err)
-			}
-			return false
-		}
-	}
-
-	if globalDebug {
-		fmt.Printf("Token is valid\n")
-	}
-	return true
+// fatal logs a message and exits with the status for err's error class.
+// With --output json the message is written to stderr as an errorReport.
+func fatal(err error, format string, args ...interface{}) {
+	fatalPorts(err, nil, format, args...)
 }
 
-// handleAuthError executes a function and retries with re-login if authentication fails
-func handleAuthError(retryFunc func() error) error {
-	// Execute the function
-	err := retryFunc()
-	if err == nil {
-		return nil
-	}
-
-	// Check if error indicates authentication issue
-	errStr := err.Error()
-	if strings.Contains(errStr, "no content") ||
-	   strings.Contains(errStr, "login") ||
-	   strings.Contains(errStr, "no session") {
-
-		if loginAttempted {
-			// Already tried to login once, don't retry infinitely
-			return fmt.Errorf("authentication failed even after re-login: %w", err)
-		}
-
-		if globalDebug {
-			fmt.Printf("Token expired or invalid, re-authenticating...\n")
-		}
-
-		// Remove invalid token
-		removeToken(globalSwitchAddr)
-
-		// Try to login again
-		loginErr := performLogin()
-		if loginErr != nil {
-			return fmt.Errorf("re-authentication failed: %w", loginErr)
-		}
-
-		// Retry the original operation
-		return retryFunc()
-	}
-
-	return err
+// fatalPorts is fatal for a multi-port change, including which ports were
+// and were not changed in the JSON error report
+func fatalPorts(err error, result *session.PortResult, format string, args ...interface{}) {
+	code := errs.ExitCode(err)
+	message := fmt.Sprintf(format, args...)
+	auditCommand(err, message, result)
+
+	if globalOutput == "json" {
+		var report errorReport
+		report.Error.Code = code
+		report.Error.Class = errs.Name(err)
+		report.Error.Message = message
+		report.Error.Switch = globalSwitchAddr
+		report.Error.Command = globalCommand
+		report.Error.Ports = result
+		json.NewEncoder(os.Stderr).Encode(report)
+	} else {
+		log.Print(message)
+	}
+	flushHooks()
+	os.Exit(code)
 }
 
-// removeToken deletes the cached token file
-func removeToken(address string) {
-	tokenPath := getTokenPath(os.TempDir(), address)
-	os.Remove(tokenPath)
-	if globalDebug {
-		fmt.Printf("Removed invalid token at %s\n", tokenPath)
-	}
+// reportSuccess prints the result of a port change, as JSON with --output json
+func reportSuccess(ports []int, message string) {
+	if globalOutput != "json" {
+		fmt.Printf("✓ %s %v\n", message, ports)
+		return
+	}
+	json.NewEncoder(os.Stdout).Encode(map[string]interface{}{
+		"switch":  globalSwitchAddr,
+		"command": globalCommand,
+		"ports":   ports,
+		"result":  "ok",
+	})
 }
 
 func printUsage() {
@@ -321,6 +318,7 @@ func printUsage() {
 Commands:
   status   - Show POE status for all ports
   settings - Show POE settings for all ports
+  budget   - Show the PoE budget: used, reserved and available power
   enable   - Enable POE on specified ports
   disable  - Disable POE on specified ports
   cycle    - Power cycle specified ports
@@ -328,7 +326,18 @@ Commands:
 Options:
   --debug, -d       - Enable debug output
   --password, -p    - Admin password for authentication
+  --password-stdin  - Read the admin password from stdin
+  --config          - Config file path (default ~/.config/netgear/config.json)
   --log, -l         - Log file path for activity logging
+  --audit-log       - JSON lines audit log of changes (default audit.file in config)
+  --output, -o      - Result and error format: text (default) or json
+  --verify          - Re-read settings after enable/disable to confirm the change
+  --budget-check    - Before enable, check the PoE budget: warn (default), refuse or off
+  --retries         - Maximum attempts per operation (default 4)
+  --retry-delay     - Initial delay between attempts, grows with jitter (default 200ms)
+  --retry-max-elapsed - Stop retrying after this long (default 30s)
+  --timeout, -t     - Give up on the whole command after this long, e.g. 30s
+  --lock-timeout    - Wait this long for other runs against the switch (default 1m)
 
 Examples:
   %s 192.168.1.10 status
@@ -337,31 +346,48 @@ Examples:
   %s 192.168.1.10 disable 1-8 14-16              - Disable ports 1-8 and 14-16
   %s -d 192.168.1.10 cycle 5
 
+  echo "$PW" | %s --password-stdin 192.168.1.10 status
+
 Authentication (in priority order):
   1. --password/-p flag                          - Passed on command line
-  2. NETGEAR_SWITCHES="host:password;..."        - Multi-switch configuration
-  3. NETGEAR_PASSWORD_<HOST>=password            - Host-specific password
-  4. Cached token from previous login            - Stored in /tmp/.config/ntgrrc/
-`, os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0])
+  2. --password-stdin                            - First line of stdin
+  3. password_command / pass_entry in config     - e.g. "pass show netgear/tswitch16"
+     vault section in config (or VAULT_ADDR)     - KV v2 secret, e.g. secret/netgear/{host}
+  4. password_file in config, or
+     NETGEAR_PASSWORD_FILE_<HOST> / NETGEAR_PASSWORD_FILE - Docker/Kubernetes secret file
+  5. NETGEAR_PASSWORD_<HOST>=password            - Host-specific password
+  6. NETGEAR_SWITCHES="host:password;..."        - Multi-switch configuration
+  7. ~/.netrc machine entry                      - "machine <host> password <pw>"
+  8. Cached token from previous login            - Stored in /tmp/.config/ntgrrc/
+
+  A switch's "credentials" list in the config file overrides steps 2-7.
+
+Exit codes:
+  0  success                       5  partial failure across ports/switches
+  1  other error                   6  --verify found ports in the wrong state
+  2  usage error                   7  unsupported switch model
+  3  authentication failure        8  switch busy (session limit or lock timeout)
+  4  switch unreachable/timed out  9  enable refused: over the PoE budget
+                                   130 interrupted (Ctrl-C/SIGTERM)
+
+Ctrl-C or --timeout cancels in-flight requests and reports which ports were
+changed, which were not, and which were in flight when interrupted.
+`, os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0])
 }
 
-func showStatus(globalOpts *go_netgear.GlobalOptions, switchAddress string) {
+func showStatus(ctx context.Context, sess *session.Session) {
 	if globalDebug {
 		fmt.Printf("Executing status command...\n")
 	}
-	logMessage("Executing status command on %s", switchAddress)
+	logMessage("Executing status command on %s", sess.Address)
 
-	err := handleAuthError(func() error {
-		if globalDebug {
-			fmt.Printf("Creating PoeStatusCommand...\n")
-		}
-		cmd := &go_netgear.PoeStatusCommand{
-			Address: switchAddress,
-		}
+	err := sess.Do(ctx, "Status", func(ctx context.Context) error {
 		if globalDebug {
 			fmt.Printf("Running PoeStatusCommand...\n")
 		}
-		err := cmd.Run(globalOpts)
+		err := sess.Run(ctx, &go_netgear.PoeStatusCommand{
+			Address: sess.Address,
+		})
 		if globalDebug {
 			fmt.Printf("PoeStatusCommand completed with err=%v\n", err)
 		}
@@ -369,254 +395,317 @@ func showStatus(globalOpts *go_netgear.GlobalOptions, switchAddress string) {
 	})
 
 	if err != nil {
-		logMessage("Failed to get POE status from %s: %v", switchAddress, err)
-		log.Fatalf("Failed to get POE status: %v", err)
+		logMessage("Failed to get POE status from %s: %v", sess.Address, err)
+		fatal(err, "Failed to get POE status: %v", err)
 	}
-	logMessage("Successfully retrieved POE status from %s", switchAddress)
+	logMessage("Successfully retrieved POE status from %s", sess.Address)
 }
 
-func showSettings(globalOpts *go_netgear.GlobalOptions, switchAddress string) {
-	logMessage("Executing settings command on %s", switchAddress)
-	err := handleAuthError(func() error {
-		cmd := &go_netgear.PoeShowSettingsCommand{
-			Address: switchAddress,
-		}
-		return cmd.Run(globalOpts)
+func showSettings(ctx context.Context, sess *session.Session) {
+	logMessage("Executing settings command on %s", sess.Address)
+	err := sess.Do(ctx, "Settings", func(ctx context.Context) error {
+		return sess.Run(ctx, &go_netgear.PoeShowSettingsCommand{
+			Address: sess.Address,
+		})
 	})
 
 	if err != nil {
-		logMessage("Failed to get POE settings from %s: %v", switchAddress, err)
-		log.Fatalf("Failed to get POE settings: %v", err)
+		logMessage("Failed to get POE settings from %s: %v", sess.Address, err)
+		fatal(err, "Failed to get POE settings: %v", err)
 	}
-	logMessage("Successfully retrieved POE settings from %s", switchAddress)
+	logMessage("Successfully retrieved POE settings from %s", sess.Address)
 }
 
-func enablePorts(globalOpts *go_netgear.GlobalOptions, switchAddress string, portArgs []string) {
-	ports := parsePorts(portArgs)
-	if len(ports) == 0 {
-		logMessage("Enable ports failed: no port numbers specified")
-		log.Fatal("No port numbers specified")
+func showBudget(ctx context.Context, sess *session.Session) {
+	logMessage("Executing budget command on %s", sess.Address)
+	b, known, err := readBudget(ctx, sess)
+	if err != nil {
+		logMessage("Failed to read POE budget from %s: %v", sess.Address, err)
+		fatal(err, "Failed to read POE budget: %v", err)
 	}
 
-	logMessage("Enabling POE on %s ports %v", switchAddress, ports)
-	err := handleAuthError(func() error {
-		cmd := &go_netgear.PoeSetConfigCommand{
-			Address: switchAddress,
-			Ports:   ports,
-			PortPwr: "enable",
+	if globalOutput == "json" {
+		json.NewEncoder(os.Stdout).Encode(b)
+		return
+	}
+
+	model := b.Model
+	if model == "" {
+		model = "unknown model"
+	}
+	fmt.Printf("Switch:    %s (%s)\n", globalSwitchName, model)
+	if known {
+		fmt.Printf("Budget:    %7.1f W\n", b.Total)
+	} else {
+		fmt.Printf("Budget:    unknown; set model or poe_budget_w for %s in the config file\n", globalSwitchName)
+	}
+	fmt.Printf("Used:      %7.1f W\n", b.Used)
+	fmt.Printf("Reserved:  %7.1f W\n", b.Reserved)
+	if known {
+		fmt.Printf("Available: %7.1f W\n", b.Available)
+	}
+	fmt.Println()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PORT\tLABEL\tADMIN\tSTATUS\tCLASS\tDRAW W\tALLOCATED W")
+	for _, p := range b.Ports {
+		admin := "disabled"
+		if p.Enabled {
+			admin = "enabled"
 		}
-		return cmd.Run(globalOpts)
-	})
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%.1f\t%.1f\n", p.Port, p.Name, admin, p.Status, p.Class, p.Draw, p.Allocation)
+	}
+	tw.Flush()
+}
 
+// readBudget reads the ports' draw and settings and accounts for them
+// against the switch's budget. known is false when neither the config nor
+// the cached token says which model the switch is.
+func readBudget(ctx context.Context, sess *session.Session) (b poe.Budget, known bool, err error) {
+	settings, err := sess.Settings(ctx)
+	if err != nil {
+		return b, false, err
+	}
+	statuses, err := sess.Status(ctx)
 	if err != nil {
-		logMessage("Failed to enable POE on %s ports %v: %v", switchAddress, ports, err)
-		log.Fatalf("Failed to enable POE on ports %v: %v", ports, err)
+		return b, false, err
+	}
+	model := globalSwitch.Model
+	if model == "" {
+		model = sess.Model()
+	}
+	total, known := poe.ResolveBudget(model, globalSwitch.PoEBudget)
+	return poe.ComputeBudget(model, total, statuses, settings), known, nil
+}
+
+// checkBudget warns, or with --budget-check refuse exits, when enabling
+// ports could draw more than the switch has left. Each newly enabled port
+// is counted at the maximum for its class.
+func checkBudget(ctx context.Context, sess *session.Session, ports []int) {
+	refuse := globalBudget == "refuse"
+	b, known, err := readBudget(ctx, sess)
+	switch {
+	case err != nil && refuse:
+		fatal(err, "Cannot check the PoE budget: %v", err)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Warning: cannot check the PoE budget: %v\n", err)
+		logMessage("Budget check on %s failed: %v", sess.Address, err)
+		return
+	case !known && refuse:
+		fatal(errs.ErrUsage, "Cannot check the PoE budget: set model or poe_budget_w for %s in the config file", globalSwitchName)
+	case !known:
+		if globalDebug {
+			fmt.Printf("PoE budget of %s is unknown; skipping the budget check\n", globalSwitchName)
+		}
+		return
 	}
 
-	fmt.Printf("✓ Enabled POE on ports %v\n", ports)
-	logMessage("Successfully enabled POE on %s ports %v", switchAddress, ports)
+	extra := b.Project(ports)
+	if extra <= b.Available {
+		if globalDebug {
+			fmt.Printf("Enabling ports %v needs up to %.1f W; %.1f W available\n", ports, extra, b.Available)
+		}
+		return
+	}
+	message := fmt.Sprintf("enabling ports %v needs up to %.1f W but only %.1f W of the %.0f W budget is available (%.1f W used, %.1f W reserved)",
+		ports, extra, max(b.Available, 0), b.Total, b.Used, b.Reserved)
+	logMessage("Budget check on %s: %s", sess.Address, message)
+	if refuse {
+		fatal(errs.ErrOverBudget, "Not enabling: %s", message)
+	}
+	fmt.Fprintf(os.Stderr, "Warning: %s\n", message)
 }
 
-func disablePorts(globalOpts *go_netgear.GlobalOptions, switchAddress string, portArgs []string) {
+// setPorts enables or disables POE on the given ports. Ports are changed one
+// at a time so an interrupt or failure can report exactly which changed.
+func setPorts(ctx context.Context, sess *session.Session, portArgs []string, enabled bool) {
+	verb, doing, done := "disable", "Disabling", "Disabled"
+	if enabled {
+		verb, doing, done = "enable", "Enabling", "Enabled"
+	}
+
 	ports := parsePorts(portArgs)
 	if len(ports) == 0 {
-		logMessage("Disable ports failed: no port numbers specified")
-		log.Fatal("No port numbers specified")
+		logMessage("%s ports failed: no port numbers specified", doing)
+		fatal(errs.ErrUsage, "No port numbers specified")
+	}
+	if enabled && globalBudget != "off" {
+		checkBudget(ctx, sess, ports)
 	}
 
 	if globalDebug {
-		fmt.Printf("Disabling POE on ports: %v\n", ports)
+		fmt.Printf("%s POE on ports: %v\n", doing, ports)
 	}
-	logMessage("Disabling POE on %s ports %v", switchAddress, ports)
+	logMessage("%s POE on %s ports %v", doing, sess.Address, ports)
 
-	err := handleAuthError(func() error {
-		cmd := &go_netgear.PoeSetConfigCommand{
-			Address: switchAddress,
-			Ports:   ports,
-			PortPwr: "disable",
-		}
-		if globalDebug {
-			fmt.Printf("Running PoeSetConfigCommand with PortPwr=%q\n", "disable")
-		}
-		err := cmd.Run(globalOpts)
-		if globalDebug {
-			if err != nil {
-				fmt.Printf("PoeSetConfigCommand returned error: %v\n", err)
-			} else {
-				fmt.Printf("PoeSetConfigCommand completed successfully\n")
-			}
-		}
-		return err
+	result := notifyHooks(ctx, sess, verb, ports, func() *session.PortResult {
+		return sess.SetPower(ctx, ports, enabled)
 	})
-
-	if err != nil {
-		logMessage("Failed to disable POE on %s ports %v: %v", switchAddress, ports, err)
-		log.Fatalf("Failed to disable POE on ports %v: %v", ports, err)
+	if err := result.Err(); err != nil {
+		logMessage("Failed to %s POE on %s ports %v: %v", verb, sess.Address, ports, err)
+		fatalPorts(err, result, "Failed to %s POE on ports %v: %v", verb, ports, err)
+	}
+
+	if globalVerify {
+		if err := verifyPorts(ctx, sess, ports, enabled); err != nil {
+			logMessage("Verification failed on %s: %v", sess.Address, err)
+			// The change went through but did not stick; the audit record
+			// and hooks must not report it as a success
+			pendingEvent.SetResult(pendingEvent.Detail, err)
+			fatal(err, "Verification failed: %v", err)
+		}
 	}
 
-	fmt.Printf("✓ Disabled POE on ports %v\n", ports)
-	logMessage("Successfully disabled POE on %s ports %v", switchAddress, ports)
+	reportSuccess(ports, done+" POE on ports")
+	logMessage("Successfully %sd POE on %s ports %v", verb, sess.Address, ports)
 }
 
-func cyclePorts(globalOpts *go_netgear.GlobalOptions, switchAddress string, portArgs []string) {
+func cyclePorts(ctx context.Context, sess *session.Session, portArgs []string) {
 	ports := parsePorts(portArgs)
 	if len(ports) == 0 {
 		logMessage("Cycle ports failed: no port numbers specified")
-		log.Fatal("No port numbers specified")
+		fatal(errs.ErrUsage, "No port numbers specified")
 	}
 
-	logMessage("Power cycling POE on %s ports %v", switchAddress, ports)
-	err := handleAuthError(func() error {
-		cmd := &go_netgear.PoeCyclePowerCommand{
-			Address: switchAddress,
-			Ports:   ports,
-		}
-		return cmd.Run(globalOpts)
+	logMessage("Power cycling POE on %s ports %v", sess.Address, ports)
+	result := notifyHooks(ctx, sess, hooks.EventCycle, ports, func() *session.PortResult {
+		return sess.Cycle(ctx, ports)
 	})
-
-	if err != nil {
-		logMessage("Failed to cycle power on %s ports %v: %v", switchAddress, ports, err)
-		log.Fatalf("Failed to cycle power on ports %v: %v", ports, err)
+	if err := result.Err(); err != nil {
+		logMessage("Failed to cycle power on %s ports %v: %v", sess.Address, ports, err)
+		fatalPorts(err, result, "Failed to cycle power on ports %v: %v", ports, err)
 	}
 
-	fmt.Printf("✓ Power cycle completed on ports %v\n", ports)
-	logMessage("Successfully cycled power on %s ports %v", switchAddress, ports)
+	reportSuccess(ports, "Power cycle completed on ports")
+	logMessage("Successfully cycled power on %s ports %v", sess.Address, ports)
 }
 
-func parsePorts(args []string) []int {
-	var ports []int
-	seen := make(map[int]bool) // Track seen ports to avoid duplicates
-
-	for _, arg := range args {
-		// Handle comma-separated lists
-		for _, p := range strings.Split(arg, ",") {
-			p = strings.TrimSpace(p)
-
-			// Check if it's a range (e.g., "1-8")
-			if strings.Contains(p, "-") {
-				rangeParts := strings.SplitN(p, "-", 2)
-				if len(rangeParts) != 2 {
-					log.Fatalf("Invalid port range: %s", p)
-				}
-
-				start, err := strconv.Atoi(strings.TrimSpace(rangeParts[0]))
-				if err != nil {
-					log.Fatalf("Invalid port range start: %s", rangeParts[0])
-				}
-
-				end, err := strconv.Atoi(strings.TrimSpace(rangeParts[1]))
-				if err != nil {
-					log.Fatalf("Invalid port range end: %s", rangeParts[1])
-				}
-
-				if start > end {
-					log.Fatalf("Invalid port range %s: start must be <= end", p)
-				}
-
-				// Add all ports in the range
-				for port := start; port <= end; port++ {
-					if !seen[port] {
-						ports = append(ports, port)
-						seen[port] = true
-					}
-				}
-			} else {
-				// Single port number
-				port, err := strconv.Atoi(p)
-				if err != nil {
-					log.Fatalf("Invalid port number: %s", p)
-				}
-
-				if !seen[port] {
-					ports = append(ports, port)
-					seen[port] = true
-				}
-			}
+// notifyHooks runs a port change and reports it, with the ports' state
+// before and after, to the hooks in the config file
+func notifyHooks(ctx context.Context, sess *session.Session, action string, ports []int, do func() *session.PortResult) *session.PortResult {
+	event := hooks.NewEvent(action, globalSwitchName, sess.Address, ports, hooks.CurrentActor("poe-management"))
+	result, event := globalHooks.Change(ctx, sess, event, do)
+	pendingEvent = &event
+	audited = true
+	return result
+}
+
+// flushHooks releases the switch lock and then delivers the pending change
+// event, so a slow hook does not hold up other runs against the switch. It
+// runs on every exit, including fatal errors.
+func flushHooks() {
+	if globalUnlock != nil {
+		globalUnlock()
+	}
+	if pendingEvent == nil {
+		return
+	}
+	event := *pendingEvent
+	pendingEvent = nil
+	// Report what changed even after Ctrl-C or --timeout, but do not hang
+	fireCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	globalHooks.Fire(fireCtx, event)
+}
+
+// auditCommand writes the audit record for a command that did not reach
+// notifyHooks: a change that failed before anything was attempted, or a
+// read when the config asks for reads to be audited
+func auditCommand(err error, message string, result *session.PortResult) {
+	if globalAudit == nil || audited {
+		return
+	}
+	switch globalCommand {
+	case "enable", "disable", "cycle":
+	case "status", "settings", "budget":
+		if !globalAuditReads {
+			return
 		}
+	default:
+		return
 	}
-	return ports
+	audited = true
+
+	e := hooks.NewEvent(globalCommand, globalSwitchName, globalSwitchAddr, globalPorts, hooks.CurrentActor("poe-management"))
+	e.Time = globalStart.UTC()
+	e.SetResult(result, err)
+	if message != "" {
+		e.Error = message
+	}
+	e.Duration = hooks.Milliseconds(time.Since(globalStart))
+	globalAudit.Record(e)
 }
 
-// getPasswordFromEnv checks for password in environment variables
-// hasValidToken checks if a cached token file exists for the given address
-func hasValidToken(address string, debug bool) bool {
-	tokenDir := os.TempDir()
-	tokenPath := getTokenPath(tokenDir, address)
+// verifyPorts re-reads the POE settings and checks every port in ports has
+// the expected admin power state
+func verifyPorts(ctx context.Context, sess *session.Session, ports []int, enabled bool) error {
+	if globalDebug {
+		fmt.Printf("Verifying ports %v are %s...\n", ports, powerState(enabled))
+	}
 
-	_, err := os.Stat(tokenPath)
-	exists := err == nil
+	settings, err := sess.Settings(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read settings for verification: %w", err)
+	}
+
+	enabledByPort := make(map[int]bool, len(settings))
+	for _, s := range settings {
+		enabledByPort[s.Port] = s.Enabled()
+	}
 
-	if debug {
-		if exists {
-			fmt.Printf("Found cached token at %s\n", tokenPath)
-		} else {
-			fmt.Printf("No cached token found at %s\n", tokenPath)
+	var wrong []int
+	for _, port := range ports {
+		if state, ok := enabledByPort[port]; !ok || state != enabled {
+			wrong = append(wrong, port)
 		}
 	}
+	if len(wrong) > 0 {
+		return fmt.Errorf("%w: ports %v are not %s", errs.ErrVerifyMismatch, wrong, powerState(enabled))
+	}
 
-	return exists
+	logMessage("Verified %s ports %v are %s", sess.Address, ports, powerState(enabled))
+	return nil
 }
 
-// getTokenPath returns the expected token file path for a given address
-// This mirrors the logic in the go-netgear library
-func getTokenPath(configDir string, host string) string {
-	// Using adler32 hash to match library behavior
-	hash32 := adler32.New()
-	io.WriteString(hash32, host)
-	hash := fmt.Sprintf("%x", hash32.Sum(nil))
+func powerState(enabled bool) string {
+	if enabled {
+		return "enabled"
+	}
+	return "disabled"
+}
 
-	if configDir == "" {
-		configDir = os.TempDir()
+// parsePorts parses port arguments, exiting with a usage error if they are invalid
+func parsePorts(args []string) []int {
+	ports, err := poe.ParsePorts(args)
+	if err != nil {
+		fatal(errs.ErrUsage, "%v", err)
 	}
-	dotConfigDir := configDir + "/.config/ntgrrc"
-	return dotConfigDir + "/token-" + hash
+	return ports
 }
 
-func getPasswordFromEnv(address string, debug bool) string {
-	// Check NETGEAR_PASSWORD_<hostname> format
-	envVar := "NETGEAR_PASSWORD_" + address
-	if password := os.Getenv(envVar); password != "" {
-		if debug {
-			fmt.Printf("Found password in environment variable %s\n", envVar)
-		}
-		return password
-	}
-
-	// Check NETGEAR_SWITCHES format: "host1:password1;host2:password2"
-	switches := os.Getenv("NETGEAR_SWITCHES")
-	if debug {
-		fmt.Printf("NETGEAR_SWITCHES environment variable: %q\n", switches)
-	}
-
-	if switches != "" {
-		for _, entry := range strings.Split(switches, ";") {
-			if debug {
-				fmt.Printf("  Checking entry: %q\n", entry)
-			}
-			parts := strings.SplitN(entry, ":", 2)
-			if debug {
-				fmt.Printf("  Split into %d parts: %v\n", len(parts), parts)
-			}
-			if len(parts) == 2 {
-				host := strings.TrimSpace(parts[0])
-				pass := strings.TrimSpace(parts[1])
-				if debug {
-					fmt.Printf("  Parsed: host=%q pass=%q (looking for %q)\n", host, pass, address)
-				}
-				if host == address {
-					if debug {
-						fmt.Printf("Found password for %s in NETGEAR_SWITCHES\n", address)
-					}
-					return pass
-				}
-			}
-		}
+// lookupPassword resolves the password for sw through its credential providers.
+// A missing password is not an error; a cached token may still be usable.
+func lookupPassword(cfg *config.Config, sw config.Switch, stdin io.Reader) (string, error) {
+	var debugf credentials.Logf
+	if globalDebug {
+		debugf = func(format string, args ...interface{}) { fmt.Printf(format, args...) }
 	}
 
-	if debug {
-		fmt.Printf("No password found in environment variables for %s\n", address)
-		fmt.Printf("Checked: %s and NETGEAR_SWITCHES\n", envVar)
+	providers, err := credentials.ForSwitch(sw, credentials.Options{
+		Stdin:  stdin,
+		Vault:  cfg.Vault,
+		Debugf: debugf,
+	})
+	if err != nil {
+		return "", err
 	}
 
-	return ""
-}
\ No newline at end of file
+	password, err := credentials.Resolve(sw, providers, debugf)
+	if errors.Is(err, credentials.ErrNotFound) {
+		if globalDebug {
+			fmt.Printf("No password found for %s\n", sw.Name)
+		}
+		return "", nil
+	}
+	return password, err
+}
@@ -9,13 +9,17 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
-	"strings"
 
 	"github.com/gherlein/go-netgear"
+
+	"netgearcli/internal/config"
+	"netgearcli/internal/credentials"
+	"netgearcli/internal/errs"
 )
 
 func main() {
@@ -31,13 +35,16 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Set environment variables:\n")
 		fmt.Fprintf(os.Stderr, "  NETGEAR_PASSWORD_<hostname>=password\n")
 		fmt.Fprintf(os.Stderr, "  OR NETGEAR_SWITCHES=\"host:password;...\"\n")
+		fmt.Fprintf(os.Stderr, "  OR NETGEAR_PASSWORD_FILE=/run/secrets/netgear\n")
+		fmt.Fprintf(os.Stderr, "  OR password_command/pass_entry in ~/.config/netgear/config.json\n")
 		fmt.Fprintf(os.Stderr, "Examples:\n")
 		fmt.Fprintf(os.Stderr, "  export NETGEAR_PASSWORD_tswitch1=\"None1234@\"\n")
 		fmt.Fprintf(os.Stderr, "  export NETGEAR_SWITCHES=\"tswitch1:None1234@;tswitch2:None1234@\"\n")
 		os.Exit(1)
 	}
 
-	switchAddress := args[0]
+	// Resolve the configured address and password (credential providers)
+	switchAddress, password := lookupSwitch(args[0], debug)
 
 	if debug {
 		fmt.Printf("Debug mode enabled\n")
@@ -50,9 +57,6 @@ func main() {
 		OutputFormat: go_netgear.JsonFormat,
 	}
 
-	// Try to get password from environment variables
-	password := getPasswordFromEnv(switchAddress, debug)
-
 	// Try to login with password from environment or empty (will use cached token)
 	loginCmd := &go_netgear.LoginCommand{
 		Address:  switchAddress,
@@ -66,8 +70,9 @@ func main() {
 			fmt.Printf("Login attempt result: %v\n", err)
 		}
 
-		if strings.Contains(err.Error(), "no session") || strings.Contains(err.Error(), "login") || strings.Contains(err.Error(), "password") {
-			log.Fatalf("Authentication failed: %v\nEnsure environment variables are set correctly", err)
+		err = errs.Classify(err)
+		if errors.Is(err, errs.ErrAuthRequired) || errors.Is(err, errs.ErrBadPassword) {
+			fatal(err, "Authentication failed: %v\nEnsure environment variables are set correctly", err)
 		}
 	}
 
@@ -80,42 +85,45 @@ func main() {
 
 	err = cmd.Run(globalOpts)
 	if err != nil {
-		log.Fatalf("Failed to get POE status: %v", err)
+		fatal(err, "Failed to get POE status: %v", err)
 	}
 }
 
-// getPasswordFromEnv checks for password in environment variables
-func getPasswordFromEnv(address string, debug bool) string {
-	// Check NETGEAR_PASSWORD_<hostname> format
-	envVar := "NETGEAR_PASSWORD_" + address
-	if password := os.Getenv(envVar); password != "" {
-		if debug {
-			fmt.Printf("Found password in environment variable %s\n", envVar)
-		}
-		return password
+// lookupSwitch resolves a switch name to its configured address and looks up
+// its password using the credential providers configured for it
+// (password_command, pass, secret files, environment variables, ~/.netrc)
+func lookupSwitch(name string, debug bool) (string, string) {
+	var debugf credentials.Logf
+	if debug {
+		debugf = func(format string, args ...interface{}) { fmt.Printf(format, args...) }
 	}
 
-	// Check NETGEAR_SWITCHES format: "host1:password1;host2:password2"
-	if switches := os.Getenv("NETGEAR_SWITCHES"); switches != "" {
-		for _, entry := range strings.Split(switches, ";") {
-			parts := strings.SplitN(entry, ":", 2)
-			if len(parts) == 2 {
-				host := strings.TrimSpace(parts[0])
-				pass := strings.TrimSpace(parts[1])
-				if host == address {
-					if debug {
-						fmt.Printf("Found password for %s in NETGEAR_SWITCHES\n", address)
-					}
-					return pass
-				}
-			}
-		}
+	cfg, err := config.Load("")
+	if err != nil {
+		log.Fatalf("%v", err)
 	}
+	sw := cfg.Lookup(name)
 
-	if debug {
-		fmt.Printf("No password found in environment variables for %s\n", address)
-		fmt.Printf("Checked: %s and NETGEAR_SWITCHES\n", envVar)
+	providers, err := credentials.ForSwitch(sw, credentials.Options{Vault: cfg.Vault, Debugf: debugf})
+	if err != nil {
+		log.Fatalf("%v", err)
 	}
 
-	return ""
-}
\ No newline at end of file
+	password, err := credentials.Resolve(sw, providers, debugf)
+	if err != nil {
+		if !errors.Is(err, credentials.ErrNotFound) {
+			log.Fatalf("Failed to look up password for %s: %v", name, err)
+		}
+		if debug {
+			fmt.Printf("No password found for %s\n", name)
+		}
+		return sw.Address, ""
+	}
+	return sw.Address, password
+}
+
+// fatal logs a message and exits with the status for err's error class
+func fatal(err error, format string, args ...interface{}) {
+	log.Printf(format, args...)
+	os.Exit(errs.ExitCode(err))
+}
@@ -1,143 +1,280 @@
 // poe_status.go - Example program showing how to use the go-netgear library
 // to login to a Netgear switch and display POE status for all ports.
 //
-// Usage: go run poe_status.go [--debug|-d] <switch-hostname>
+// Usage: go run poe_status.go [--debug|-d] [--color auto|always|never] [--output text|json]
+//                             [--watch [--interval 5s]] <switch-hostname>
 //
 // This example demonstrates:
 // - Creating commands with the library
-// - Checking environment variables before prompting for password
+// - Checking configured credential sources before prompting for password
 // - Fetching POE status
 // - Displaying the results
+//
+// The status is printed as a table with a summary; --output json prints the
+// library's JSON instead. With --watch it shows a live dashboard, like
+// "netgear top".
 
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
-	"golang.org/x/term"
 	"github.com/gherlein/go-netgear"
+	"golang.org/x/term"
+
+	"netgearcli/internal/ansi"
+	"netgearcli/internal/audit"
+	"netgearcli/internal/config"
+	"netgearcli/internal/credentials"
+	"netgearcli/internal/errs"
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/hooks"
+	"netgearcli/internal/poe"
+	"netgearcli/internal/session"
+	"netgearcli/internal/top"
 )
 
+// progress receives the connection and debug messages: stdout with the
+// table, stderr with --output json so stdout holds only the JSON
+var progress io.Writer = os.Stdout
+
 func main() {
 	// Parse command line flags
-	var debug bool
+	var debug, watch bool
+	var interval time.Duration
+	var colorMode, output string
 	flag.BoolVar(&debug, "debug", false, "Enable debug output")
 	flag.BoolVar(&debug, "d", false, "Enable debug output (shorthand)")
+	flag.BoolVar(&watch, "watch", false, "Show a live dashboard that refreshes until you quit")
+	flag.BoolVar(&watch, "w", false, "Show a live dashboard (shorthand)")
+	flag.DurationVar(&interval, "interval", 5*time.Second, "How often --watch refreshes")
+	flag.StringVar(&colorMode, "color", "auto", "Color the table: auto (when stdout is a terminal), always or never")
+	flag.StringVar(&output, "output", "text", "Output format: text (a table) or json")
+	flag.StringVar(&output, "o", "text", "Output format: text or json (shorthand)")
 	flag.Parse()
 
 	args := flag.Args()
 	if len(args) != 1 {
-		fmt.Fprintf(os.Stderr, "Usage: %s [--debug|-d] <switch-hostname>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [--debug|-d] [--color auto|always|never] [--output text|json] [--watch|-w [--interval 5s]] <switch-hostname>\n", os.Args[0])
 		os.Exit(1)
 	}
+	color, err := ansi.UseColor(colorMode)
+	if err != nil {
+		fatal(err, "%v", err)
+	}
+	if output != "text" && output != "json" {
+		fatal(errs.ErrUsage, "Invalid --output %q: must be text or json", output)
+	}
+	if output == "json" {
+		progress = os.Stderr
+	}
 
-	switchAddress := args[0]
+	// Resolve the configured address and look up the password before
+	// connecting; LoginCommand will prompt if none was found
+	cfg, sw, password := lookupSwitch(args[0], debug)
+	switchAddress := sw.Address
 
-	fmt.Printf("Connecting to switch at %s...\n", switchAddress)
+	fmt.Fprintf(progress, "Connecting to switch at %s...\n", switchAddress)
 
 	if debug {
-		fmt.Println("Debug mode enabled")
-		fmt.Printf("Switch address: %s\n", switchAddress)
+		fmt.Fprintln(progress, "Debug mode enabled")
+		fmt.Fprintf(progress, "Switch address: %s\n", switchAddress)
 	}
 
-	// Set up global options
+	// Set up global options. The library prints its debug lines to stdout,
+	// so they are left out of --output json.
 	globalOpts := &go_netgear.GlobalOptions{
-		Verbose:      debug,
+		Verbose:      debug && output == "text",
 		OutputFormat: go_netgear.JsonFormat,
 	}
 
-	// Check for password in environment variables first
-	password := getPasswordFromEnv(switchAddress, debug)
-
 	// Try to login - use env password if found, otherwise LoginCommand will prompt
 	loginCmd := &go_netgear.LoginCommand{
 		Address:  switchAddress,
 		Password: password,
 	}
 
-	err := loginCmd.Run(globalOpts)
+	err = errs.Classify(loginCmd.Run(globalOpts))
 	if err != nil {
-		// If login failed and we didn't have an env password, try prompting
-		if password == "" && (strings.Contains(err.Error(), "password") || strings.Contains(err.Error(), "authentication")) {
-			fmt.Print("Enter admin password: ")
+		// If login failed and we didn't have a password, try prompting
+		if password == "" && (errors.Is(err, errs.ErrAuthRequired) || errors.Is(err, errs.ErrBadPassword)) {
+			fmt.Fprint(progress, "Enter admin password: ")
 			promptPassword, err := readPassword()
 			if err != nil {
 				log.Fatalf("Failed to read password: %v", err)
 			}
-			fmt.Println() // New line after password input
+			fmt.Fprintln(progress) // New line after password input
 
 			// Try login again with prompted password
+			password = promptPassword
 			loginCmd.Password = promptPassword
 			err = loginCmd.Run(globalOpts)
 			if err != nil {
-				log.Fatalf("Login failed: %v", err)
+				fatal(err, "Login failed: %v", err)
 			}
 		} else {
-			log.Fatalf("Login failed: %v", err)
+			fatal(err, "Login failed: %v", err)
 		}
 	}
 
-	fmt.Printf("Successfully connected to %s\n", switchAddress)
+	fmt.Fprintf(progress, "Successfully connected to %s\n", switchAddress)
+
+	if watch {
+		if err := watchStatus(cfg, sw, password, interval); err != nil {
+			fatal(err, "%v", err)
+		}
+		return
+	}
 
 	// Get POE status for all ports
-	fmt.Println("\nFetching POE status...")
+	fmt.Fprintln(progress, "\nFetching POE status...")
 	if debug {
-		fmt.Println("Making request to POE status endpoint...")
+		fmt.Fprintln(progress, "Making request to POE status endpoint...")
 	}
 
 	cmd := &go_netgear.PoeStatusCommand{
 		Address: switchAddress,
 	}
 
-	err = cmd.Run(globalOpts)
+	if output == "json" {
+		err = cmd.Run(globalOpts)
+		if err != nil {
+			fatal(err, "Failed to get POE status: %v", err)
+		}
+		if debug {
+			fmt.Fprintln(progress, "POE status retrieval completed")
+		}
+		return
+	}
+
+	// Capture the JSON without the library's debug lines, which would
+	// corrupt it
+	captureOpts := *globalOpts
+	captureOpts.Verbose = false
+
+	out, err := poe.Capture(func() error { return cmd.Run(&captureOpts) })
+	if err != nil {
+		fatal(err, "Failed to get POE status: %v", err)
+	}
+	statuses, err := poe.ParseStatus(out)
 	if err != nil {
-		log.Fatalf("Failed to get POE status: %v", err)
+		fatal(err, "Failed to parse POE status: %v", err)
+	}
+
+	// The admin state comes from the settings; the table is still useful
+	// without it
+	var settings []poe.PortSettings
+	settingsCmd := &go_netgear.PoeShowSettingsCommand{Address: switchAddress}
+	out, err = poe.Capture(func() error { return settingsCmd.Run(&captureOpts) })
+	if err == nil {
+		settings, err = poe.ParseSettings(out)
+	}
+	if err != nil && debug {
+		fmt.Fprintf(progress, "Could not read POE settings: %v\n", err)
 	}
 
 	if debug {
-		fmt.Println("POE status retrieval completed")
+		fmt.Fprintln(progress, "POE status retrieval completed")
+	}
+	fmt.Fprintln(progress)
+	model := sw.Model
+	if model == "" {
+		model = session.CachedModel(globalOpts.TokenDir, switchAddress)
+	}
+	budget, _ := poe.ResolveBudget(model, sw.PoEBudget)
+	err = poe.WriteTable(os.Stdout, statuses, settings, poe.TableOptions{Color: color, Budget: budget})
+	if err != nil {
+		fatal(err, "%v", err)
 	}
 }
 
-// getPasswordFromEnv checks for password in environment variables
-func getPasswordFromEnv(address string, debug bool) string {
-	// Check NETGEAR_PASSWORD_<hostname> format
-	envVar := "NETGEAR_PASSWORD_" + address
-	if password := os.Getenv(envVar); password != "" {
-		if debug {
-			fmt.Printf("Found password in environment variable %s\n", envVar)
-		}
-		return password
-	}
-
-	// Check NETGEAR_SWITCHES format: "host1:password1;host2:password2"
-	if switches := os.Getenv("NETGEAR_SWITCHES"); switches != "" {
-		for _, entry := range strings.Split(switches, ";") {
-			parts := strings.SplitN(entry, ":", 2)
-			if len(parts) == 2 {
-				host := strings.TrimSpace(parts[0])
-				pass := strings.TrimSpace(parts[1])
-				if host == address {
-					if debug {
-						fmt.Printf("Found password for %s in NETGEAR_SWITCHES\n", address)
-					}
-					return pass
-				}
-			}
-		}
+// watchStatus shows the live dashboard for sw until the user quits. Changes
+// made from the dashboard go to the configured hooks and audit log.
+func watchStatus(cfg *config.Config, sw config.Switch, password string, interval time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	session.BindDefaultTransport(ctx, 0)
+
+	// Hook and audit failures are held until the dashboard has restored
+	// the terminal
+	held := &top.HeldLog{}
+	defer held.Flush(os.Stderr)
+	d, err := hooks.New(cfg.Hooks)
+	if err != nil {
+		return err
+	}
+	d.Logf = held.Logf
+	auditLog, err := audit.Open(cfg.Audit, "")
+	if err != nil {
+		return err
 	}
+	defer auditLog.Close()
+	if auditLog != nil {
+		auditLog.Logf = held.Logf
+		d.Recorders = append(d.Recorders, auditLog)
+	}
+
+	// A fleet of one, so the dashboard locks and reports changes the same
+	// way as "netgear top"
+	one := *cfg
+	one.Switches = []config.Switch{sw}
+	f, err := fleet.New(&one, fleet.Options{LockTimeout: interval, Hooks: d})
+	if err != nil {
+		return err
+	}
+	m, _ := f.Get(sw.Name)
+	m.Session.Password = password
+
+	dash := &top.Dashboard{
+		Members:  []*fleet.Member{m},
+		Interval: interval,
+		Actor:    hooks.CurrentActor("poe-status"),
+		Title:    "poe-status",
+	}
+	return dash.Run(ctx)
+}
 
+// lookupSwitch resolves a switch name to its configured entry and looks up
+// its password using the credential providers configured for it
+// (password_command, pass, secret files, environment variables, ~/.netrc)
+func lookupSwitch(name string, debug bool) (*config.Config, config.Switch, string) {
+	var debugf credentials.Logf
 	if debug {
-		fmt.Printf("No password found in environment variables for %s\n", address)
-		fmt.Printf("Checked: %s and NETGEAR_SWITCHES\n", envVar)
+		debugf = func(format string, args ...interface{}) { fmt.Fprintf(progress, format, args...) }
 	}
 
-	return ""
+	cfg, err := config.Load("")
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	sw := cfg.Lookup(name)
+
+	providers, err := credentials.ForSwitch(sw, credentials.Options{Vault: cfg.Vault, Debugf: debugf})
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	password, err := credentials.Resolve(sw, providers, debugf)
+	if err != nil {
+		if !errors.Is(err, credentials.ErrNotFound) {
+			log.Fatalf("Failed to look up password for %s: %v", name, err)
+		}
+		if debug {
+			fmt.Fprintf(progress, "No password found for %s\n", name)
+		}
+		return cfg, sw, ""
+	}
+	return cfg, sw, password
 }
 
 // readPassword reads a password from stdin without echoing
@@ -147,4 +284,10 @@ func readPassword() (string, error) {
 		return "", err
 	}
 	return strings.TrimSpace(string(bytePassword)), nil
-}
\ No newline at end of file
+}
+
+// fatal logs a message and exits with the status for err's error class
+func fatal(err error, format string, args ...interface{}) {
+	log.Printf(format, args...)
+	os.Exit(errs.ExitCode(err))
+}
@@ -4,6 +4,7 @@ go 1.23.0
 
 require (
 	github.com/gherlein/go-netgear v0.0.1
+	golang.org/x/sys v0.34.0
 	golang.org/x/term v0.33.0
 )
 
@@ -12,5 +13,4 @@ require (
 	github.com/alecthomas/kong v1.12.1 // indirect
 	github.com/andybalholm/cascadia v1.3.3 // indirect
 	golang.org/x/net v0.39.0 // indirect
-	golang.org/x/sys v0.34.0 // indirect
 )
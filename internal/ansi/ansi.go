@@ -0,0 +1,39 @@
+// Package ansi holds the terminal escape sequences shared by the colored
+// tables, the snapshot diff and the live dashboard, and decides when to use
+// them.
+package ansi
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+
+	"netgearcli/internal/errs"
+)
+
+// Styles
+const (
+	Reset   = "\x1b[0m"
+	Bold    = "\x1b[1m"
+	Dim     = "\x1b[2m"
+	Reverse = "\x1b[7m"
+	Red     = "\x1b[31m"
+	Green   = "\x1b[32m"
+	Yellow  = "\x1b[33m"
+	Cyan    = "\x1b[36m"
+)
+
+// UseColor decides whether to color output for --color. "auto" colors only
+// when stdout is a terminal, NO_COLOR is not set and TERM is not "dumb".
+func UseColor(mode string) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		return term.IsTerminal(int(os.Stdout.Fd())) && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb", nil
+	}
+	return false, fmt.Errorf("%w: invalid --color %q: must be auto, always or never", errs.ErrUsage, mode)
+}
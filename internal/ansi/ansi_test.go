@@ -0,0 +1,38 @@
+package ansi
+
+import (
+	"errors"
+	"testing"
+
+	"netgearcli/internal/errs"
+)
+
+func TestUseColor(t *testing.T) {
+	// Whatever the test's stdout is, NO_COLOR turns auto off
+	t.Setenv("NO_COLOR", "1")
+	tests := []struct {
+		mode    string
+		want    bool
+		wantErr bool
+	}{
+		{mode: "always", want: true},
+		{mode: "never", want: false},
+		{mode: "auto", want: false},
+		{mode: "yes", wantErr: true},
+		{mode: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			got, err := UseColor(tt.mode)
+			if tt.wantErr {
+				if !errors.Is(err, errs.ErrUsage) {
+					t.Errorf("error = %v, want a usage error", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("UseColor = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+// Package api serves the configured switches over a small JSON REST API:
+//
+//	GET  /switches
+//	GET  /switches/{id}/poe
+//	GET  /switches/{id}/settings
+//	POST /switches/{id}/ports/{n}/enable|disable|cycle
+//
+// {n} may be a single port or a list such as "1-4,7".
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"netgearcli/internal/errs"
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/hooks"
+	"netgearcli/internal/poe"
+	"netgearcli/internal/session"
+)
+
+// Server exposes a fleet over HTTP.
+type Server struct {
+	Fleet *fleet.Fleet
+	// Token, if set, must be sent as "Authorization: Bearer <token>".
+	Token string
+	// RequestTimeout bounds each request, including waiting for the lock.
+	RequestTimeout time.Duration
+	Logf           func(format string, args ...interface{})
+}
+
+// Handler returns the API's HTTP handler.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("GET /switches", s.listSwitches)
+	mux.HandleFunc("GET /switches/{id}/poe", s.withMember(s.getStatus))
+	mux.HandleFunc("GET /switches/{id}/settings", s.withMember(s.getSettings))
+	mux.HandleFunc("POST /switches/{id}/ports/{n}/{action}", s.withMember(s.changePorts))
+	return s.authenticate(mux)
+}
+
+// switchInfo is one entry of GET /switches.
+type switchInfo struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+// statusResponse is returned by GET /switches/{id}/poe.
+type statusResponse struct {
+	Switch string           `json:"switch"`
+	Ports  []poe.PortStatus `json:"ports"`
+}
+
+// settingsResponse is returned by GET /switches/{id}/settings.
+type settingsResponse struct {
+	Switch string             `json:"switch"`
+	Ports  []poe.PortSettings `json:"ports"`
+}
+
+// changeResponse is returned by the port actions.
+type changeResponse struct {
+	Switch string              `json:"switch"`
+	Action string              `json:"action"`
+	Ports  *session.PortResult `json:"ports"`
+}
+
+// errorResponse has the shape of the error object poe-management prints
+// with --output json, with the HTTP status in place of its exit code.
+type errorResponse struct {
+	Error struct {
+		Status  int                 `json:"status"`
+		Class   string              `json:"class"`
+		Message string              `json:"message"`
+		Switch  string              `json:"switch,omitempty"`
+		Ports   *session.PortResult `json:"ports,omitempty"`
+	} `json:"error"`
+}
+
+func (s *Server) listSwitches(w http.ResponseWriter, r *http.Request) {
+	var infos []switchInfo
+	for _, m := range s.Fleet.Members() {
+		infos = append(infos, switchInfo{Name: m.Config.Name, Address: m.Config.Address})
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (s *Server) getStatus(w http.ResponseWriter, r *http.Request, m *fleet.Member) {
+	var statuses []poe.PortStatus
+	err := m.Locked(r.Context(), func(ctx context.Context) error {
+		var err error
+		statuses, err = m.Session.Status(ctx)
+		return err
+	})
+	if err != nil {
+		s.writeError(w, m.Config.Name, err, nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, statusResponse{Switch: m.Config.Name, Ports: statuses})
+}
+
+func (s *Server) getSettings(w http.ResponseWriter, r *http.Request, m *fleet.Member) {
+	var settings []poe.PortSettings
+	err := m.Locked(r.Context(), func(ctx context.Context) error {
+		var err error
+		settings, err = m.Session.Settings(ctx)
+		return err
+	})
+	if err != nil {
+		s.writeError(w, m.Config.Name, err, nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, settingsResponse{Switch: m.Config.Name, Ports: settings})
+}
+
+func (s *Server) changePorts(w http.ResponseWriter, r *http.Request, m *fleet.Member) {
+	action := r.PathValue("action")
+	ports, err := poe.ParsePorts([]string{r.PathValue("n")})
+	if err == nil && len(ports) == 0 {
+		err = fmt.Errorf("no port numbers specified")
+	}
+	if err != nil {
+		s.writeError(w, m.Config.Name, fmt.Errorf("%w: %v", errs.ErrUsage, err), nil)
+		return
+	}
+
+	actor := hooks.CurrentActor("api")
+	actor.Remote = r.RemoteAddr
+	result, err := m.Change(r.Context(), action, ports, actor)
+	s.logf("%s %s ports %v from %s: %v", action, m.Config.Name, ports, r.RemoteAddr, errOrOK(err))
+	if err != nil {
+		s.writeError(w, m.Config.Name, err, result)
+		return
+	}
+	writeJSON(w, http.StatusOK, changeResponse{Switch: m.Config.Name, Action: action, Ports: result})
+}
+
+// withMember resolves {id} to a configured switch and applies the request
+// timeout.
+func (s *Server) withMember(h func(http.ResponseWriter, *http.Request, *fleet.Member)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m, ok := s.Fleet.Get(r.PathValue("id"))
+		if !ok {
+			var resp errorResponse
+			resp.Error.Status = http.StatusNotFound
+			resp.Error.Class = "not_found"
+			resp.Error.Message = fmt.Sprintf("unknown switch %q", r.PathValue("id"))
+			writeJSON(w, http.StatusNotFound, resp)
+			return
+		}
+
+		if s.RequestTimeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), s.RequestTimeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		h(w, r, m)
+	}
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	if s.Token == "" {
+		return next
+	}
+	want := []byte("Bearer " + s.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if r.URL.Path != "/healthz" && subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			var resp errorResponse
+			resp.Error.Status = http.StatusUnauthorized
+			resp.Error.Class = "unauthorized"
+			resp.Error.Message = "missing or invalid bearer token"
+			writeJSON(w, http.StatusUnauthorized, resp)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeError sends err as an errorResponse with an HTTP status for its class.
+func (s *Server) writeError(w http.ResponseWriter, name string, err error, result *session.PortResult) {
+	status := httpStatus(err)
+	var resp errorResponse
+	resp.Error.Status = status
+	resp.Error.Class = errs.Name(err)
+	resp.Error.Message = err.Error()
+	resp.Error.Switch = name
+	resp.Error.Ports = result
+	writeJSON(w, status, resp)
+}
+
+// httpStatus maps an error class to a response status.
+func httpStatus(err error) int {
+	switch {
+	case errors.Is(err, errs.ErrUsage):
+		return http.StatusBadRequest
+	case errors.Is(err, errs.ErrPartial):
+		// The switch failed some ports; the body says which
+		return http.StatusBadGateway
+	}
+	switch errs.Class(errs.Classify(err)) {
+	case errs.ErrSwitchBusy:
+		return http.StatusServiceUnavailable
+	case errs.ErrTimeout:
+		return http.StatusGatewayTimeout
+	case errs.ErrUnreachable, errs.ErrAuthRequired, errs.ErrBadPassword, errs.ErrUnsupportedModel:
+		return http.StatusBadGateway
+	case errs.ErrCanceled:
+		// The client went away; nobody will read this
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func errOrOK(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	return strings.TrimSpace(err.Error())
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
@@ -0,0 +1,172 @@
+// Package audit records who changed what on which switch as JSON lines,
+// in a file and optionally in syslog, so that questions such as "who turned
+// off port 7 on tswitch16 last Tuesday" can be answered with grep or jq.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"netgearcli/internal/config"
+	"netgearcli/internal/hooks"
+	"netgearcli/internal/session"
+)
+
+// Record is one line of the audit log.
+type Record struct {
+	Time    time.Time `json:"time"`
+	ID      string    `json:"id,omitempty"`
+	User    string    `json:"user,omitempty"`
+	Host    string    `json:"host,omitempty"`
+	Source  string    `json:"source"`
+	Remote  string    `json:"remote,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+	Switch  string    `json:"switch"`
+	Address string    `json:"address,omitempty"`
+	// Command is the action, such as "enable" or "cycle", or "status" for
+	// an audited read.
+	Command  string              `json:"command"`
+	Ports    []int               `json:"ports,omitempty"`
+	Result   string              `json:"result"`
+	Error    string              `json:"error,omitempty"`
+	Duration float64             `json:"duration_ms"`
+	Detail   *session.PortResult `json:"detail,omitempty"`
+	Config   *session.PortConfig `json:"config,omitempty"`
+	Before   []hooks.PortState   `json:"before,omitempty"`
+	After    []hooks.PortState   `json:"after,omitempty"`
+}
+
+// FromEvent converts a hook event into a record.
+func FromEvent(e hooks.Event) Record {
+	return Record{
+		Time:     e.Time,
+		ID:       e.ID,
+		User:     e.Actor.User,
+		Host:     e.Actor.Host,
+		Source:   e.Actor.Source,
+		Remote:   e.Actor.Remote,
+		Reason:   e.Actor.Reason,
+		Switch:   e.Switch,
+		Address:  e.Address,
+		Command:  e.Event,
+		Ports:    e.Ports,
+		Result:   e.Result,
+		Error:    e.Error,
+		Duration: e.Duration,
+		Detail:   e.Detail,
+		Config:   e.Config,
+		Before:   e.Before,
+		After:    e.After,
+	}
+}
+
+// Logger writes records to a file, syslog or both. It is a hooks.Recorder.
+// Write failures are reported through Logf and never fail the change
+// being recorded.
+type Logger struct {
+	Logf func(format string, args ...interface{})
+
+	mu     sync.Mutex
+	file   *os.File
+	syslog io.WriteCloser
+}
+
+// Open opens the audit destinations in cfg. file, when not empty,
+// overrides cfg.File. It returns nil when nothing is configured.
+func Open(cfg *config.Audit, file string) (*Logger, error) {
+	var c config.Audit
+	if cfg != nil {
+		c = *cfg
+	}
+	if file != "" {
+		c.File = file
+	}
+	if c.File == "" && !c.Syslog {
+		return nil, nil
+	}
+
+	l := &Logger{}
+	if c.File != "" {
+		f, err := os.OpenFile(c.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+		if err != nil {
+			return nil, fmt.Errorf("opening audit log: %w", err)
+		}
+		l.file = f
+	}
+	if c.Syslog {
+		tag := c.SyslogTag
+		if tag == "" {
+			tag = "netgear"
+		}
+		w, err := openSyslog(tag)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("connecting to syslog: %w", err)
+		}
+		l.syslog = w
+	}
+	return l, nil
+}
+
+// Record writes the event as an audit record.
+func (l *Logger) Record(e hooks.Event) {
+	l.Write(FromEvent(e))
+}
+
+// Write appends r to every destination.
+func (l *Logger) Write(r Record) {
+	if l == nil {
+		return
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		l.logf("Encoding audit record failed: %v", err)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		// One write per record keeps lines whole when several processes
+		// append to the same file
+		if _, err := l.file.Write(append(line, '\n')); err != nil {
+			l.logf("Writing audit log failed: %v", err)
+		}
+	}
+	if l.syslog != nil {
+		if _, err := l.syslog.Write(line); err != nil {
+			l.logf("Writing audit record to syslog failed: %v", err)
+		}
+	}
+}
+
+// Close closes the destinations.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var err error
+	if l.file != nil {
+		err = l.file.Close()
+		l.file = nil
+	}
+	if l.syslog != nil {
+		if serr := l.syslog.Close(); err == nil {
+			err = serr
+		}
+		l.syslog = nil
+	}
+	return err
+}
+
+func (l *Logger) logf(format string, args ...interface{}) {
+	if l.Logf != nil {
+		l.Logf(format, args...)
+	}
+}
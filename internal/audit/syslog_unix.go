@@ -0,0 +1,12 @@
+//go:build unix
+
+package audit
+
+import (
+	"io"
+	"log/syslog"
+)
+
+func openSyslog(tag string) (io.WriteCloser, error) {
+	return syslog.New(syslog.LOG_NOTICE|syslog.LOG_USER, tag)
+}
@@ -0,0 +1,372 @@
+// Package bridge connects a fleet of switches to an MQTT broker. Each port's
+// PoE state and power draw are published as retained messages, commands
+// on .../set topics enable, disable or cycle the port, and Home Assistant
+// discovery payloads make every port appear as a switch, a power sensor and
+// a power-cycle button.
+//
+// Topics, with the default "netgear" prefix:
+//
+//	netgear/bridge/availability        online | offline (last will)
+//	netgear/<switch>/availability      online | offline
+//	netgear/<switch>/port/<n>/state    ON | OFF
+//	netgear/<switch>/port/<n>/power    watts
+//	netgear/<switch>/port/<n>/status   e.g. "Delivering Power"
+//	netgear/<switch>/port/<n>/set      ON | OFF | CYCLE (subscribed)
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/hooks"
+	"netgearcli/internal/mqtt"
+	"netgearcli/internal/poe"
+	"netgearcli/internal/retry"
+)
+
+// Bridge publishes a fleet's PoE state to MQTT and executes commands.
+type Bridge struct {
+	Fleet *fleet.Fleet
+	MQTT  mqtt.Options
+	// Prefix is the topic root. Defaults to "netgear".
+	Prefix string
+	// DiscoveryPrefix is Home Assistant's discovery root; "-" disables
+	// discovery. Defaults to "homeassistant".
+	DiscoveryPrefix string
+	// Interval is how often state is republished. Defaults to 30s.
+	Interval time.Duration
+	// Timeout bounds one poll or command. Defaults to 30s.
+	Timeout time.Duration
+	Logf    func(format string, args ...interface{})
+
+	mu     sync.Mutex
+	client *mqtt.Client
+	// announced records the ports whose discovery payloads were sent on
+	// the current connection
+	announced map[string]bool
+}
+
+// Run connects to the broker and bridges until ctx is done, reconnecting
+// with backoff when the connection drops.
+func (b *Bridge) Run(ctx context.Context) error {
+	b.setDefaults()
+	backoff := retry.Policy{InitialDelay: time.Second, MaxDelay: time.Minute, Multiplier: 2, Jitter: 0.2}
+
+	for attempt := 1; ; attempt++ {
+		err := b.session(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err == errConnected {
+			attempt = 1
+		}
+		delay := backoff.Delay(attempt)
+		b.logf("MQTT connection to %s lost: %v; reconnecting in %s", b.MQTT.Broker, err, delay.Round(time.Millisecond))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
+
+// errConnected marks a connection that was established before it dropped,
+// so the reconnect backoff starts over
+var errConnected = fmt.Errorf("connection closed")
+
+func (b *Bridge) setDefaults() {
+	if b.Prefix == "" {
+		b.Prefix = "netgear"
+	}
+	if b.DiscoveryPrefix == "" {
+		b.DiscoveryPrefix = "homeassistant"
+	}
+	if b.Interval <= 0 {
+		b.Interval = 30 * time.Second
+	}
+	if b.Timeout <= 0 {
+		b.Timeout = 30 * time.Second
+	}
+	b.MQTT.Will = &mqtt.Message{Topic: b.bridgeTopic(), Payload: []byte("offline"), Retain: true}
+}
+
+// session runs one broker connection until it drops or ctx is done
+func (b *Bridge) session(ctx context.Context) error {
+	dialCtx, cancel := context.WithTimeout(ctx, b.Timeout)
+	client, err := mqtt.Dial(dialCtx, b.MQTT)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	b.logf("Connected to MQTT broker %s", b.MQTT.Broker)
+
+	b.mu.Lock()
+	b.client = client
+	b.announced = make(map[string]bool)
+	b.mu.Unlock()
+
+	if err := client.Subscribe(b.Prefix + "/+/port/+/set"); err != nil {
+		return err
+	}
+	if err := client.Publish(b.bridgeTopic(), []byte("online"), true); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	pollAll := func() {
+		for _, m := range b.Fleet.Members() {
+			wg.Add(1)
+			go func(m *fleet.Member) {
+				defer wg.Done()
+				b.poll(ctx, m)
+			}(m)
+		}
+	}
+	pollAll()
+
+	ticker := time.NewTicker(b.Interval)
+	defer ticker.Stop()
+	messages := client.Messages()
+	for {
+		select {
+		case <-ctx.Done():
+			// Leave a retained "offline" behind; Close skips the will
+			client.Publish(b.bridgeTopic(), []byte("offline"), true)
+			return nil
+		case <-client.Done():
+			if err := client.Err(); err != nil && err != mqtt.ErrClosed {
+				return err
+			}
+			return errConnected
+		case <-ticker.C:
+			pollAll()
+		case msg, ok := <-messages:
+			if !ok {
+				messages = nil
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				b.handle(ctx, msg)
+			}()
+		}
+	}
+}
+
+// poll reads one switch and publishes its state
+func (b *Bridge) poll(ctx context.Context, m *fleet.Member) {
+	ctx, cancel := context.WithTimeout(ctx, b.Timeout)
+	defer cancel()
+
+	var statuses []poe.PortStatus
+	var settings []poe.PortSettings
+	err := m.Locked(ctx, func(ctx context.Context) error {
+		var err error
+		if settings, err = m.Session.Settings(ctx); err != nil {
+			return err
+		}
+		statuses, err = m.Session.Status(ctx)
+		return err
+	})
+	if err != nil {
+		if ctx.Err() == nil || ctx.Err() == context.DeadlineExceeded {
+			b.logf("Polling %s failed: %v", m.Config.Name, err)
+			b.publish(b.switchTopic(m.Config.Name, "availability"), "offline")
+		}
+		return
+	}
+
+	name := m.Config.Name
+	b.publish(b.switchTopic(name, "availability"), "online")
+	power := make(map[int]poe.PortStatus)
+	for _, s := range statuses {
+		power[s.Port] = s
+	}
+	for _, s := range settings {
+		b.announce(m, s.Port, s.Name)
+		state := "OFF"
+		if s.Enabled() {
+			state = "ON"
+		}
+		b.publish(b.portTopic(name, s.Port, "state"), state)
+		if st, ok := power[s.Port]; ok {
+			b.publish(b.portTopic(name, s.Port, "power"), strconv.FormatFloat(st.Power, 'f', -1, 64))
+			b.publish(b.portTopic(name, s.Port, "status"), st.Status)
+		}
+	}
+}
+
+// handle executes a command received on a .../set topic
+func (b *Bridge) handle(ctx context.Context, msg mqtt.Message) {
+	// <prefix>/<switch>/port/<n>/set
+	parts := strings.Split(strings.TrimPrefix(msg.Topic, b.Prefix+"/"), "/")
+	if len(parts) != 4 || parts[1] != "port" || parts[3] != "set" {
+		return
+	}
+	// A retained command would be replayed on every reconnect and restart,
+	// turning the port off or cycling it each time
+	if msg.Retain {
+		b.logf("Ignoring retained command on %s; publish commands without the retain flag", msg.Topic)
+		return
+	}
+	m, ok := b.Fleet.Get(parts[0])
+	if !ok {
+		b.logf("Ignoring command for unknown switch %s", parts[0])
+		return
+	}
+	port, err := strconv.Atoi(parts[2])
+	if err != nil || port < 1 {
+		b.logf("Ignoring command for invalid port %q on %s", parts[2], parts[0])
+		return
+	}
+	command := strings.ToUpper(strings.TrimSpace(string(msg.Payload)))
+
+	action, ok := map[string]string{"ON": hooks.EventEnable, "OFF": hooks.EventDisable, "CYCLE": hooks.EventCycle}[command]
+	if !ok {
+		b.logf("Ignoring unknown command %q on %s (want ON, OFF or CYCLE)", command, msg.Topic)
+		return
+	}
+
+	cmdCtx, cancel := context.WithTimeout(ctx, b.Timeout)
+	defer cancel()
+	actor := hooks.CurrentActor("mqtt")
+	actor.Reason = msg.Topic
+	if _, err := m.Change(cmdCtx, action, []int{port}, actor); err != nil {
+		b.logf("MQTT %s on %s port %d failed: %v", command, m.Config.Name, port, err)
+	} else {
+		b.logf("MQTT %s on %s port %d", command, m.Config.Name, port)
+	}
+
+	// Publish the resulting state, or correct an optimistic UI
+	b.poll(ctx, m)
+}
+
+// announce publishes Home Assistant discovery for a port once per connection
+func (b *Bridge) announce(m *fleet.Member, port int, label string) {
+	if b.DiscoveryPrefix == "-" {
+		return
+	}
+	name := m.Config.Name
+	key := fmt.Sprintf("%s/%d", name, port)
+	b.mu.Lock()
+	done := b.announced[key]
+	b.announced[key] = true
+	b.mu.Unlock()
+	if done {
+		return
+	}
+
+	id := fmt.Sprintf("netgear_%s_port%d", sanitize(name), port)
+	title := fmt.Sprintf("Port %d", port)
+	if label != "" {
+		title = fmt.Sprintf("Port %d %s", port, label)
+	}
+	device := map[string]interface{}{
+		"identifiers":  []string{"netgear_" + sanitize(name)},
+		"name":         name,
+		"manufacturer": "Netgear",
+	}
+	availability := []map[string]string{
+		{"topic": b.bridgeTopic()},
+		{"topic": b.switchTopic(name, "availability")},
+	}
+	setTopic := b.portTopic(name, port, "set")
+
+	b.discover("switch", id, map[string]interface{}{
+		"name":              title + " PoE",
+		"unique_id":         id,
+		"object_id":         id,
+		"state_topic":       b.portTopic(name, port, "state"),
+		"command_topic":     setTopic,
+		"payload_on":        "ON",
+		"payload_off":       "OFF",
+		"icon":              "mdi:ethernet",
+		"availability":      availability,
+		"availability_mode": "all",
+		"device":            device,
+	})
+	b.discover("sensor", id+"_power", map[string]interface{}{
+		"name":                title + " power",
+		"unique_id":           id + "_power",
+		"object_id":           id + "_power",
+		"state_topic":         b.portTopic(name, port, "power"),
+		"device_class":        "power",
+		"state_class":         "measurement",
+		"unit_of_measurement": "W",
+		"availability":        availability,
+		"availability_mode":   "all",
+		"device":              device,
+	})
+	b.discover("button", id+"_cycle", map[string]interface{}{
+		"name":              title + " power cycle",
+		"unique_id":         id + "_cycle",
+		"object_id":         id + "_cycle",
+		"command_topic":     setTopic,
+		"payload_press":     "CYCLE",
+		"device_class":      "restart",
+		"availability":      availability,
+		"availability_mode": "all",
+		"device":            device,
+	})
+}
+
+func (b *Bridge) discover(component, id string, payload map[string]interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	b.publish(fmt.Sprintf("%s/%s/%s/config", b.DiscoveryPrefix, component, id), string(data))
+}
+
+// publish sends a retained message on the current connection
+func (b *Bridge) publish(topic, payload string) {
+	b.mu.Lock()
+	client := b.client
+	b.mu.Unlock()
+	if client == nil {
+		return
+	}
+	if err := client.Publish(topic, []byte(payload), true); err != nil {
+		b.logf("Publishing %s failed: %v", topic, err)
+	}
+}
+
+func (b *Bridge) bridgeTopic() string {
+	return b.Prefix + "/bridge/availability"
+}
+
+func (b *Bridge) switchTopic(name, leaf string) string {
+	return b.Prefix + "/" + name + "/" + leaf
+}
+
+func (b *Bridge) portTopic(name string, port int, leaf string) string {
+	return fmt.Sprintf("%s/%s/port/%d/%s", b.Prefix, name, port, leaf)
+}
+
+func (b *Bridge) logf(format string, args ...interface{}) {
+	if b.Logf != nil {
+		b.Logf(format, args...)
+	}
+}
+
+// sanitize makes a switch name safe for Home Assistant IDs
+func sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,201 @@
+package bridge
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"netgearcli/internal/config"
+	"netgearcli/internal/fleet"
+)
+
+// brokerConn is one accepted connection of a fake broker.
+type brokerConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// next reads one packet and returns its type and body.
+func (c *brokerConn) next(t *testing.T) (byte, []byte) {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	header, err := c.r.ReadByte()
+	if err != nil {
+		t.Fatalf("broker read: %v", err)
+	}
+	length, multiplier := 0, 1
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			t.Fatalf("broker read: %v", err)
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		t.Fatalf("broker read: %v", err)
+	}
+	return header >> 4, body
+}
+
+func (c *brokerConn) expect(t *testing.T, typ byte) []byte {
+	t.Helper()
+	got, body := c.next(t)
+	if got != typ {
+		t.Fatalf("got packet type %d, want %d", got, typ)
+	}
+	return body
+}
+
+func (c *brokerConn) send(t *testing.T, header byte, body ...byte) {
+	t.Helper()
+	if _, err := c.Write(append([]byte{header, byte(len(body))}, body...)); err != nil {
+		t.Fatalf("broker write: %v", err)
+	}
+}
+
+func accept(t *testing.T, l net.Listener) *brokerConn {
+	t.Helper()
+	l.(*net.TCPListener).SetDeadline(time.Now().Add(5 * time.Second))
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &brokerConn{Conn: conn, r: bufio.NewReader(conn)}
+}
+
+func readString(t *testing.T, b []byte) (string, []byte) {
+	t.Helper()
+	if len(b) < 2 || len(b) < 2+int(binary.BigEndian.Uint16(b)) {
+		t.Fatalf("short string in % x", b)
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	return string(b[2 : 2+n]), b[2+n:]
+}
+
+// handshake plays the broker side of a new bridge connection up to the
+// "online" announcement.
+func handshake(t *testing.T, c *brokerConn) {
+	t.Helper()
+	body := c.expect(t, 1) // CONNECT
+	rest := body[10:]
+	_, rest = readString(t, rest) // client ID
+	will, rest := readString(t, rest)
+	payload, _ := readString(t, rest)
+	if will != "netgear/bridge/availability" || payload != "offline" {
+		t.Errorf("will = %s %q, want netgear/bridge/availability offline", will, payload)
+	}
+	c.send(t, 2<<4, 0, 0) // CONNACK
+
+	body = c.expect(t, 8) // SUBSCRIBE
+	if filter, _ := readString(t, body[2:]); filter != "netgear/+/port/+/set" {
+		t.Errorf("subscribed to %q", filter)
+	}
+	c.send(t, 9<<4, body[0], body[1], 0) // SUBACK
+
+	body = c.expect(t, 3) // PUBLISH
+	topic, payloadBytes := readString(t, body)
+	if topic != "netgear/bridge/availability" || string(payloadBytes) != "online" {
+		t.Errorf("published %s %q, want availability online", topic, payloadBytes)
+	}
+}
+
+func TestRunReconnects(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	b := &Bridge{Fleet: &fleet.Fleet{}, Interval: time.Hour, Timeout: 5 * time.Second}
+	b.MQTT.Broker = "tcp://" + l.Addr().String()
+	b.MQTT.ClientID = "netgear-test"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx) }()
+
+	first := accept(t, l)
+	handshake(t, first)
+	// The broker drops the connection; the bridge comes back after the
+	// first backoff delay and announces itself again
+	first.Close()
+	second := accept(t, l)
+	handshake(t, second)
+
+	// On shutdown the bridge leaves "offline" behind and disconnects
+	// cleanly so the broker does not publish the will
+	cancel()
+	body := second.expect(t, 3)
+	if topic, payload := readString(t, body); topic != "netgear/bridge/availability" || string(payload) != "offline" {
+		t.Errorf("published %s %q on shutdown", topic, payload)
+	}
+	second.expect(t, 14) // DISCONNECT
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
+
+func TestRetainedCommandsAreIgnored(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	f, err := fleet.New(&config.Config{Switches: []config.Switch{{Name: "sw1", Address: "127.0.0.1:1"}}}, fleet.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	logs := make(chan string, 16)
+	b := &Bridge{Fleet: f, Interval: time.Hour, Timeout: 5 * time.Second, DiscoveryPrefix: "-"}
+	b.MQTT.Broker = "tcp://" + l.Addr().String()
+	b.MQTT.ClientID = "netgear-test"
+	b.Logf = func(format string, args ...interface{}) { logs <- fmt.Sprintf(format, args...) }
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	c := accept(t, l)
+	handshake(t, c)
+	// A retained OFF, as left by mosquitto_pub -r, arrives on subscribe
+	topic := "netgear/sw1/port/1/set"
+	body := append([]byte{0, byte(len(topic))}, topic...)
+	c.send(t, 3<<4|0x01, append(body, "OFF"...)...)
+
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case line := <-logs:
+			if strings.Contains(line, "MQTT OFF") {
+				t.Fatalf("retained command was executed: %s", line)
+			}
+			if strings.Contains(line, "Ignoring retained command on "+topic) {
+				return
+			}
+		case <-deadline:
+			t.Fatal("retained command was not reported as ignored")
+		}
+	}
+}
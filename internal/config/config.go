@@ -0,0 +1,455 @@
+// Package config loads the optional netgearcli configuration file, which
+// describes the switches the tools manage and how to reach them.
+//
+// The file is JSON and lives at $XDG_CONFIG_HOME/netgear/config.json
+// (~/.config/netgear/config.json) unless NETGEAR_CONFIG or a --config flag
+// points elsewhere. All sections are optional; a missing default file is
+// treated as an empty configuration.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Config is the top-level configuration file.
+type Config struct {
+	Switches []Switch  `json:"switches"`
+	Vault    *Vault    `json:"vault,omitempty"`
+	Retry    *Retry    `json:"retry,omitempty"`
+	Serve    *Serve    `json:"serve,omitempty"`
+	Exporter *Exporter `json:"exporter,omitempty"`
+	MQTT     *MQTT     `json:"mqtt,omitempty"`
+	Schedule *Schedule `json:"schedule,omitempty"`
+	Watchdog *Watchdog `json:"watchdog,omitempty"`
+	Monitor  *Monitor  `json:"monitor,omitempty"`
+	Hooks    []Hook    `json:"hooks,omitempty"`
+	Audit    *Audit    `json:"audit,omitempty"`
+	Recorder *Recorder `json:"recorder,omitempty"`
+	Report   *Report   `json:"report,omitempty"`
+	Drift    *Drift    `json:"drift,omitempty"`
+}
+
+// Switch describes one managed switch.
+type Switch struct {
+	// Name is what users type on the command line, e.g. "tswitch16".
+	Name string `json:"name"`
+	// Address is the hostname or IP used to connect. Defaults to Name.
+	Address string `json:"address,omitempty"`
+
+	// Credentials lists credential sources in the order they are tried:
+	// "stdin", "command", "pass", "vault", "file", "env", "netrc". When empty the
+	// default order is used.
+	Credentials []string `json:"credentials,omitempty"`
+	// PasswordCommand is run through the shell; the first line of its
+	// output is the password, e.g. "pass show netgear/tswitch16".
+	PasswordCommand string `json:"password_command,omitempty"`
+	// PassEntry is the pass(1) entry to read. Defaults to "netgear/<name>".
+	PassEntry string `json:"pass_entry,omitempty"`
+	// PasswordFile is a file holding only the password, such as a Docker
+	// or Kubernetes secret mount.
+	PasswordFile string `json:"password_file,omitempty"`
+	// VaultPath overrides Vault.Path for this switch.
+	VaultPath string `json:"vault_path,omitempty"`
+
+	// Model is the switch model, e.g. "GS316EPP". It is normally learned at
+	// login; set it to pick the PoE budget before the first login.
+	Model string `json:"model,omitempty"`
+	// PoEBudget is the switch's total PoE power budget in watts. It
+	// overrides the budget of the model.
+	PoEBudget float64 `json:"poe_budget_w,omitempty"`
+}
+
+// Vault configures the Vault-compatible KV v2 secret backend. Address,
+// token, namespace and AppRole credentials fall back to the standard
+// VAULT_ADDR, VAULT_TOKEN, VAULT_NAMESPACE, VAULT_ROLE_ID and
+// VAULT_SECRET_ID environment variables.
+type Vault struct {
+	Address   string `json:"address,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+
+	// TokenFile holds a Vault token. Defaults to ~/.vault-token when no
+	// token or AppRole credentials are set.
+	TokenFile string `json:"token_file,omitempty"`
+
+	// RoleID and SecretID enable AppRole login. SecretIDFile may be used
+	// instead of SecretID so the secret stays out of the config file.
+	RoleID       string `json:"role_id,omitempty"`
+	SecretID     string `json:"secret_id,omitempty"`
+	SecretIDFile string `json:"secret_id_file,omitempty"`
+	// AppRolePath is the auth mount for AppRole. Defaults to "approle".
+	AppRolePath string `json:"approle_path,omitempty"`
+
+	// Path is the secret location including the KV v2 mount, with {host}
+	// replaced by the switch name. Defaults to "secret/netgear/{host}".
+	Path string `json:"path,omitempty"`
+	// Field is the key within the secret holding the password.
+	// Defaults to "password".
+	Field string `json:"field,omitempty"`
+}
+
+// Retry overrides fields of the default retry policy. Unset fields keep
+// their defaults; a field set to zero is applied, so "jitter": 0 turns
+// jitter off and "max_elapsed": "0s" removes the time limit.
+type Retry struct {
+	MaxAttempts  *int      `json:"max_attempts,omitempty"`
+	InitialDelay *Duration `json:"initial_delay,omitempty"`
+	MaxDelay     *Duration `json:"max_delay,omitempty"`
+	Multiplier   *float64  `json:"multiplier,omitempty"`
+	Jitter       *float64  `json:"jitter,omitempty"`
+	MaxElapsed   *Duration `json:"max_elapsed,omitempty"`
+}
+
+// Serve configures the "netgear serve" REST API.
+type Serve struct {
+	// Listen is the address to listen on. Defaults to "127.0.0.1:8080".
+	Listen string `json:"listen,omitempty"`
+	// APIToken, if set, must be sent as a bearer token on every request
+	// except /healthz. APITokenFile may be used instead to keep it out of
+	// the config file.
+	APIToken     string `json:"api_token,omitempty"`
+	APITokenFile string `json:"api_token_file,omitempty"`
+	// RequestTimeout bounds each API request. Defaults to 30s.
+	RequestTimeout Duration `json:"request_timeout,omitempty"`
+	// LockTimeout bounds how long a request waits for another process
+	// using the same switch. Defaults to 10s.
+	LockTimeout Duration `json:"lock_timeout,omitempty"`
+}
+
+// Exporter configures the "netgear exporter" Prometheus endpoint.
+type Exporter struct {
+	// Listen is the address serving /metrics. Defaults to ":9731".
+	Listen string `json:"listen,omitempty"`
+	// Interval is how often each switch is polled. Defaults to 30s.
+	Interval Duration `json:"interval,omitempty"`
+	// Timeout bounds one poll of one switch. Defaults to Interval.
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+// MQTT configures the "netgear mqtt" bridge.
+type MQTT struct {
+	// Broker is a URL such as "tcp://broker:1883" or "tls://broker:8883".
+	Broker   string `json:"broker"`
+	ClientID string `json:"client_id,omitempty"`
+	Username string `json:"username,omitempty"`
+	// Password may be given in PasswordFile instead to keep it out of the
+	// config file.
+	Password     string `json:"password,omitempty"`
+	PasswordFile string `json:"password_file,omitempty"`
+	// TopicPrefix is the topic root. Defaults to "netgear".
+	TopicPrefix string `json:"topic_prefix,omitempty"`
+	// DiscoveryPrefix is Home Assistant's discovery root. Defaults to
+	// "homeassistant"; "-" disables discovery.
+	DiscoveryPrefix string `json:"discovery_prefix,omitempty"`
+	// Interval is how often port state is republished. Defaults to 30s.
+	Interval Duration `json:"interval,omitempty"`
+}
+
+// Schedule configures timed PoE actions run by "netgear serve" and
+// "netgear schedule".
+type Schedule struct {
+	// Timezone applies to rules without their own, e.g. "Europe/Berlin".
+	// Defaults to the local timezone.
+	Timezone string `json:"timezone,omitempty"`
+	// StateFile records when each rule last ran, so runs missed while the
+	// daemon was down can be caught up. Defaults to a file in the user
+	// cache directory.
+	StateFile string `json:"state_file,omitempty"`
+	// CatchUp is how old a missed run may be and still be executed after
+	// a restart. Defaults to 24h.
+	CatchUp Duration `json:"catch_up,omitempty"`
+	// SkipMissed discards runs missed while the daemon was down.
+	SkipMissed bool           `json:"skip_missed,omitempty"`
+	Rules      []ScheduleRule `json:"rules"`
+}
+
+// ScheduleRule is either a one-line rule such as
+// "tswitch1 ports 1-8 disable at 22:00 Mon-Fri, enable at 06:30", held in
+// Text, or the same rule as an object.
+type ScheduleRule struct {
+	Text string `json:"-"`
+
+	Name     string           `json:"name,omitempty"`
+	Switch   string           `json:"switch,omitempty"`
+	Ports    string           `json:"ports,omitempty"`
+	Timezone string           `json:"timezone,omitempty"`
+	Actions  []ScheduleAction `json:"actions,omitempty"`
+}
+
+// ScheduleAction is one timed action of a rule.
+type ScheduleAction struct {
+	// Action is "enable", "disable" or "cycle".
+	Action string `json:"action"`
+	// At is the time of day, "HH:MM".
+	At string `json:"at"`
+	// Days such as "Mon-Fri", "Sat,Sun", "weekdays" or "daily". Defaults
+	// to every day.
+	Days string `json:"days,omitempty"`
+}
+
+func (r *ScheduleRule) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &r.Text); err == nil {
+		return nil
+	}
+	type plain ScheduleRule
+	return json.Unmarshal(data, (*plain)(r))
+}
+
+// Watchdog configures "netgear watchdog", which power cycles ports whose
+// devices stop responding. Target fields left unset use these defaults.
+type Watchdog struct {
+	// Interval between checks. Defaults to 30s.
+	Interval Duration `json:"interval,omitempty"`
+	// Timeout for one check. Defaults to 5s.
+	Timeout Duration `json:"timeout,omitempty"`
+	// Failures is how many consecutive failed checks trigger a cycle.
+	// Defaults to 3.
+	Failures int `json:"failures,omitempty"`
+	// BootGrace is how long to wait after a cycle before checking again,
+	// while the device boots. Defaults to 2m.
+	BootGrace Duration `json:"boot_grace,omitempty"`
+	// Cooldown is the minimum time between two cycles of the same port.
+	// Defaults to 10m.
+	Cooldown Duration `json:"cooldown,omitempty"`
+	// MaxCyclesPerHour stops cycling a port that keeps failing. Defaults
+	// to 3.
+	MaxCyclesPerHour int              `json:"max_cycles_per_hour,omitempty"`
+	Targets          []WatchdogTarget `json:"targets"`
+}
+
+// WatchdogTarget is a device powered by one switch port.
+type WatchdogTarget struct {
+	Name   string `json:"name,omitempty"`
+	Switch string `json:"switch"`
+	Port   int    `json:"port"`
+	// Check is "tcp://host:port", "icmp://host" or an http(s) URL that
+	// must answer with a 2xx or 3xx status.
+	Check            string   `json:"check"`
+	Interval         Duration `json:"interval,omitempty"`
+	Timeout          Duration `json:"timeout,omitempty"`
+	Failures         int      `json:"failures,omitempty"`
+	BootGrace        Duration `json:"boot_grace,omitempty"`
+	Cooldown         Duration `json:"cooldown,omitempty"`
+	MaxCyclesPerHour int      `json:"max_cycles_per_hour,omitempty"`
+}
+
+// Monitor configures "netgear monitor", which alerts on unusual power draw
+// and port status changes.
+type Monitor struct {
+	// Interval between polls. Defaults to 30s.
+	Interval Duration `json:"interval,omitempty"`
+	// Window is how many recent samples make up a port's baseline.
+	// Defaults to 20.
+	Window int `json:"window,omitempty"`
+	// MinSamples is how many samples a baseline needs before delta
+	// alerts fire. Defaults to 5.
+	MinSamples int `json:"min_samples,omitempty"`
+	// Thresholds apply to every port without a more specific entry in
+	// Ports.
+	MonitorThresholds
+	Ports  []MonitorPorts `json:"ports,omitempty"`
+	Alerts []AlertSink    `json:"alerts,omitempty"`
+}
+
+// MonitorThresholds are the limits a port's power draw is checked
+// against. Zero values are not checked.
+type MonitorThresholds struct {
+	// MinWatts and MaxWatts are absolute limits while delivering power.
+	MinWatts float64 `json:"min_watts,omitempty"`
+	MaxWatts float64 `json:"max_watts,omitempty"`
+	// DeltaWatts and DeltaPercent alert when a sample differs from the
+	// baseline by more than both. Defaults are 2W and 50%.
+	DeltaWatts   float64 `json:"delta_watts,omitempty"`
+	DeltaPercent float64 `json:"delta_percent,omitempty"`
+}
+
+// MonitorPorts overrides thresholds for some ports of one switch.
+type MonitorPorts struct {
+	Switch string `json:"switch"`
+	// Ports such as "1-4,7". Empty means every port.
+	Ports string `json:"ports,omitempty"`
+	MonitorThresholds
+}
+
+// AlertSink is where alerts are sent.
+type AlertSink struct {
+	// Type is "stderr", "webhook" or "exec".
+	Type string `json:"type"`
+	// URL receives a JSON POST for webhooks.
+	URL string `json:"url,omitempty"`
+	// Command is run through the shell with the alert JSON on stdin.
+	Command string `json:"command,omitempty"`
+}
+
+// Hook is a webhook or command run after PoE changes.
+type Hook struct {
+	// Events limits the hook to some of "enable", "disable", "cycle" and
+	// "status_change". Empty means all of them.
+	Events []string `json:"events,omitempty"`
+	// URL receives the event as a JSON POST.
+	URL string `json:"url,omitempty"`
+	// Secret signs webhook bodies with HMAC-SHA256. SecretFile may be used
+	// instead to keep it out of the config file.
+	Secret     string `json:"secret,omitempty"`
+	SecretFile string `json:"secret_file,omitempty"`
+	// Command is run through the shell with the event JSON on stdin.
+	Command string `json:"command,omitempty"`
+	// Timeout bounds one delivery attempt. Defaults to 10s.
+	Timeout Duration `json:"timeout,omitempty"`
+	// Retries is how many times a failed delivery is retried. Defaults
+	// to 3.
+	Retries *int `json:"retries,omitempty"`
+}
+
+// Audit configures the audit log of PoE changes.
+type Audit struct {
+	// File receives one JSON record per line. It is appended to and
+	// created with mode 0640.
+	File string `json:"file,omitempty"`
+	// Syslog also sends each record to the local syslog daemon.
+	Syslog bool `json:"syslog,omitempty"`
+	// SyslogTag defaults to "netgear".
+	SyslogTag string `json:"syslog_tag,omitempty"`
+	// Reads also records status and settings reads made by poe-management.
+	Reads bool `json:"reads,omitempty"`
+}
+
+// Recorder configures "netgear record", which samples PoE draw into
+// local history for "netgear history".
+type Recorder struct {
+	// Dir holds one CSV file per month. Defaults to
+	// ~/.local/share/netgear/history.
+	Dir string `json:"dir,omitempty"`
+	// Interval between samples. Defaults to 1m.
+	Interval Duration `json:"interval,omitempty"`
+	// Timeout bounds one poll of one switch. Defaults to the interval.
+	Timeout Duration `json:"timeout,omitempty"`
+	// Retention deletes month files once they are this old, e.g. "8760h".
+	// Zero keeps everything.
+	Retention Duration `json:"retention,omitempty"`
+}
+
+// Report configures "netgear report energy", which charges recorded PoE
+// energy back to teams.
+type Report struct {
+	// PricePerKWh is the cost of one kWh. Zero leaves costs out.
+	PricePerKWh float64 `json:"price_per_kwh,omitempty"`
+	// Currency is printed with costs, e.g. "EUR".
+	Currency string `json:"currency,omitempty"`
+	// Teams tags ports with the team they are charged to. The first
+	// matching entry wins; other ports are "unassigned".
+	Teams []ReportTeam `json:"teams,omitempty"`
+}
+
+// ReportTeam assigns ports to a team. A port matches when every field that
+// is set matches.
+type ReportTeam struct {
+	Team string `json:"team"`
+	// Switch limits the entry to one switch.
+	Switch string `json:"switch,omitempty"`
+	// Ports such as "1-4,7".
+	Ports string `json:"ports,omitempty"`
+	// Labels are shell patterns matched against port labels, e.g. "cam-*".
+	Labels []string `json:"labels,omitempty"`
+}
+
+// Drift configures "netgear drift", which compares PoE settings with a
+// baseline saved by "netgear snapshot".
+type Drift struct {
+	// Baseline is the snapshot file to compare against.
+	Baseline string `json:"baseline"`
+	// Interval between checks by "netgear drift watch" and serve.
+	// Defaults to 5m.
+	Interval Duration `json:"interval,omitempty"`
+	// Remediate puts drifted admin states, priorities, modes, limits and
+	// detection types back to the baseline. Drifted labels are only
+	// reported.
+	Remediate bool        `json:"remediate,omitempty"`
+	Alerts    []AlertSink `json:"alerts,omitempty"`
+}
+
+// Duration is a time.Duration written as a string such as "500ms" or "2m".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"500ms\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// DefaultPath returns the configuration file location, honouring
+// NETGEAR_CONFIG and XDG_CONFIG_HOME.
+func DefaultPath() string {
+	if path := os.Getenv("NETGEAR_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "netgear", "config.json")
+}
+
+// Load reads the configuration file at path. An empty path loads the
+// default location, where a missing file is not an error.
+func Load(path string) (*Config, error) {
+	explicit := path != ""
+	if !explicit {
+		path = DefaultPath()
+	}
+	if path == "" {
+		return &Config{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !explicit && errors.Is(err, fs.ErrNotExist) {
+			return &Config{}, nil
+		}
+		return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+
+	cfg := &Config{}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	for i := range cfg.Switches {
+		sw := &cfg.Switches[i]
+		if sw.Name == "" {
+			return nil, fmt.Errorf("config %s: switch %d has no name", path, i+1)
+		}
+		if sw.Address == "" {
+			sw.Address = sw.Name
+		}
+	}
+	return cfg, nil
+}
+
+// Lookup returns the switch configured under name (or with that address).
+// Unknown switches get a zero entry whose Name and Address are both name,
+// so callers can always treat the result as usable.
+func (c *Config) Lookup(name string) Switch {
+	for _, sw := range c.Switches {
+		if sw.Name == name || sw.Address == name {
+			return sw
+		}
+	}
+	return Switch{Name: name, Address: name}
+}
@@ -0,0 +1,64 @@
+package credentials
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"netgearcli/internal/config"
+)
+
+// Command runs a shell command (password_command) and uses the first line
+// of its output as the password.
+type Command struct {
+	Line string
+}
+
+func (c *Command) Name() string { return "command" }
+
+func (c *Command) Password(sw config.Switch) (string, error) {
+	return firstLine(exec.Command("sh", "-c", c.Line))
+}
+
+// Pass reads the password from the pass(1) password store. The first line
+// of an entry is the password, following the pass convention.
+type Pass struct {
+	// Entry is the store path. Defaults to "netgear/<name>".
+	Entry string
+}
+
+func (p *Pass) Name() string { return "pass" }
+
+func (p *Pass) Password(sw config.Switch) (string, error) {
+	entry := p.Entry
+	if entry == "" {
+		entry = "netgear/" + sw.Name
+	}
+	return firstLine(exec.Command("pass", "show", entry))
+}
+
+// firstLine runs cmd and returns the first line of its standard output.
+// Standard error is passed through so gpg/pinentry prompts stay visible.
+func firstLine(cmd *exec.Cmd) (string, error) {
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", fmt.Errorf("%s exited with status %d", cmd.Args[0], exitErr.ExitCode())
+		}
+		return "", fmt.Errorf("failed to run %s: %w", cmd.Args[0], err)
+	}
+
+	line, _, _ := strings.Cut(stdout.String(), "\n")
+	line = strings.TrimRight(line, "\r")
+	if line == "" {
+		return "", fmt.Errorf("%s printed an empty password", cmd.Args[0])
+	}
+	return line, nil
+}
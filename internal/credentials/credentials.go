@@ -0,0 +1,130 @@
+// Package credentials resolves switch admin passwords from pluggable
+// sources so they never have to appear on the command line or in the
+// process environment.
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"netgearcli/internal/config"
+)
+
+// ErrNotFound is returned by a Provider that has no password for a switch.
+// Resolve moves on to the next provider when it sees it.
+var ErrNotFound = errors.New("no password found")
+
+// Logf receives debug output. A nil Logf discards it.
+type Logf func(format string, args ...interface{})
+
+func (l Logf) printf(format string, args ...interface{}) {
+	if l != nil {
+		l(format, args...)
+	}
+}
+
+// Provider is a single credential source.
+type Provider interface {
+	// Name identifies the source in debug output and errors.
+	Name() string
+	// Password returns the password for sw, or ErrNotFound.
+	Password(sw config.Switch) (string, error)
+}
+
+// Options controls how ForSwitch builds a provider chain.
+type Options struct {
+	// Stdin, when non-nil, is read for a password (--password-stdin).
+	Stdin io.Reader
+	// Vault configures the vault source. When nil the source is only used
+	// if VAULT_ADDR is set.
+	Vault *config.Vault
+	// NetrcPath overrides the netrc location. Defaults to $NETRC or ~/.netrc.
+	NetrcPath string
+	// Debugf receives debug output from providers.
+	Debugf Logf
+}
+
+// DefaultOrder is the source order used when a switch does not list its own.
+var DefaultOrder = []string{"stdin", "command", "pass", "vault", "file", "env", "netrc"}
+
+// ForSwitch returns the providers to consult for sw, in order. Sources that
+// are not configured for the switch are skipped.
+func ForSwitch(sw config.Switch, opts Options) ([]Provider, error) {
+	order := sw.Credentials
+	explicit := len(order) > 0
+	if !explicit {
+		order = DefaultOrder
+	}
+
+	var providers []Provider
+	for _, source := range order {
+		switch source {
+		case "stdin":
+			if opts.Stdin != nil {
+				providers = append(providers, &Stdin{Reader: opts.Stdin})
+			}
+		case "command":
+			if sw.PasswordCommand != "" {
+				providers = append(providers, &Command{Line: sw.PasswordCommand})
+			} else if explicit {
+				return nil, fmt.Errorf("switch %s lists the command source but has no password_command", sw.Name)
+			}
+		case "pass":
+			// pass is only tried by default when an entry is configured;
+			// listing it explicitly falls back to netgear/<name>.
+			if sw.PassEntry != "" || explicit {
+				providers = append(providers, &Pass{Entry: sw.PassEntry})
+			}
+		case "vault":
+			// Only consult Vault by default when it has been set up, so
+			// hosts without Vault keep the old behaviour.
+			if opts.Vault != nil || os.Getenv("VAULT_ADDR") != "" || explicit {
+				vault := &Vault{Implicit: opts.Vault == nil && !explicit, Debugf: opts.Debugf}
+				if opts.Vault != nil {
+					vault.Config = *opts.Vault
+				}
+				providers = append(providers, vault)
+			}
+		case "file":
+			providers = append(providers, &File{Path: sw.PasswordFile, Debugf: opts.Debugf})
+		case "env":
+			providers = append(providers, &Env{Debugf: opts.Debugf})
+		case "netrc":
+			providers = append(providers, &Netrc{Path: opts.NetrcPath})
+		default:
+			return nil, fmt.Errorf("switch %s: unknown credential source %q", sw.Name, source)
+		}
+	}
+	return providers, nil
+}
+
+// Resolve asks each provider in turn and returns the first password found.
+// It returns ErrNotFound when no provider has one; any other provider error
+// stops the search, since a broken password_command should not silently
+// fall through to a different password.
+func Resolve(sw config.Switch, providers []Provider, debugf Logf) (string, error) {
+	for _, p := range providers {
+		password, err := p.Password(sw)
+		if errors.Is(err, ErrNotFound) {
+			debugf.printf("No password for %s from %s\n", sw.Name, p.Name())
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("%s credential source: %w", p.Name(), err)
+		}
+		debugf.printf("Found password for %s via %s\n", sw.Name, p.Name())
+		return password, nil
+	}
+	return "", ErrNotFound
+}
+
+// hostKeys returns the names a switch may be filed under: its configured
+// name and, when different, its address.
+func hostKeys(sw config.Switch) []string {
+	if sw.Address != "" && sw.Address != sw.Name {
+		return []string{sw.Name, sw.Address}
+	}
+	return []string{sw.Name}
+}
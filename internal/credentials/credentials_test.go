@@ -0,0 +1,282 @@
+package credentials
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"netgearcli/internal/config"
+)
+
+// clearEnv unsets every variable a provider reads so the host environment
+// does not leak into a test.
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(name, "NETGEAR_") || strings.HasPrefix(name, "VAULT_") || name == "NETRC" {
+			t.Setenv(name, "")
+			os.Unsetenv(name)
+		}
+	}
+	t.Setenv("HOME", t.TempDir())
+}
+
+func names(providers []Provider) []string {
+	var list []string
+	for _, p := range providers {
+		list = append(list, p.Name())
+	}
+	return list
+}
+
+func TestForSwitch(t *testing.T) {
+	tests := []struct {
+		name      string
+		sw        config.Switch
+		opts      Options
+		vaultAddr string
+		want      []string
+		wantErr   string
+	}{
+		{
+			name: "defaults",
+			sw:   config.Switch{Name: "sw1"},
+			want: []string{"file", "env", "netrc"},
+		},
+		{
+			name: "stdin and command",
+			sw:   config.Switch{Name: "sw1", PasswordCommand: "echo secret"},
+			opts: Options{Stdin: strings.NewReader("secret\n")},
+			want: []string{"stdin", "command", "file", "env", "netrc"},
+		},
+		{
+			name: "pass entry",
+			sw:   config.Switch{Name: "sw1", PassEntry: "lab/sw1"},
+			want: []string{"pass", "file", "env", "netrc"},
+		},
+		{
+			name:      "vault from VAULT_ADDR",
+			sw:        config.Switch{Name: "sw1"},
+			vaultAddr: "http://vault.example:8200",
+			want:      []string{"vault", "file", "env", "netrc"},
+		},
+		{
+			name: "vault configured",
+			sw:   config.Switch{Name: "sw1"},
+			opts: Options{Vault: &config.Vault{Address: "http://vault.example:8200"}},
+			want: []string{"vault", "file", "env", "netrc"},
+		},
+		{
+			name: "explicit order",
+			sw:   config.Switch{Name: "sw1", Credentials: []string{"netrc", "pass", "env"}},
+			want: []string{"netrc", "pass", "env"},
+		},
+		{
+			name:    "explicit command without password_command",
+			sw:      config.Switch{Name: "sw1", Credentials: []string{"command"}},
+			wantErr: "no password_command",
+		},
+		{
+			name:    "unknown source",
+			sw:      config.Switch{Name: "sw1", Credentials: []string{"keychain"}},
+			wantErr: `unknown credential source "keychain"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			if tt.vaultAddr != "" {
+				t.Setenv("VAULT_ADDR", tt.vaultAddr)
+			}
+			providers, err := ForSwitch(tt.sw, tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := names(providers); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("providers = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fixed is a provider with a canned answer.
+type fixed struct {
+	name     string
+	password string
+	err      error
+}
+
+func (f fixed) Name() string { return f.name }
+
+func (f fixed) Password(config.Switch) (string, error) { return f.password, f.err }
+
+func TestResolve(t *testing.T) {
+	broken := errors.New("exit status 1")
+	tests := []struct {
+		name      string
+		providers []Provider
+		want      string
+		wantErr   error
+	}{
+		{
+			name:      "first found wins",
+			providers: []Provider{fixed{name: "a", password: "one"}, fixed{name: "b", password: "two"}},
+			want:      "one",
+		},
+		{
+			name:      "not found falls through",
+			providers: []Provider{fixed{name: "a", err: ErrNotFound}, fixed{name: "b", password: "two"}},
+			want:      "two",
+		},
+		{
+			name:      "error stops the search",
+			providers: []Provider{fixed{name: "a", err: broken}, fixed{name: "b", password: "two"}},
+			wantErr:   broken,
+		},
+		{
+			name:      "nothing found",
+			providers: []Provider{fixed{name: "a", err: ErrNotFound}},
+			wantErr:   ErrNotFound,
+		},
+		{
+			name:    "no providers",
+			wantErr: ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve(config.Switch{Name: "sw1"}, tt.providers, nil)
+			checkPassword(t, got, err, tt.want, tt.wantErr, "")
+		})
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	secret := write("secret", "s3cret \n")
+	empty := write("empty", "\n")
+
+	tests := []struct {
+		name    string
+		path    string
+		env     map[string]string
+		want    string
+		wantErr error
+		errText string
+	}{
+		{name: "configured path keeps inner whitespace", path: secret, want: "s3cret "},
+		{name: "per-switch variable", env: map[string]string{"NETGEAR_PASSWORD_FILE_sw1": secret}, want: "s3cret "},
+		{name: "address variable", env: map[string]string{"NETGEAR_PASSWORD_FILE_10.0.0.1": secret}, want: "s3cret "},
+		{name: "global variable", env: map[string]string{"NETGEAR_PASSWORD_FILE": secret}, want: "s3cret "},
+		{name: "nothing set", wantErr: ErrNotFound},
+		{name: "missing file from variable", env: map[string]string{"NETGEAR_PASSWORD_FILE": filepath.Join(dir, "nope")}, wantErr: ErrNotFound},
+		{name: "missing configured file", path: filepath.Join(dir, "nope"), errText: "failed to read password file"},
+		{name: "empty file", path: empty, errText: "is empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			got, err := (&File{Path: tt.path}).Password(config.Switch{Name: "sw1", Address: "10.0.0.1"})
+			checkPassword(t, got, err, tt.want, tt.wantErr, tt.errText)
+		})
+	}
+}
+
+func TestEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    string
+		wantErr error
+	}{
+		{name: "per-switch variable", env: map[string]string{"NETGEAR_PASSWORD_sw1": "one"}, want: "one"},
+		{name: "address variable", env: map[string]string{"NETGEAR_PASSWORD_10.0.0.1": "two"}, want: "two"},
+		{name: "switch list by name", env: map[string]string{"NETGEAR_SWITCHES": "other:x; sw1 : three "}, want: "three"},
+		{name: "switch list by address", env: map[string]string{"NETGEAR_SWITCHES": "10.0.0.1:four"}, want: "four"},
+		{name: "password with colon", env: map[string]string{"NETGEAR_SWITCHES": "sw1:a:b"}, want: "a:b"},
+		{name: "variable before list", env: map[string]string{"NETGEAR_PASSWORD_sw1": "one", "NETGEAR_SWITCHES": "sw1:three"}, want: "one"},
+		{name: "not listed", env: map[string]string{"NETGEAR_SWITCHES": "other:x;broken"}, wantErr: ErrNotFound},
+		{name: "nothing set", wantErr: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			got, err := (&Env{}).Password(config.Switch{Name: "sw1", Address: "10.0.0.1"})
+			checkPassword(t, got, err, tt.want, tt.wantErr, "")
+		})
+	}
+}
+
+func TestStdinReadsOnce(t *testing.T) {
+	s := &Stdin{Reader: strings.NewReader("secret\r\nignored\n")}
+	for i := 0; i < 2; i++ {
+		got, err := s.Password(config.Switch{Name: "sw1"})
+		checkPassword(t, got, err, "secret", nil, "")
+	}
+
+	_, err := (&Stdin{Reader: strings.NewReader("")}).Password(config.Switch{Name: "sw1"})
+	if err == nil {
+		t.Error("empty stdin: want an error")
+	}
+}
+
+func TestCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    string
+		errText string
+	}{
+		{name: "first line", line: "printf 'secret\\nsecond\\n'", want: "secret"},
+		{name: "no newline", line: "printf secret", want: "secret"},
+		{name: "failure", line: "exit 3", errText: "exited with status 3"},
+		{name: "empty output", line: "true", errText: "empty password"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&Command{Line: tt.line}).Password(config.Switch{Name: "sw1"})
+			checkPassword(t, got, err, tt.want, nil, tt.errText)
+		})
+	}
+}
+
+func checkPassword(t *testing.T, got string, err error, want string, wantErr error, errText string) {
+	t.Helper()
+	switch {
+	case wantErr != nil:
+		if !errors.Is(err, wantErr) {
+			t.Fatalf("error = %v, want %v", err, wantErr)
+		}
+	case errText != "":
+		if err == nil || !strings.Contains(err.Error(), errText) {
+			t.Fatalf("error = %v, want %q", err, errText)
+		}
+	case err != nil:
+		t.Fatal(err)
+	case got != want:
+		t.Errorf("password = %q, want %q", got, want)
+	}
+}
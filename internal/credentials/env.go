@@ -0,0 +1,49 @@
+package credentials
+
+import (
+	"os"
+	"strings"
+
+	"netgearcli/internal/config"
+)
+
+// Env reads NETGEAR_PASSWORD_<host> and NETGEAR_SWITCHES="host:pass;...".
+// This is the original lookup used by all the tools.
+type Env struct {
+	Debugf Logf
+}
+
+func (e *Env) Name() string { return "env" }
+
+func (e *Env) Password(sw config.Switch) (string, error) {
+	for _, host := range hostKeys(sw) {
+		envVar := "NETGEAR_PASSWORD_" + host
+		if password := os.Getenv(envVar); password != "" {
+			e.Debugf.printf("Found password in environment variable %s\n", envVar)
+			return password, nil
+		}
+	}
+
+	switches := os.Getenv("NETGEAR_SWITCHES")
+	if switches == "" {
+		e.Debugf.printf("NETGEAR_SWITCHES is not set\n")
+		return "", ErrNotFound
+	}
+
+	for _, entry := range strings.Split(switches, ";") {
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		host := strings.TrimSpace(parts[0])
+		for _, key := range hostKeys(sw) {
+			if host == key {
+				e.Debugf.printf("Found password for %s in NETGEAR_SWITCHES\n", key)
+				return strings.TrimSpace(parts[1]), nil
+			}
+		}
+	}
+
+	e.Debugf.printf("Checked: NETGEAR_PASSWORD_%s and NETGEAR_SWITCHES\n", sw.Name)
+	return "", ErrNotFound
+}
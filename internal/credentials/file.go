@@ -0,0 +1,57 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"netgearcli/internal/config"
+)
+
+// File reads a password from a file containing only the password, such as
+// a Docker secret (/run/secrets/...) or a mounted Kubernetes secret.
+//
+// When Path is empty the file named by NETGEAR_PASSWORD_FILE_<host> or
+// NETGEAR_PASSWORD_FILE is used.
+type File struct {
+	Path   string
+	Debugf Logf
+}
+
+func (f *File) Name() string { return "file" }
+
+func (f *File) Password(sw config.Switch) (string, error) {
+	path := f.Path
+	if path == "" {
+		for _, host := range hostKeys(sw) {
+			if path = os.Getenv("NETGEAR_PASSWORD_FILE_" + host); path != "" {
+				break
+			}
+		}
+	}
+	if path == "" {
+		path = os.Getenv("NETGEAR_PASSWORD_FILE")
+	}
+	if path == "" {
+		return "", ErrNotFound
+	}
+
+	f.Debugf.printf("Reading password file %s\n", path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) && f.Path == "" {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("failed to read password file: %w", err)
+	}
+
+	// Secret files commonly end in a newline; nothing else is trimmed so
+	// passwords with meaningful whitespace survive.
+	password := strings.TrimRight(string(data), "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("password file %s is empty", path)
+	}
+	return password, nil
+}
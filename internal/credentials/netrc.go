@@ -0,0 +1,99 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"netgearcli/internal/config"
+)
+
+// Netrc reads the password from a netrc file entry:
+//
+//	machine tswitch16 login admin password secret
+//
+// A "default" entry is used when no machine matches.
+type Netrc struct {
+	// Path defaults to $NETRC, then ~/.netrc.
+	Path string
+}
+
+func (n *Netrc) Name() string { return "netrc" }
+
+func (n *Netrc) Password(sw config.Switch) (string, error) {
+	path := n.Path
+	if path == "" {
+		path = os.Getenv("NETRC")
+	}
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", ErrNotFound
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	machines := parseNetrc(string(data))
+	for _, host := range hostKeys(sw) {
+		if password, ok := machines[host]; ok {
+			return password, nil
+		}
+	}
+	if password, ok := machines[""]; ok {
+		return password, nil
+	}
+	return "", ErrNotFound
+}
+
+// parseNetrc returns machine name to password. The default entry is stored
+// under the empty name. macdef bodies are skipped.
+func parseNetrc(data string) map[string]string {
+	machines := make(map[string]string)
+	lines := strings.Split(data, "\n")
+
+	var machine string
+	inEntry := false
+	for i := 0; i < len(lines); i++ {
+		fields := strings.Fields(lines[i])
+		for j := 0; j < len(fields); j++ {
+			switch fields[j] {
+			case "machine":
+				if j+1 < len(fields) {
+					j++
+					machine = fields[j]
+					inEntry = true
+				}
+			case "default":
+				machine = ""
+				inEntry = true
+			case "password":
+				if j+1 < len(fields) && inEntry {
+					j++
+					if _, seen := machines[machine]; !seen {
+						machines[machine] = fields[j]
+					}
+				}
+			case "login", "account":
+				j++
+			case "macdef":
+				// A macro body runs until the next blank line.
+				for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+					i++
+				}
+				j = len(fields)
+			}
+		}
+	}
+	return machines
+}
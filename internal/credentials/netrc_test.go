@@ -0,0 +1,105 @@
+package credentials
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"netgearcli/internal/config"
+)
+
+func TestParseNetrc(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want map[string]string
+	}{
+		{
+			name: "one line",
+			data: "machine sw1 login admin password secret",
+			want: map[string]string{"sw1": "secret"},
+		},
+		{
+			name: "multi-line entries",
+			data: "machine sw1\n  login admin\n  password one\n\nmachine sw2\n  password two\n",
+			want: map[string]string{"sw1": "one", "sw2": "two"},
+		},
+		{
+			name: "default entry",
+			data: "machine sw1 password one\ndefault login admin password fallback",
+			want: map[string]string{"sw1": "one", "": "fallback"},
+		},
+		{
+			name: "first entry wins",
+			data: "machine sw1 password one\nmachine sw1 password two",
+			want: map[string]string{"sw1": "one"},
+		},
+		{
+			name: "login named password",
+			data: "machine sw1 login password password secret",
+			want: map[string]string{"sw1": "secret"},
+		},
+		{
+			name: "account skipped",
+			data: "machine sw1 account ops password secret",
+			want: map[string]string{"sw1": "secret"},
+		},
+		{
+			name: "macdef body skipped",
+			data: "macdef init\npassword leaked\nmachine fake password x\n\nmachine sw1 password secret",
+			want: map[string]string{"sw1": "secret"},
+		},
+		{
+			name: "password outside an entry",
+			data: "password stray\nmachine sw1 password secret",
+			want: map[string]string{"sw1": "secret"},
+		},
+		{
+			name: "empty",
+			data: "",
+			want: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseNetrc(tt.data); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseNetrc = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNetrc(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "netrc")
+	os.WriteFile(path, []byte("machine sw1 password one\nmachine 10.0.0.2 password two\n"), 0600)
+	withDefault := filepath.Join(dir, "netrc-default")
+	os.WriteFile(withDefault, []byte("machine sw1 password one\ndefault password fallback\n"), 0600)
+
+	tests := []struct {
+		name    string
+		path    string
+		env     map[string]string
+		sw      config.Switch
+		want    string
+		wantErr error
+	}{
+		{name: "by name", path: path, sw: config.Switch{Name: "sw1"}, want: "one"},
+		{name: "by address", path: path, sw: config.Switch{Name: "sw2", Address: "10.0.0.2"}, want: "two"},
+		{name: "no entry", path: path, sw: config.Switch{Name: "sw3"}, wantErr: ErrNotFound},
+		{name: "default entry", path: withDefault, sw: config.Switch{Name: "sw3"}, want: "fallback"},
+		{name: "NETRC variable", env: map[string]string{"NETRC": path}, sw: config.Switch{Name: "sw1"}, want: "one"},
+		{name: "missing file", path: filepath.Join(dir, "nope"), sw: config.Switch{Name: "sw1"}, wantErr: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			got, err := (&Netrc{Path: tt.path}).Password(tt.sw)
+			checkPassword(t, got, err, tt.want, tt.wantErr, "")
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package credentials
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"netgearcli/internal/config"
+)
+
+// Stdin reads a single password line from Reader (--password-stdin). The
+// line is read once and reused, since stdin cannot be rewound.
+type Stdin struct {
+	Reader io.Reader
+
+	once     sync.Once
+	password string
+	err      error
+}
+
+func (s *Stdin) Name() string { return "stdin" }
+
+func (s *Stdin) Password(sw config.Switch) (string, error) {
+	s.once.Do(func() {
+		line, err := bufio.NewReader(s.Reader).ReadString('\n')
+		if err != nil && err != io.EOF {
+			s.err = fmt.Errorf("failed to read password from stdin: %w", err)
+			return
+		}
+		s.password = strings.TrimRight(line, "\r\n")
+		if s.password == "" {
+			s.err = fmt.Errorf("no password provided on stdin")
+		}
+	})
+	return s.password, s.err
+}
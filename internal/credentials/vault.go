@@ -0,0 +1,219 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"netgearcli/internal/config"
+)
+
+// Vault fetches passwords from a Vault-compatible KV v2 HTTP API using a
+// token or AppRole login. Any server speaking the same API works, which
+// includes a local httptest.Server standing in for Vault.
+type Vault struct {
+	Config config.Vault
+	// Client defaults to an http.Client with a 10 second timeout.
+	Client *http.Client
+	// Implicit is set when the source is only in use because VAULT_ADDR is
+	// set. A missing token then means Vault is not set up for netgear and
+	// the next source is tried.
+	Implicit bool
+	Debugf   Logf
+
+	mu    sync.Mutex
+	token string
+}
+
+func (v *Vault) Name() string { return "vault" }
+
+func (v *Vault) Password(sw config.Switch) (string, error) {
+	address := firstNonEmpty(v.Config.Address, os.Getenv("VAULT_ADDR"))
+	if address == "" {
+		return "", fmt.Errorf("no Vault address configured (set vault.address or VAULT_ADDR)")
+	}
+	address = strings.TrimRight(address, "/")
+
+	tmpl := firstNonEmpty(sw.VaultPath, v.Config.Path, "secret/netgear/{host}")
+	mount, path, ok := strings.Cut(strings.Trim(strings.ReplaceAll(tmpl, "{host}", sw.Name), "/"), "/")
+	if !ok {
+		return "", fmt.Errorf("vault path %q must include the KV mount, e.g. secret/netgear/{host}", tmpl)
+	}
+	field := firstNonEmpty(v.Config.Field, "password")
+
+	token, err := v.getToken(address)
+	if errors.Is(err, errNoToken) && v.Implicit {
+		v.Debugf.printf("Skipping Vault at %s: %v\n", address, err)
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	url := fmt.Sprintf("%s/v1/%s/data/%s", address, mount, path)
+	v.Debugf.printf("Reading %s from Vault at %s\n", mount+"/"+path, address)
+
+	var secret struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	status, err := v.do(http.MethodGet, url, token, nil, &secret)
+	if err != nil {
+		return "", err
+	}
+	if status == http.StatusNotFound {
+		return "", ErrNotFound
+	}
+
+	value, ok := secret.Data.Data[field]
+	if !ok {
+		return "", fmt.Errorf("vault secret %s/%s has no %q field", mount, path, field)
+	}
+	password, ok := value.(string)
+	if !ok || password == "" {
+		return "", fmt.Errorf("vault secret %s/%s field %q is not a non-empty string", mount, path, field)
+	}
+	return password, nil
+}
+
+// errNoToken is returned by getToken when no token source is set up.
+var errNoToken = errors.New("no Vault token (set VAULT_TOKEN, vault.token_file or AppRole credentials)")
+
+// getToken returns the configured token, logging in with AppRole the first
+// time when role credentials are set.
+func (v *Vault) getToken(address string) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.token != "" {
+		return v.token, nil
+	}
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		v.token = token
+		return v.token, nil
+	}
+
+	roleID := firstNonEmpty(v.Config.RoleID, os.Getenv("VAULT_ROLE_ID"))
+	if roleID != "" {
+		secretID, err := v.secretID()
+		if err != nil {
+			return "", err
+		}
+		mount := firstNonEmpty(v.Config.AppRolePath, "approle")
+		body, _ := json.Marshal(map[string]string{"role_id": roleID, "secret_id": secretID})
+
+		var login struct {
+			Auth struct {
+				ClientToken string `json:"client_token"`
+			} `json:"auth"`
+		}
+		v.Debugf.printf("Logging in to Vault with AppRole at auth/%s\n", mount)
+		status, err := v.do(http.MethodPost, address+"/v1/auth/"+mount+"/login", "", body, &login)
+		if err != nil {
+			return "", fmt.Errorf("vault AppRole login: %w", err)
+		}
+		if status == http.StatusNotFound || login.Auth.ClientToken == "" {
+			return "", fmt.Errorf("vault AppRole login returned no token")
+		}
+		v.token = login.Auth.ClientToken
+		return v.token, nil
+	}
+
+	tokenFile := v.Config.TokenFile
+	if tokenFile == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			tokenFile = filepath.Join(home, ".vault-token")
+		}
+	}
+	if tokenFile != "" {
+		if data, err := os.ReadFile(tokenFile); err == nil {
+			v.token = strings.TrimSpace(string(data))
+		} else if v.Config.TokenFile != "" {
+			return "", fmt.Errorf("failed to read vault token file: %w", err)
+		}
+	}
+	if v.token == "" {
+		return "", errNoToken
+	}
+	return v.token, nil
+}
+
+func (v *Vault) secretID() (string, error) {
+	if v.Config.SecretIDFile != "" {
+		data, err := os.ReadFile(v.Config.SecretIDFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read vault secret_id_file: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return firstNonEmpty(v.Config.SecretID, os.Getenv("VAULT_SECRET_ID")), nil
+}
+
+// do sends a Vault API request and decodes a successful JSON response into
+// out. A 404 is returned as a status rather than an error so callers can
+// map it to ErrNotFound.
+func (v *Vault) do(method, url, token string, body []byte, out interface{}) (int, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if ns := firstNonEmpty(v.Config.Namespace, os.Getenv("VAULT_NAMESPACE")); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := v.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, fmt.Errorf("failed to read vault response: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return resp.StatusCode, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Errors []string `json:"errors"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && len(apiErr.Errors) > 0 {
+			return resp.StatusCode, fmt.Errorf("vault returned %s: %s", resp.Status, strings.Join(apiErr.Errors, "; "))
+		}
+		return resp.StatusCode, fmt.Errorf("vault returned %s", resp.Status)
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return resp.StatusCode, fmt.Errorf("failed to decode vault response: %w", err)
+	}
+	return resp.StatusCode, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
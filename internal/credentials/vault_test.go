@@ -0,0 +1,256 @@
+package credentials
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"netgearcli/internal/config"
+)
+
+// fakeVault serves the KV v2 read and AppRole login endpoints of Vault.
+type fakeVault struct {
+	token     string
+	roleID    string
+	secretID  string
+	namespace string
+	// secrets maps "<mount>/data/<path>" to the secret data.
+	secrets map[string]map[string]interface{}
+	logins  atomic.Int32
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.namespace != "" && r.Header.Get("X-Vault-Namespace") != f.namespace {
+		writeVaultError(w, http.StatusForbidden, "wrong namespace")
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/v1/auth/") && strings.HasSuffix(r.URL.Path, "/login") {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.Method != http.MethodPost || body["role_id"] != f.roleID || body["secret_id"] != f.secretID {
+			writeVaultError(w, http.StatusBadRequest, "invalid role or secret ID")
+			return
+		}
+		f.logins.Add(1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]string{"client_token": f.token}})
+		return
+	}
+	if r.Header.Get("X-Vault-Token") != f.token {
+		writeVaultError(w, http.StatusForbidden, "permission denied")
+		return
+	}
+	data, ok := f.secrets[strings.TrimPrefix(r.URL.Path, "/v1/")]
+	if !ok {
+		writeVaultError(w, http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": data}})
+}
+
+func writeVaultError(w http.ResponseWriter, status int, messages ...string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string][]string{"errors": append([]string{}, messages...)})
+}
+
+func TestVault(t *testing.T) {
+	fake := &fakeVault{
+		token:    "s.token",
+		roleID:   "role",
+		secretID: "secret",
+		secrets: map[string]map[string]interface{}{
+			"secret/data/netgear/sw1":  {"password": "one"},
+			"kv/data/lab/sw1":          {"admin": "two"},
+			"secret/data/netgear/sw2":  {"password": 42},
+			"secret/data/netgear/sw3":  {"other": "x"},
+			"secret/data/override/sw1": {"password": "three"},
+		},
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	os.WriteFile(tokenFile, []byte("s.token\n"), 0600)
+	secretIDFile := filepath.Join(dir, "secret-id")
+	os.WriteFile(secretIDFile, []byte("secret\n"), 0600)
+
+	tests := []struct {
+		name    string
+		config  config.Vault
+		env     map[string]string
+		sw      config.Switch
+		want    string
+		wantErr error
+		errText string
+	}{
+		{
+			name: "token from environment",
+			env:  map[string]string{"VAULT_TOKEN": "s.token"},
+			sw:   config.Switch{Name: "sw1"},
+			want: "one",
+		},
+		{
+			name:   "token file",
+			config: config.Vault{TokenFile: tokenFile},
+			sw:     config.Switch{Name: "sw1"},
+			want:   "one",
+		},
+		{
+			name:    "default token file",
+			config:  config.Vault{},
+			env:     map[string]string{"HOME": dir},
+			sw:      config.Switch{Name: "sw1"},
+			errText: "no Vault token",
+		},
+		{
+			name:   "approle",
+			config: config.Vault{RoleID: "role", SecretID: "secret"},
+			sw:     config.Switch{Name: "sw1"},
+			want:   "one",
+		},
+		{
+			name:   "approle secret ID file",
+			config: config.Vault{RoleID: "role", SecretIDFile: secretIDFile},
+			sw:     config.Switch{Name: "sw1"},
+			want:   "one",
+		},
+		{
+			name: "approle from environment",
+			env:  map[string]string{"VAULT_ROLE_ID": "role", "VAULT_SECRET_ID": "secret"},
+			sw:   config.Switch{Name: "sw1"},
+			want: "one",
+		},
+		{
+			name:    "approle rejected",
+			config:  config.Vault{RoleID: "role", SecretID: "wrong"},
+			sw:      config.Switch{Name: "sw1"},
+			errText: "invalid role or secret ID",
+		},
+		{
+			name:   "path and field",
+			config: config.Vault{TokenFile: tokenFile, Path: "kv/lab/{host}", Field: "admin"},
+			sw:     config.Switch{Name: "sw1"},
+			want:   "two",
+		},
+		{
+			name:   "switch path overrides config",
+			config: config.Vault{TokenFile: tokenFile, Path: "kv/lab/{host}"},
+			sw:     config.Switch{Name: "sw1", VaultPath: "secret/override/{host}"},
+			want:   "three",
+		},
+		{
+			name:    "missing secret",
+			config:  config.Vault{TokenFile: tokenFile},
+			sw:      config.Switch{Name: "sw9"},
+			wantErr: ErrNotFound,
+		},
+		{
+			name:    "field not a string",
+			config:  config.Vault{TokenFile: tokenFile},
+			sw:      config.Switch{Name: "sw2"},
+			errText: "is not a non-empty string",
+		},
+		{
+			name:    "field missing",
+			config:  config.Vault{TokenFile: tokenFile},
+			sw:      config.Switch{Name: "sw3"},
+			errText: `has no "password" field`,
+		},
+		{
+			name:    "permission denied",
+			env:     map[string]string{"VAULT_TOKEN": "s.wrong"},
+			sw:      config.Switch{Name: "sw1"},
+			errText: "permission denied",
+		},
+		{
+			name:    "path without mount",
+			config:  config.Vault{TokenFile: tokenFile, Path: "{host}"},
+			sw:      config.Switch{Name: "sw1"},
+			errText: "must include the KV mount",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			tt.config.Address = server.URL
+			v := &Vault{Config: tt.config}
+			got, err := v.Password(tt.sw)
+			checkPassword(t, got, err, tt.want, tt.wantErr, tt.errText)
+		})
+	}
+}
+
+func TestVaultLogsInOnce(t *testing.T) {
+	clearEnv(t)
+	fake := &fakeVault{
+		token: "s.token", roleID: "role", secretID: "secret",
+		secrets: map[string]map[string]interface{}{
+			"secret/data/netgear/sw1": {"password": "one"},
+			"secret/data/netgear/sw2": {"password": "two"},
+		},
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	v := &Vault{Config: config.Vault{Address: server.URL, RoleID: "role", SecretID: "secret"}}
+	for _, name := range []string{"sw1", "sw2", "sw1"} {
+		if _, err := v.Password(config.Switch{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := fake.logins.Load(); n != 1 {
+		t.Errorf("AppRole logins = %d, want 1", n)
+	}
+}
+
+func TestVaultNamespace(t *testing.T) {
+	clearEnv(t)
+	fake := &fakeVault{
+		token: "s.token", namespace: "team",
+		secrets: map[string]map[string]interface{}{"secret/data/netgear/sw1": {"password": "one"}},
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	t.Setenv("VAULT_TOKEN", "s.token")
+
+	v := &Vault{Config: config.Vault{Address: server.URL, Namespace: "team"}}
+	got, err := v.Password(config.Switch{Name: "sw1"})
+	checkPassword(t, got, err, "one", nil, "")
+}
+
+// A VAULT_ADDR exported for other tools must not stop the search when
+// Vault holds nothing for netgear.
+func TestVaultImplicitFallsThrough(t *testing.T) {
+	clearEnv(t)
+	server := httptest.NewServer(&fakeVault{token: "s.token"})
+	defer server.Close()
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("NETGEAR_PASSWORD_sw1", "from-env")
+
+	sw := config.Switch{Name: "sw1"}
+	providers, err := ForSwitch(sw, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Resolve(sw, providers, nil)
+	checkPassword(t, got, err, "from-env", nil, "")
+
+	// Configured Vault without a token is a real error
+	providers, err = ForSwitch(sw, Options{Vault: &config.Vault{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Resolve(sw, providers, nil)
+	if err == nil || errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "no Vault token") {
+		t.Errorf("error = %v, want the missing token", err)
+	}
+}
@@ -0,0 +1,357 @@
+// Package drift compares the live PoE settings of switches with a baseline
+// saved by "netgear snapshot", reports what drifted and can put drifted
+// settings back.
+package drift
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/hooks"
+	"netgearcli/internal/monitor"
+	"netgearcli/internal/session"
+	"netgearcli/internal/snapshot"
+)
+
+// Alert kinds sent by Watch
+const (
+	KindDrift             = "drift"
+	KindDriftCleared      = "drift_cleared"
+	KindRemediated        = "drift_remediated"
+	KindRemediationFailed = "drift_remediation_failed"
+	KindCheckFailed       = "drift_check_failed"
+)
+
+// defaultInterval is how often Watch checks when Interval is not set
+const defaultInterval = 5 * time.Minute
+
+// Checker compares switches with a baseline.
+type Checker struct {
+	Baseline *snapshot.Snapshot
+	// Members are the switches checked. Each must be in the baseline.
+	Members []*fleet.Member
+	// Timeout bounds reading one switch. Defaults to 1m.
+	Timeout time.Duration
+	// Remediate puts drifted admin states, priorities, modes, limits and
+	// detection types back to the baseline. Drifted labels, and ports
+	// added or removed, are only reported.
+	Remediate bool
+	// Actor is recorded for remediation changes.
+	Actor hooks.Actor
+	Logf  func(format string, args ...interface{})
+}
+
+// Result is the drift found on one switch.
+type Result struct {
+	Switch string            `json:"switch"`
+	Drift  []snapshot.Change `json:"drift"`
+	// Remediated ports were put back to their baseline admin state.
+	Remediated []int `json:"remediated,omitempty"`
+	// Reconfigured ports had their other drifted settings put back.
+	Reconfigured []int  `json:"reconfigured,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// Fixed reports whether d was remediated.
+func (r Result) Fixed(d snapshot.Change) bool {
+	if !Remediable(d) {
+		return false
+	}
+	ports := r.Reconfigured
+	if d.Field == "admin" {
+		ports = r.Remediated
+	}
+	for _, p := range ports {
+		if p == d.Port {
+			return true
+		}
+	}
+	return false
+}
+
+// Remaining returns the drift that was not remediated.
+func (r Result) Remaining() []snapshot.Change {
+	var remaining []snapshot.Change
+	for _, c := range r.Drift {
+		if !r.Fixed(c) {
+			remaining = append(remaining, c)
+		}
+	}
+	return remaining
+}
+
+// Check reads every member in parallel and compares it with the baseline,
+// remediating if asked to. Results are sorted by switch.
+func (c *Checker) Check(ctx context.Context) []Result {
+	results := make([]Result, len(c.Members))
+	var wg sync.WaitGroup
+	for i, m := range c.Members {
+		wg.Add(1)
+		go func(i int, m *fleet.Member) {
+			defer wg.Done()
+			results[i] = c.check(ctx, m)
+		}(i, m)
+	}
+	wg.Wait()
+	sort.Slice(results, func(i, j int) bool { return results[i].Switch < results[j].Switch })
+	return results
+}
+
+func (c *Checker) check(ctx context.Context, m *fleet.Member) Result {
+	r := Result{Switch: m.Config.Name, Drift: []snapshot.Change{}}
+	baseline, ok := c.Baseline.Switch(m.Config.Name)
+	if !ok {
+		r.Error = "not in the baseline"
+		return r
+	}
+	if baseline.Error != "" {
+		r.Error = "the baseline has no ports for this switch: " + baseline.Error
+		return r
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	live, err := snapshot.Read(ctx, m, timeout)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.Drift = snapshot.DiffSettings(m.Config.Name, baseline.Ports, live.Ports)
+	if c.Remediate && len(r.Drift) > 0 {
+		r.Remediated, r.Reconfigured, err = c.remediate(ctx, m, r.Drift)
+		if err != nil {
+			r.Error = "remediation failed: " + err.Error()
+		}
+	}
+	return r
+}
+
+// Remediable reports whether Remediate can put d back: a changed admin
+// state, priority, mode, limit type, limit or detection type can be. The
+// switch's PoE settings do not include the label.
+func Remediable(d snapshot.Change) bool {
+	if d.Kind != snapshot.Changed || d.Before == "" {
+		return false
+	}
+	switch d.Field {
+	case "admin", "priority", "mode", "limit_type", "limit_w", "detection_type":
+		return true
+	}
+	return false
+}
+
+// remediate puts drifted settings back: ports to disable first, then the
+// other settings, then ports to enable, so a port comes back up with its
+// baseline limits. Ports sharing the same drifted settings are set
+// together. It returns the ports whose admin state and whose other
+// settings were put back, even when some failed.
+func (c *Checker) remediate(ctx context.Context, m *fleet.Member, drift []snapshot.Change) (remediated, reconfigured []int, err error) {
+	byAction := make(map[string][]int)
+	configs := make(map[int]*session.PortConfig)
+	for _, d := range drift {
+		if !Remediable(d) {
+			continue
+		}
+		if d.Field == "admin" {
+			switch d.Before {
+			case "enabled":
+				byAction[hooks.EventEnable] = append(byAction[hooks.EventEnable], d.Port)
+			case "disabled":
+				byAction[hooks.EventDisable] = append(byAction[hooks.EventDisable], d.Port)
+			}
+			continue
+		}
+		cfg := configs[d.Port]
+		if cfg == nil {
+			cfg = &session.PortConfig{}
+			configs[d.Port] = cfg
+		}
+		switch d.Field {
+		case "priority":
+			cfg.Priority = d.Before
+		case "mode":
+			cfg.Mode = d.Before
+		case "limit_type":
+			cfg.LimitType = d.Before
+		case "limit_w":
+			cfg.Limit = d.Before
+		case "detection_type":
+			cfg.DetectionType = d.Before
+		}
+	}
+	byConfig := make(map[session.PortConfig][]int)
+	for port, cfg := range configs {
+		byConfig[*cfg] = append(byConfig[*cfg], port)
+	}
+	groups := make([]session.PortConfig, 0, len(byConfig))
+	for cfg, ports := range byConfig {
+		sort.Ints(ports)
+		groups = append(groups, cfg)
+	}
+	sort.Slice(groups, func(i, j int) bool { return byConfig[groups[i]][0] < byConfig[groups[j]][0] })
+
+	var failures []string
+	apply := func(what string, ports []int, change func() (*session.PortResult, error)) []int {
+		c.logf("Drift on %s: %s ports %v to match the baseline", m.Config.Name, what, ports)
+		result, err := change()
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s %v: %v", what, ports, err))
+		}
+		if result == nil {
+			return nil
+		}
+		return result.Changed
+	}
+	if ports := byAction[hooks.EventDisable]; len(ports) > 0 {
+		remediated = append(remediated, apply(hooks.EventDisable, ports, func() (*session.PortResult, error) {
+			return m.Change(ctx, hooks.EventDisable, ports, c.Actor)
+		})...)
+	}
+	for _, cfg := range groups {
+		ports := byConfig[cfg]
+		reconfigured = append(reconfigured, apply("set "+cfg.String()+" on", ports, func() (*session.PortResult, error) {
+			return m.Configure(ctx, ports, cfg, c.Actor)
+		})...)
+	}
+	if ports := byAction[hooks.EventEnable]; len(ports) > 0 {
+		remediated = append(remediated, apply(hooks.EventEnable, ports, func() (*session.PortResult, error) {
+			return m.Change(ctx, hooks.EventEnable, ports, c.Actor)
+		})...)
+	}
+	sort.Ints(remediated)
+	sort.Ints(reconfigured)
+	if len(failures) > 0 {
+		return remediated, reconfigured, fmt.Errorf("%s", strings.Join(failures, "; "))
+	}
+	return remediated, reconfigured, nil
+}
+
+// Watch checks on an interval until ctx is done, sending an alert to sinks
+// when drift appears, is remediated or clears. Each drift is reported once
+// while it lasts.
+func (c *Checker) Watch(ctx context.Context, interval time.Duration, sinks []monitor.Sink) {
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	// Drift and failures already alerted on, by switch
+	reported := make(map[string]map[string]snapshot.Change)
+	failed := make(map[string]bool)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		results := c.Check(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		for _, r := range results {
+			for _, a := range c.alerts(r, reported, failed) {
+				c.send(ctx, sinks, a)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// alerts turns one check into alerts, updating what has been reported.
+func (c *Checker) alerts(r Result, reported map[string]map[string]snapshot.Change, failed map[string]bool) []monitor.Alert {
+	now := time.Now().UTC()
+	var alerts []monitor.Alert
+	alert := func(kind, severity string, port int, label, message string) {
+		alerts = append(alerts, monitor.Alert{Time: now, Switch: r.Switch, Port: port, Label: label,
+			Kind: kind, Severity: severity, Message: message})
+	}
+
+	if r.Error != "" && len(r.Drift) == 0 {
+		if !failed[r.Switch] {
+			alert(KindCheckFailed, monitor.SeverityWarning, 0, "", "drift check failed: "+r.Error)
+			failed[r.Switch] = true
+		}
+		return alerts
+	}
+	failed[r.Switch] = false
+
+	for _, p := range r.Remediated {
+		alert(KindRemediated, monitor.SeverityInfo, p, "", "admin state put back to the baseline")
+	}
+	for _, p := range r.Reconfigured {
+		alert(KindRemediated, monitor.SeverityInfo, p, "", "PoE settings put back to the baseline")
+	}
+	if r.Error != "" {
+		alert(KindRemediationFailed, monitor.SeverityCritical, 0, "", r.Error)
+	}
+
+	previous := reported[r.Switch]
+	current := make(map[string]snapshot.Change)
+	for _, d := range r.Remaining() {
+		key := fmt.Sprintf("%d/%s", d.Port, d.Field)
+		current[key] = d
+		if old, ok := previous[key]; !ok || old.After != d.After {
+			message := Describe(d)
+			if c.Remediate && !Remediable(d) {
+				message += " (reported only)"
+			}
+			alert(KindDrift, monitor.SeverityWarning, d.Port, d.Name, message)
+		}
+	}
+	for key, d := range previous {
+		if _, ok := current[key]; !ok {
+			alert(KindDriftCleared, monitor.SeverityInfo, d.Port, d.Name, fmt.Sprintf("%s is back to the baseline", fieldName(d)))
+		}
+	}
+	reported[r.Switch] = current
+	return alerts
+}
+
+func (c *Checker) send(ctx context.Context, sinks []monitor.Sink, a monitor.Alert) {
+	c.logf("Alert %s %s port %d %s: %s", a.Severity, a.Switch, a.Port, a.Kind, a.Message)
+	for _, sink := range sinks {
+		sendCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		if err := sink.Send(sendCtx, a); err != nil {
+			c.logf("Sending alert failed: %v", err)
+		}
+		cancel()
+	}
+}
+
+// Describe says what drifted, e.g. "admin is enabled, baseline disabled".
+func Describe(d snapshot.Change) string {
+	switch d.Kind {
+	case snapshot.Added:
+		return "port is not in the baseline"
+	case snapshot.Removed:
+		return "port in the baseline is missing"
+	}
+	return fmt.Sprintf("%s is %s, baseline %s", fieldName(d), quote(d.After), quote(d.Before))
+}
+
+func fieldName(d snapshot.Change) string {
+	if d.Field == "" {
+		return "port"
+	}
+	return d.Field
+}
+
+func quote(s string) string {
+	if s == "" {
+		return `""`
+	}
+	return s
+}
+
+func (c *Checker) logf(format string, args ...interface{}) {
+	if c.Logf != nil {
+		c.Logf(format, args...)
+	}
+}
@@ -0,0 +1,103 @@
+package drift
+
+import (
+	"reflect"
+	"testing"
+
+	"netgearcli/internal/snapshot"
+)
+
+func changed(port int, field, before, after string) snapshot.Change {
+	return snapshot.Change{Kind: snapshot.Changed, Switch: "sw1", Port: port, Field: field, Before: before, After: after}
+}
+
+func TestRemediable(t *testing.T) {
+	tests := []struct {
+		change snapshot.Change
+		want   bool
+	}{
+		{changed(1, "admin", "disabled", "enabled"), true},
+		{changed(1, "priority", "low", "high"), true},
+		{changed(1, "mode", "802.3at", "802.3af"), true},
+		{changed(1, "limit_type", "user", "class"), true},
+		{changed(1, "limit_w", "15.4", "30.0"), true},
+		{changed(1, "detection_type", "IEEE 802", "Legacy"), true},
+		// Labels are not PoE settings
+		{changed(1, "name", "spare", "printer"), false},
+		// An older baseline without the field has nothing to put back
+		{changed(1, "priority", "", "high"), false},
+		{snapshot.Change{Kind: snapshot.Added, Switch: "sw1", Port: 9}, false},
+		{snapshot.Change{Kind: snapshot.Removed, Switch: "sw1", Port: 9}, false},
+	}
+	for _, tt := range tests {
+		if got := Remediable(tt.change); got != tt.want {
+			t.Errorf("Remediable(%+v) = %v, want %v", tt.change, got, tt.want)
+		}
+	}
+}
+
+func TestRemaining(t *testing.T) {
+	r := Result{
+		Switch: "sw1",
+		Drift: []snapshot.Change{
+			changed(1, "admin", "disabled", "enabled"),
+			changed(1, "priority", "low", "high"),
+			changed(2, "admin", "enabled", "disabled"),
+			changed(3, "limit_w", "15.4", "30.0"),
+			changed(3, "name", "spare", "printer"),
+		},
+		// Port 1's admin state was put back but setting its priority
+		// failed; port 2 could not be enabled
+		Remediated:   []int{1},
+		Reconfigured: []int{3},
+	}
+	want := []snapshot.Change{
+		changed(1, "priority", "low", "high"),
+		changed(2, "admin", "enabled", "disabled"),
+		changed(3, "name", "spare", "printer"),
+	}
+	if got := r.Remaining(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Remaining =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestAlerts(t *testing.T) {
+	c := &Checker{Remediate: true}
+	reported := make(map[string]map[string]snapshot.Change)
+	failed := make(map[string]bool)
+
+	r := Result{
+		Switch: "sw1",
+		Drift: []snapshot.Change{
+			changed(1, "admin", "disabled", "enabled"),
+			changed(3, "limit_w", "15.4", "30.0"),
+			changed(3, "name", "spare", "printer"),
+		},
+		Remediated:   []int{1},
+		Reconfigured: []int{3},
+	}
+	var got []string
+	for _, a := range c.alerts(r, reported, failed) {
+		got = append(got, a.Kind+": "+a.Message)
+	}
+	want := []string{
+		"drift_remediated: admin state put back to the baseline",
+		"drift_remediated: PoE settings put back to the baseline",
+		"drift: name is printer, baseline spare (reported only)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("alerts =\n%q\nwant\n%q", got, want)
+	}
+
+	// The same drift is not alerted on again; once it clears, that is
+	r.Remediated, r.Reconfigured = nil, nil
+	r.Drift = r.Drift[2:]
+	if alerts := c.alerts(r, reported, failed); len(alerts) != 0 {
+		t.Errorf("repeated drift alerted again: %+v", alerts)
+	}
+	r.Drift = nil
+	alerts := c.alerts(r, reported, failed)
+	if len(alerts) != 1 || alerts[0].Kind != KindDriftCleared {
+		t.Errorf("alerts = %+v, want drift_cleared", alerts)
+	}
+}
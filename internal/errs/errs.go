@@ -0,0 +1,155 @@
+// Package errs classifies errors from the go-netgear library and the
+// network into a small set of sentinels, so callers can decide whether to
+// re-login, retry or give up with errors.Is instead of matching strings.
+package errs
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// Error classes. Classify wraps errors so errors.Is reports one of these.
+var (
+	ErrAuthRequired     = errors.New("authentication required")
+	ErrBadPassword      = errors.New("bad password")
+	ErrUnreachable      = errors.New("switch unreachable")
+	ErrTimeout          = errors.New("operation timed out")
+	ErrUnsupportedModel = errors.New("unsupported switch model")
+	ErrSwitchBusy       = errors.New("switch busy")
+	ErrCanceled         = errors.New("operation canceled")
+)
+
+// classes is checked in order, so more specific classes come first.
+var classes = []error{
+	ErrCanceled,
+	ErrBadPassword,
+	ErrSwitchBusy,
+	ErrAuthRequired,
+	ErrUnsupportedModel,
+	ErrTimeout,
+	ErrUnreachable,
+}
+
+// messages maps a class to phrases the library or switch firmware uses for
+// it. They are deliberately whole phrases; matching a bare word such as
+// "login" misfires on unrelated errors.
+var messages = map[error][]string{
+	ErrBadPassword: {
+		"password is invalid",
+		"invalid password",
+		"wrong password",
+		"incorrect password",
+	},
+	ErrSwitchBusy: {
+		"maximum number of",
+		"too many users",
+		"too many sessions",
+		"please, wait some minutes",
+		"try again later",
+	},
+	ErrAuthRequired: {
+		"no content. please, (re-)login first",
+		"no session",
+		"please login first",
+		"please, login first",
+		"login required",
+	},
+	ErrUnsupportedModel: {
+		"unsupported model",
+		"model not supported",
+		"unknown model",
+		"not a supported netgear",
+		"could not detect",
+		"can't detect",
+	},
+	ErrTimeout: {
+		"i/o timeout",
+		"deadline exceeded",
+		"client.timeout exceeded",
+	},
+	ErrUnreachable: {
+		"connection refused",
+		"no such host",
+		"no route to host",
+		"network is unreachable",
+		"host is down",
+		"connection reset by peer",
+	},
+}
+
+// classified attaches a class to an error without changing its message.
+type classified struct {
+	class error
+	err   error
+}
+
+func (c *classified) Error() string   { return c.err.Error() }
+func (c *classified) Unwrap() []error { return []error{c.class, c.err} }
+
+// Classify returns err annotated with its class, or err unchanged when it
+// is nil, already classified, or unrecognised.
+func Classify(err error) error {
+	if err == nil || Class(err) != nil {
+		return err
+	}
+	if class := classOf(err); class != nil {
+		return &classified{class: class, err: err}
+	}
+	return err
+}
+
+// Class returns the sentinel err is classified as, or nil.
+func Class(err error) error {
+	for _, class := range classes {
+		if errors.Is(err, class) {
+			return class
+		}
+	}
+	return nil
+}
+
+// Retryable reports whether repeating the failed operation might succeed.
+// Bad passwords and unsupported models never fix themselves.
+func Retryable(err error) bool {
+	switch Class(Classify(err)) {
+	case ErrUnreachable, ErrTimeout, ErrSwitchBusy:
+		return true
+	}
+	return false
+}
+
+func classOf(err error) error {
+	if errors.Is(err, context.Canceled) {
+		return ErrCanceled
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return ErrTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrTimeout
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EHOSTUNREACH) ||
+		errors.Is(err, syscall.ENETUNREACH) || errors.Is(err, syscall.ECONNRESET) {
+		return ErrUnreachable
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ErrUnreachable
+	}
+
+	// The library mostly returns plain errors, so fall back to its messages.
+	msg := strings.ToLower(err.Error())
+	for _, class := range classes {
+		for _, phrase := range messages[class] {
+			if strings.Contains(msg, phrase) {
+				return class
+			}
+		}
+	}
+	return nil
+}
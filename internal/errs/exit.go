@@ -0,0 +1,103 @@
+package errs
+
+import (
+	"context"
+	"errors"
+)
+
+// Errors raised by the tools themselves rather than the switch. They have
+// their own exit codes so scripts can tell them apart.
+var (
+	ErrUsage          = errors.New("usage error")
+	ErrPartial        = errors.New("partial failure")
+	ErrVerifyMismatch = errors.New("verification mismatch")
+	ErrOverBudget     = errors.New("over PoE budget")
+	ErrDrift          = errors.New("settings drifted from baseline")
+)
+
+// Exit codes returned by the command-line tools. These are part of the
+// scripting interface; do not renumber them.
+const (
+	ExitOK          = 0
+	ExitFailure     = 1
+	ExitUsage       = 2
+	ExitAuth        = 3
+	ExitUnreachable = 4
+	ExitPartial     = 5
+	ExitVerify      = 6
+	ExitUnsupported = 7
+	ExitSwitchBusy  = 8
+	ExitOverBudget  = 9
+	ExitDrift       = 10
+	ExitCanceled    = 130 // interrupted, as for a shell killed by SIGINT
+)
+
+// ExitCode maps err to the process exit status for its class.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	// Tool-level outcomes win over the class of an underlying switch error:
+	// a partial failure caused by a timeout is still a partial failure.
+	switch {
+	case errors.Is(err, ErrUsage):
+		return ExitUsage
+	case errors.Is(err, ErrCanceled), errors.Is(err, context.Canceled):
+		return ExitCanceled
+	case errors.Is(err, ErrPartial):
+		return ExitPartial
+	case errors.Is(err, ErrVerifyMismatch):
+		return ExitVerify
+	case errors.Is(err, ErrOverBudget):
+		return ExitOverBudget
+	case errors.Is(err, ErrDrift):
+		return ExitDrift
+	}
+	switch Class(Classify(err)) {
+	case ErrAuthRequired, ErrBadPassword:
+		return ExitAuth
+	case ErrUnreachable, ErrTimeout:
+		return ExitUnreachable
+	case ErrUnsupportedModel:
+		return ExitUnsupported
+	case ErrSwitchBusy:
+		return ExitSwitchBusy
+	}
+	return ExitFailure
+}
+
+// Name returns a stable machine-readable name for err's class, for use in
+// JSON error output.
+func Name(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrUsage):
+		return "usage"
+	case errors.Is(err, ErrCanceled), errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, ErrPartial):
+		return "partial_failure"
+	case errors.Is(err, ErrVerifyMismatch):
+		return "verification_mismatch"
+	case errors.Is(err, ErrOverBudget):
+		return "over_budget"
+	case errors.Is(err, ErrDrift):
+		return "drift"
+	}
+	switch Class(Classify(err)) {
+	case ErrAuthRequired:
+		return "auth_required"
+	case ErrBadPassword:
+		return "bad_password"
+	case ErrUnreachable:
+		return "unreachable"
+	case ErrTimeout:
+		return "timeout"
+	case ErrUnsupportedModel:
+		return "unsupported_model"
+	case ErrSwitchBusy:
+		return "switch_busy"
+	}
+	return "error"
+}
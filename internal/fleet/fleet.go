@@ -0,0 +1,171 @@
+// Package fleet builds sessions for every switch in the configuration
+// file, for the long-running modes that manage several switches at once.
+package fleet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"netgearcli/internal/config"
+	"netgearcli/internal/credentials"
+	"netgearcli/internal/errs"
+	"netgearcli/internal/hooks"
+	"netgearcli/internal/retry"
+	"netgearcli/internal/session"
+)
+
+// Options apply to every session in the fleet.
+type Options struct {
+	Debug       bool
+	Logf        func(format string, args ...interface{})
+	LockTimeout time.Duration
+	// Hooks are notified of every change made through Member.Change.
+	Hooks *hooks.Dispatcher
+}
+
+// Member is one configured switch and its session.
+type Member struct {
+	Config  config.Switch
+	Session *session.Session
+
+	lockTimeout time.Duration
+	hooks       *hooks.Dispatcher
+}
+
+// Fleet is the set of configured switches, keyed by name.
+type Fleet struct {
+	Options Options
+
+	members map[string]*Member
+	names   []string
+}
+
+// New resolves passwords and creates a session for each switch in cfg. A
+// switch with no password is kept; it can still use a cached token.
+func New(cfg *config.Config, opts Options) (*Fleet, error) {
+	if len(cfg.Switches) == 0 {
+		return nil, fmt.Errorf("no switches configured; add them to %s", config.DefaultPath())
+	}
+
+	f := &Fleet{Options: opts, members: make(map[string]*Member)}
+	policy := retry.Default.WithConfig(cfg.Retry)
+
+	for _, sw := range cfg.Switches {
+		if _, dup := f.members[sw.Name]; dup {
+			return nil, fmt.Errorf("switch %s is configured twice", sw.Name)
+		}
+
+		providers, err := credentials.ForSwitch(sw, credentials.Options{Vault: cfg.Vault})
+		if err != nil {
+			return nil, err
+		}
+		password, err := credentials.Resolve(sw, providers, nil)
+		if err != nil && !errors.Is(err, credentials.ErrNotFound) {
+			return nil, fmt.Errorf("failed to look up password for %s: %w", sw.Name, err)
+		}
+		if password == "" {
+			f.logf("No password found for %s; relying on its cached token", sw.Name)
+		}
+
+		sess := session.New(sw.Address, password)
+		sess.Opts.Verbose = opts.Debug
+		sess.Debug = opts.Debug
+		sess.Logf = opts.Logf
+		sess.Retry = policy
+
+		f.members[sw.Name] = &Member{Config: sw, Session: sess, lockTimeout: opts.LockTimeout, hooks: opts.Hooks}
+		f.names = append(f.names, sw.Name)
+	}
+	return f, nil
+}
+
+// Get returns the switch configured as name.
+func (f *Fleet) Get(name string) (*Member, bool) {
+	m, ok := f.members[name]
+	return m, ok
+}
+
+// Names returns the switch names in configuration order.
+func (f *Fleet) Names() []string {
+	return f.names
+}
+
+// Members returns every switch in configuration order.
+func (f *Fleet) Members() []*Member {
+	members := make([]*Member, 0, len(f.names))
+	for _, name := range f.names {
+		members = append(members, f.members[name])
+	}
+	return members
+}
+
+func (f *Fleet) logf(format string, args ...interface{}) {
+	if f.Options.Logf != nil {
+		f.Options.Logf(format, args...)
+	}
+}
+
+// Locked runs fn while holding the cross-process lock for the member's
+// switch, so the daemon and command-line runs take turns.
+func (m *Member) Locked(ctx context.Context, fn func(ctx context.Context) error) error {
+	unlock, err := m.Session.Lock(ctx, m.lockTimeout, nil)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return fn(ctx)
+}
+
+// Change enables, disables or cycles ports under the switch lock and
+// notifies the fleet's hooks, attributing the change to actor. The result
+// says which ports changed even when an error is returned.
+func (m *Member) Change(ctx context.Context, action string, ports []int, actor hooks.Actor) (*session.PortResult, error) {
+	var do func(ctx context.Context) *session.PortResult
+	switch action {
+	case hooks.EventEnable:
+		do = func(ctx context.Context) *session.PortResult { return m.Session.SetPower(ctx, ports, true) }
+	case hooks.EventDisable:
+		do = func(ctx context.Context) *session.PortResult { return m.Session.SetPower(ctx, ports, false) }
+	case hooks.EventCycle:
+		do = func(ctx context.Context) *session.PortResult { return m.Session.Cycle(ctx, ports) }
+	default:
+		return nil, fmt.Errorf("%w: unknown action %q (want enable, disable or cycle)", errs.ErrUsage, action)
+	}
+	return m.change(ctx, hooks.NewEvent(action, m.Config.Name, m.Config.Address, ports, actor), do)
+}
+
+// Configure sets the PoE settings in cfg on ports, such as their priority
+// or power limit, under the switch lock and notifies the fleet's hooks
+// like Change.
+func (m *Member) Configure(ctx context.Context, ports []int, cfg session.PortConfig, actor hooks.Actor) (*session.PortResult, error) {
+	event := hooks.NewEvent(hooks.EventConfigure, m.Config.Name, m.Config.Address, ports, actor)
+	event.Config = &cfg
+	return m.change(ctx, event, func(ctx context.Context) *session.PortResult {
+		return m.Session.SetConfig(ctx, ports, cfg)
+	})
+}
+
+// change runs do under the switch lock and reports event to the hooks.
+func (m *Member) change(ctx context.Context, event hooks.Event, do func(ctx context.Context) *session.PortResult) (*session.PortResult, error) {
+	var result *session.PortResult
+	start := time.Now()
+	err := m.Locked(ctx, func(ctx context.Context) error {
+		result, event = m.hooks.Change(ctx, m.Session, event, func() *session.PortResult { return do(ctx) })
+		return result.Err()
+	})
+	if result == nil {
+		// The lock was not acquired; nothing changed, but the attempt is
+		// still recorded
+		event.SetResult(nil, err)
+		event.Duration = hooks.Milliseconds(time.Since(start))
+		m.hooks.Record(event)
+		return nil, err
+	}
+	// Deliver even if ctx was canceled mid-change: what did change matters
+	fireCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+	defer cancel()
+	m.hooks.Fire(fireCtx, event)
+	return result, err
+}
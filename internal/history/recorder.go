@@ -0,0 +1,121 @@
+package history
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"netgearcli/internal/errs"
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/poe"
+)
+
+// Recorder samples the PoE status of every switch in a fleet into a Store.
+type Recorder struct {
+	Fleet    *fleet.Fleet
+	Store    *Store
+	Interval time.Duration
+	// Timeout bounds one poll of one switch. Defaults to Interval.
+	Timeout time.Duration
+	// Retention deletes month files once they are this old. Zero keeps
+	// everything.
+	Retention time.Duration
+	Logf      func(format string, args ...interface{})
+}
+
+// Run samples every switch once per Interval until ctx is done. Switches
+// are polled independently so one slow switch does not delay the others.
+func (r *Recorder) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	if r.Retention > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.prune(ctx)
+		}()
+	}
+	for _, m := range r.Fleet.Members() {
+		wg.Add(1)
+		go func(m *fleet.Member) {
+			defer wg.Done()
+			ticker := time.NewTicker(r.Interval)
+			defer ticker.Stop()
+			for {
+				r.Sample(ctx, m)
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(m)
+	}
+	wg.Wait()
+}
+
+// Sample records the current status of one switch.
+func (r *Recorder) Sample(ctx context.Context, m *fleet.Member) {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = r.Interval
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var statuses []poe.PortStatus
+	err := m.Locked(ctx, func(ctx context.Context) error {
+		var err error
+		statuses, err = m.Session.Status(ctx)
+		return err
+	})
+	if err != nil {
+		// A canceled poll is shutdown, not a switch failure
+		if errs.Class(errs.Classify(err)) != errs.ErrCanceled {
+			r.logf("Sampling %s failed: %v", m.Config.Name, err)
+		}
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	samples := make([]Sample, 0, len(statuses))
+	for _, s := range statuses {
+		samples = append(samples, Sample{
+			Time:        now,
+			Switch:      m.Config.Name,
+			Port:        s.Port,
+			Name:        s.Name,
+			Status:      s.Status,
+			Power:       s.Power,
+			Voltage:     s.Voltage,
+			Current:     s.Current,
+			Temperature: s.Temperature,
+		})
+	}
+	if err := r.Store.Append(samples); err != nil {
+		r.logf("Recording samples from %s failed: %v", m.Config.Name, err)
+	}
+}
+
+// prune removes expired month files now and then daily.
+func (r *Recorder) prune(ctx context.Context) {
+	for {
+		removed, err := r.Store.Prune(time.Now().Add(-r.Retention))
+		if err != nil {
+			r.logf("Pruning history failed: %v", err)
+		}
+		for _, path := range removed {
+			r.logf("Removed expired history file %s", path)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(24 * time.Hour):
+		}
+	}
+}
+
+func (r *Recorder) logf(format string, args ...interface{}) {
+	if r.Logf != nil {
+		r.Logf(format, args...)
+	}
+}
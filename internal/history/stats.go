@@ -0,0 +1,131 @@
+package history
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMaxGap is the longest interval between two samples that is
+// counted as continuous draw. Longer gaps, such as the recorder being
+// stopped, add no energy.
+const DefaultMaxGap = 10 * time.Minute
+
+// PortStats summarizes one port over a time range.
+type PortStats struct {
+	Switch  string    `json:"switch"`
+	Port    int       `json:"port"`
+	Name    string    `json:"name,omitempty"`
+	Samples int       `json:"samples"`
+	First   time.Time `json:"first"`
+	Last    time.Time `json:"last"`
+	Min     float64   `json:"min_w"`
+	Avg     float64   `json:"avg_w"`
+	Max     float64   `json:"max_w"`
+	// Energy is the draw integrated over time, in kilowatt-hours.
+	Energy float64 `json:"energy_kwh"`
+
+	sum  float64
+	last float64
+	// wattHours accumulates before conversion to kWh
+	wattHours float64
+}
+
+// Summary accumulates samples into per-port statistics.
+type Summary struct {
+	// MaxGap caps the time a sample's draw is assumed to last. Defaults to
+	// DefaultMaxGap.
+	MaxGap time.Duration
+
+	ports map[portKey]*PortStats
+}
+
+type portKey struct {
+	sw   string
+	port int
+}
+
+// Add accounts for one sample. Samples for a port must arrive in time
+// order, as Store.Scan returns them.
+func (s *Summary) Add(sample Sample) {
+	if s.ports == nil {
+		s.ports = make(map[portKey]*PortStats)
+	}
+	maxGap := s.MaxGap
+	if maxGap <= 0 {
+		maxGap = DefaultMaxGap
+	}
+
+	key := portKey{sample.Switch, sample.Port}
+	st, ok := s.ports[key]
+	if !ok {
+		st = &PortStats{Switch: sample.Switch, Port: sample.Port, First: sample.Time, Min: sample.Power, Max: sample.Power}
+		s.ports[key] = st
+	} else {
+		// The previous sample's draw lasts until this one, up to maxGap
+		if gap := sample.Time.Sub(st.Last); gap > 0 {
+			st.wattHours += st.last * min(gap, maxGap).Hours()
+		}
+	}
+	if sample.Name != "" {
+		st.Name = sample.Name
+	}
+	st.Samples++
+	st.sum += sample.Power
+	st.Min = min(st.Min, sample.Power)
+	st.Max = max(st.Max, sample.Power)
+	st.Last = sample.Time
+	st.last = sample.Power
+}
+
+// Ports returns the statistics sorted by switch and port.
+func (s *Summary) Ports() []PortStats {
+	stats := make([]PortStats, 0, len(s.ports))
+	for _, st := range s.ports {
+		p := *st
+		p.Avg = math.Round(p.sum/float64(p.Samples)*100) / 100
+		p.Energy = p.wattHours / 1000
+		stats = append(stats, p)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Switch != stats[j].Switch {
+			return stats[i].Switch < stats[j].Switch
+		}
+		return stats[i].Port < stats[j].Port
+	})
+	return stats
+}
+
+// ParseTime parses a time given on the command line: RFC 3339, or a local
+// date with an optional time such as "2025-03-04" or "2025-03-04 18:30".
+func ParseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (want e.g. 2025-03-04, \"2025-03-04 18:30\" or RFC 3339)", s)
+}
+
+// ParseSpan parses a duration that may be given in days, such as "7d" or
+// "36h".
+func ParseSpan(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid span %q", s)
+		}
+		return time.Duration(n * 24 * float64(time.Hour)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid span %q (want e.g. 24h or 7d)", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,253 @@
+// Package history records PoE samples to local storage and summarizes them,
+// so questions such as "how much did the cameras draw last month" can be
+// answered. Samples are appended to one CSV file per month, which keeps the
+// store readable with ordinary tools and cheap to prune.
+package history
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sample is one port's state at one time.
+type Sample struct {
+	Time        time.Time `json:"time"`
+	Switch      string    `json:"switch"`
+	Port        int       `json:"port"`
+	Name        string    `json:"name,omitempty"`
+	Status      string    `json:"status"`
+	Power       float64   `json:"power_w"`
+	Voltage     float64   `json:"voltage_v"`
+	Current     float64   `json:"current_ma"`
+	Temperature float64   `json:"temperature_c"`
+}
+
+var header = []string{"time", "switch", "port", "name", "status", "power_w", "voltage_v", "current_ma", "temperature_c"}
+
+// monthLayout names the file holding a month's samples, e.g. 2025-03.csv.
+const monthLayout = "2006-01"
+
+// DefaultDir returns $XDG_DATA_HOME/netgear/history, or
+// ~/.local/share/netgear/history.
+func DefaultDir() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "netgear", "history")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "netgear-history")
+	}
+	return filepath.Join(home, ".local", "share", "netgear", "history")
+}
+
+// Store is a directory of monthly CSV files. It is safe for concurrent use
+// within a process; use one recorder per directory.
+type Store struct {
+	Dir string
+
+	mu sync.Mutex
+}
+
+func (s *Store) path(month time.Time) string {
+	return filepath.Join(s.Dir, month.UTC().Format(monthLayout)+".csv")
+}
+
+// Append writes samples to the files for their months.
+func (s *Store) Append(samples []Sample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	byFile := make(map[string][]Sample)
+	for _, sample := range samples {
+		path := s.path(sample.Time)
+		byFile[path] = append(byFile[path], sample)
+	}
+	for path, samples := range byFile {
+		if err := appendFile(path, samples); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendFile(path string, samples []Sample) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Build the rows in memory and write them at once, so a crash leaves at
+	// most one torn line at the end of the file
+	var buf strings.Builder
+	w := csv.NewWriter(&buf)
+	if info.Size() == 0 {
+		w.Write(header)
+	}
+	for _, s := range samples {
+		w.Write([]string{
+			s.Time.UTC().Format(time.RFC3339),
+			s.Switch,
+			strconv.Itoa(s.Port),
+			s.Name,
+			s.Status,
+			formatFloat(s.Power),
+			formatFloat(s.Voltage),
+			formatFloat(s.Current),
+			formatFloat(s.Temperature),
+		})
+	}
+	w.Flush()
+	if _, err := f.WriteString(buf.String()); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// Scan calls fn for every sample with from <= time < to, in file order,
+// which is time order for a single recorder. Malformed rows, such as one
+// torn by a crash, are skipped.
+func (s *Store) Scan(from, to time.Time, fn func(Sample) error) error {
+	files, err := s.files(from, to)
+	if err != nil {
+		return err
+	}
+	for _, path := range files {
+		if err := scanFile(path, from, to, fn); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// files lists the month files that may hold samples between from and to.
+func (s *Store) files(from, to time.Time) ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	first := monthStart(from)
+	var files []string
+	for _, e := range entries {
+		month, err := time.Parse(monthLayout, strings.TrimSuffix(e.Name(), ".csv"))
+		if err != nil || !strings.HasSuffix(e.Name(), ".csv") {
+			continue
+		}
+		if !month.Before(first) && month.Before(to) {
+			files = append(files, filepath.Join(s.Dir, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func scanFile(path string, from, to time.Time, fn func(Sample) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(bufio.NewReader(f))
+	r.FieldsPerRecord = -1
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				continue
+			}
+			return err
+		}
+		sample, ok := parseRecord(rec)
+		if !ok || sample.Time.Before(from) || !sample.Time.Before(to) {
+			continue
+		}
+		if err := fn(sample); err != nil {
+			return err
+		}
+	}
+}
+
+// parseRecord decodes a row; the header and torn rows do not parse.
+func parseRecord(rec []string) (Sample, bool) {
+	if len(rec) != len(header) {
+		return Sample{}, false
+	}
+	t, err := time.Parse(time.RFC3339, rec[0])
+	if err != nil {
+		return Sample{}, false
+	}
+	port, err := strconv.Atoi(rec[2])
+	if err != nil {
+		return Sample{}, false
+	}
+	var nums [4]float64
+	for i := range nums {
+		if nums[i], err = strconv.ParseFloat(rec[5+i], 64); err != nil {
+			return Sample{}, false
+		}
+	}
+	return Sample{
+		Time:        t,
+		Switch:      rec[1],
+		Port:        port,
+		Name:        rec[3],
+		Status:      rec[4],
+		Power:       nums[0],
+		Voltage:     nums[1],
+		Current:     nums[2],
+		Temperature: nums[3],
+	}, true
+}
+
+// Prune deletes month files that ended before cutoff.
+func (s *Store) Prune(cutoff time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := s.files(time.Time{}, monthStart(cutoff))
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, path := range files {
+		if err := os.Remove(path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,156 @@
+package hooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"os/user"
+	"time"
+
+	"netgearcli/internal/errs"
+	"netgearcli/internal/poe"
+	"netgearcli/internal/session"
+)
+
+// Event names
+const (
+	EventEnable       = "enable"
+	EventDisable      = "disable"
+	EventCycle        = "cycle"
+	EventConfigure    = "configure"
+	EventStatusChange = "status_change"
+)
+
+// Event is the payload sent to hooks.
+type Event struct {
+	ID      string    `json:"id"`
+	Time    time.Time `json:"time"`
+	Event   string    `json:"event"`
+	Switch  string    `json:"switch"`
+	Address string    `json:"address,omitempty"`
+	Ports   []int     `json:"ports"`
+	Actor   Actor     `json:"actor"`
+	// Result is "ok" or the error class name, such as "partial_failure".
+	Result string              `json:"result"`
+	Error  string              `json:"error,omitempty"`
+	Detail *session.PortResult `json:"detail,omitempty"`
+	// Config is what a configure event set on the ports.
+	Config *session.PortConfig `json:"config,omitempty"`
+	Before []PortState         `json:"before,omitempty"`
+	After  []PortState         `json:"after,omitempty"`
+	// Duration of the change in milliseconds, excluding the state reads.
+	Duration float64 `json:"duration_ms"`
+}
+
+// Milliseconds converts d for Event.Duration.
+func Milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// Actor says who or what made a change.
+type Actor struct {
+	User string `json:"user,omitempty"`
+	Host string `json:"host,omitempty"`
+	// Source is the tool or mode: "poe-management", "api", "mqtt",
+	// "schedule", "watchdog", "monitor", "top", "poe-status" or "drift".
+	Source string `json:"source"`
+	// Remote is the API client's address.
+	Remote string `json:"remote,omitempty"`
+	// Reason explains automatic changes, such as the schedule rule or the
+	// watchdog check that failed.
+	Reason string `json:"reason,omitempty"`
+}
+
+// CurrentActor returns an Actor for this process's user and host.
+func CurrentActor(source string) Actor {
+	a := Actor{Source: source}
+	if u, err := user.Current(); err == nil {
+		a.User = u.Username
+	}
+	// sudo runs are attributed to the person, not root
+	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" {
+		a.User = sudoUser
+	}
+	a.Host, _ = os.Hostname()
+	return a
+}
+
+// PortState is one port's state before or after a change.
+type PortState struct {
+	Port   int     `json:"port"`
+	Name   string  `json:"name,omitempty"`
+	Admin  string  `json:"admin,omitempty"`
+	Status string  `json:"status,omitempty"`
+	Power  float64 `json:"power_w"`
+}
+
+// Snapshot reads the current state of ports from the switch.
+func Snapshot(ctx context.Context, sess *session.Session, ports []int) ([]PortState, error) {
+	settings, err := sess.Settings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := sess.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return States(ports, settings, statuses), nil
+}
+
+// States combines settings and status rows into states for ports, in the
+// order given.
+func States(ports []int, settings []poe.PortSettings, statuses []poe.PortStatus) []PortState {
+	byPort := make(map[int]*PortState)
+	states := make([]PortState, len(ports))
+	for i, p := range ports {
+		states[i].Port = p
+		byPort[p] = &states[i]
+	}
+	for _, s := range settings {
+		if st, ok := byPort[s.Port]; ok {
+			st.Name = s.Name
+			st.Admin = "disabled"
+			if s.Enabled() {
+				st.Admin = "enabled"
+			}
+		}
+	}
+	for _, s := range statuses {
+		if st, ok := byPort[s.Port]; ok {
+			if st.Name == "" {
+				st.Name = s.Name
+			}
+			st.Status = s.Status
+			st.Power = s.Power
+		}
+	}
+	return states
+}
+
+// NewEvent returns an event with a fresh ID and the current time.
+func NewEvent(event, sw, address string, ports []int, actor Actor) Event {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return Event{
+		ID:      hex.EncodeToString(id),
+		Time:    time.Now().UTC(),
+		Event:   event,
+		Switch:  sw,
+		Address: address,
+		Ports:   ports,
+		Actor:   actor,
+		Result:  "ok",
+	}
+}
+
+// SetResult records the outcome of the change.
+func (e *Event) SetResult(result *session.PortResult, err error) {
+	e.Detail = result
+	e.Result = "ok"
+	e.Error = ""
+	if err != nil {
+		e.Result = errs.Name(err)
+		e.Error = err.Error()
+	}
+}
@@ -0,0 +1,292 @@
+// Package hooks notifies other systems, such as a ticketing system, of PoE
+// changes by POSTing a JSON event to a URL or running a local command with
+// the event on stdin. Webhook bodies can be signed with HMAC-SHA256, and
+// failed deliveries are retried with backoff.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"netgearcli/internal/config"
+	"netgearcli/internal/retry"
+	"netgearcli/internal/session"
+)
+
+// client delivers webhooks. Its transport is cloned from
+// http.DefaultTransport before session.BindDefaultTransport wraps it, so
+// events about a change still go out after an interrupt, a --timeout or
+// during server shutdown cancels the switch requests. Each delivery is
+// bounded by the hook's own timeout instead.
+var client = &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()}
+
+// SignatureHeader carries "sha256=<hex HMAC of the body>" when a secret is
+// configured.
+const SignatureHeader = "X-Netgear-Signature-256"
+
+// Hook is one configured destination.
+type Hook struct {
+	Events  []string
+	URL     string
+	Secret  string
+	Command string
+	Timeout time.Duration
+	Retry   retry.Policy
+}
+
+// Recorder receives every event, with port state, whether or not a hook
+// wants it. The audit log is a Recorder.
+type Recorder interface {
+	Record(e Event)
+}
+
+// Dispatcher delivers events to hooks and recorders. A nil Dispatcher has
+// neither.
+type Dispatcher struct {
+	Hooks     []Hook
+	Recorders []Recorder
+	Logf      func(format string, args ...interface{})
+}
+
+// New builds a dispatcher from the hooks section of the config.
+func New(cfg []config.Hook) (*Dispatcher, error) {
+	d := &Dispatcher{}
+	for i, hc := range cfg {
+		if (hc.URL == "") == (hc.Command == "") {
+			return nil, fmt.Errorf("hook %d: set exactly one of url and command", i+1)
+		}
+		for _, ev := range hc.Events {
+			switch ev {
+			case EventEnable, EventDisable, EventCycle, EventConfigure, EventStatusChange:
+			default:
+				return nil, fmt.Errorf("hook %d: unknown event %q", i+1, ev)
+			}
+		}
+		h := Hook{
+			Events:  hc.Events,
+			URL:     hc.URL,
+			Secret:  hc.Secret,
+			Command: hc.Command,
+			Timeout: 10 * time.Second,
+			Retry:   retry.Policy{MaxAttempts: 4, InitialDelay: time.Second, MaxDelay: 30 * time.Second, Multiplier: 2, Jitter: 0.2},
+		}
+		if hc.SecretFile != "" {
+			data, err := os.ReadFile(hc.SecretFile)
+			if err != nil {
+				return nil, fmt.Errorf("hook %d: %w", i+1, err)
+			}
+			h.Secret = strings.TrimSpace(string(data))
+		}
+		if hc.Timeout > 0 {
+			h.Timeout = time.Duration(hc.Timeout)
+		}
+		if hc.Retries != nil {
+			h.Retry.MaxAttempts = *hc.Retries + 1
+		}
+		d.Hooks = append(d.Hooks, h)
+	}
+	return d, nil
+}
+
+func (h Hook) wants(event string) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, ev := range h.Events {
+		if ev == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Wants reports whether any hook or recorder listens for event.
+func (d *Dispatcher) Wants(event string) bool {
+	if d == nil {
+		return false
+	}
+	if len(d.Recorders) > 0 {
+		return true
+	}
+	for _, h := range d.Hooks {
+		if h.wants(event) {
+			return true
+		}
+	}
+	return false
+}
+
+// Change runs do and fills in e's result. When a hook or recorder wants the
+// event, the ports' state is read before and after, on the same session and
+// under the caller's lock. Fire the returned event once the lock is released.
+func (d *Dispatcher) Change(ctx context.Context, sess *session.Session, e Event, do func() *session.PortResult) (*session.PortResult, Event) {
+	wanted := d.Wants(e.Event)
+	if wanted {
+		before, err := Snapshot(ctx, sess, e.Ports)
+		if err != nil {
+			d.logf("Reading state of %s before %s failed: %v", e.Switch, e.Event, err)
+		}
+		e.Before = before
+	}
+
+	start := time.Now()
+	result := do()
+	e.Duration = Milliseconds(time.Since(start))
+	err := result.Err()
+	e.SetResult(result, err)
+
+	if wanted && len(result.Changed) > 0 && ctx.Err() == nil {
+		after, err := Snapshot(ctx, sess, e.Ports)
+		if err != nil {
+			d.logf("Reading state of %s after %s failed: %v", e.Switch, e.Event, err)
+		}
+		e.After = after
+	}
+	return result, e
+}
+
+// Record passes e to the recorders only, for attempts that changed nothing
+// such as a failed login.
+func (d *Dispatcher) Record(e Event) {
+	if d == nil {
+		return
+	}
+	for _, r := range d.Recorders {
+		r.Record(e)
+	}
+}
+
+// Fire records e and delivers it to every hook that wants it, retrying
+// failures. It returns once every delivery has succeeded or given up.
+func (d *Dispatcher) Fire(ctx context.Context, e Event) {
+	if !d.Wants(e.Event) {
+		return
+	}
+	d.Record(e)
+	body, err := json.Marshal(e)
+	if err != nil {
+		d.logf("Encoding %s event failed: %v", e.Event, err)
+		return
+	}
+	for _, h := range d.Hooks {
+		if !h.wants(e.Event) {
+			continue
+		}
+		notify := func(attempt int, err error, delay time.Duration) {
+			d.logf("Hook %s attempt %d failed: %v; retrying in %s", h.target(), attempt, err, delay.Round(time.Millisecond))
+		}
+		err := h.Retry.Do(ctx, retryable, notify, func() error {
+			return h.deliver(ctx, e, body)
+		})
+		if err != nil {
+			d.logf("Hook %s for %s on %s failed: %v", h.target(), e.Event, e.Switch, err)
+		}
+	}
+}
+
+// permanentError is a delivery failure that retrying will not fix
+type permanentError struct{ error }
+
+func retryable(err error) bool {
+	var p permanentError
+	return !errors.As(err, &p)
+}
+
+func (h Hook) deliver(ctx context.Context, e Event, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, h.Timeout)
+	defer cancel()
+	if h.URL != "" {
+		return h.post(ctx, e, body)
+	}
+	return h.exec(ctx, e, body)
+}
+
+func (h Hook) post(ctx context.Context, e Event, body []byte) error {
+	header := http.Header{}
+	header.Set("User-Agent", "netgearcli-hooks")
+	header.Set("X-Netgear-Event", e.Event)
+	header.Set("X-Netgear-Delivery", e.ID)
+	return PostJSON(ctx, h.URL, body, header, h.Secret)
+}
+
+func (h Hook) exec(ctx context.Context, e Event, body []byte) error {
+	return RunCommand(ctx, h.Command, body,
+		"NETGEAR_EVENT="+e.Event,
+		"NETGEAR_SWITCH="+e.Switch,
+		"NETGEAR_RESULT="+e.Result,
+	)
+}
+
+// PostJSON POSTs body to url with header, signing it when secret is set.
+// Monitor alerts are delivered with it too. A 429 or 5xx response may be
+// retried; other failures are permanent.
+func PostJSON(ctx context.Context, url string, body []byte, header http.Header, secret string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set(SignatureHeader, Sign(secret, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return permanentError{fmt.Errorf("%s returned %s", url, resp.Status)}
+}
+
+// RunCommand runs command through the shell with body on stdin and env
+// added to the environment. The error includes the command's output.
+func RunCommand(ctx context.Context, command string, body []byte, env ...string) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(), env...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+func (h Hook) target() string {
+	if h.URL != "" {
+		return h.URL
+	}
+	return fmt.Sprintf("%q", h.Command)
+}
+
+// Sign returns the signature header value for body: "sha256=" followed by
+// the hex HMAC-SHA256 of body keyed with secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *Dispatcher) logf(format string, args ...interface{}) {
+	if d != nil && d.Logf != nil {
+		d.Logf(format, args...)
+	}
+}
@@ -0,0 +1,190 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"netgearcli/internal/retry"
+	"netgearcli/internal/session"
+)
+
+func TestPostJSON(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		secret        string
+		wantErr       bool
+		wantPermanent bool
+	}{
+		{name: "ok", status: http.StatusNoContent},
+		{name: "signed", status: http.StatusOK, secret: "s3cret"},
+		{name: "server error", status: http.StatusBadGateway, wantErr: true},
+		{name: "rate limited", status: http.StatusTooManyRequests, wantErr: true},
+		{name: "rejected", status: http.StatusForbidden, wantErr: true, wantPermanent: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := []byte(`{"event":"enable"}`)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ := io.ReadAll(r.Body)
+				if string(got) != string(body) {
+					t.Errorf("body = %s", got)
+				}
+				if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+					t.Errorf("Content-Type = %q", ct)
+				}
+				if r.Header.Get("X-Netgear-Event") != "enable" {
+					t.Errorf("X-Netgear-Event = %q", r.Header.Get("X-Netgear-Event"))
+				}
+				sig := r.Header.Get(SignatureHeader)
+				if tt.secret == "" && sig != "" {
+					t.Errorf("unsigned request has signature %q", sig)
+				}
+				if tt.secret != "" && sig != Sign(tt.secret, body) {
+					t.Errorf("signature = %q, want %q", sig, Sign(tt.secret, body))
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			header := http.Header{}
+			header.Set("X-Netgear-Event", "enable")
+			err := PostJSON(context.Background(), server.URL, body, header, tt.secret)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && retryable(err) == tt.wantPermanent {
+				t.Errorf("retryable(%v) = %v", err, retryable(err))
+			}
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	// echo -n 'hello' | openssl dgst -sha256 -hmac key
+	want := "sha256=9307b3b915efb5171ff14d8cb55fbcc798c6c0ef1456d66ded1a6aa723a58b7b"
+	if got := Sign("key", []byte("hello")); got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	err := RunCommand(context.Background(), `cat > "$OUT"; echo "$NETGEAR_EVENT" >> "$OUT"`, []byte("body\n"), "OUT="+out, "NETGEAR_EVENT=cycle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(out)
+	if string(data) != "body\ncycle\n" {
+		t.Errorf("command saw %q", data)
+	}
+
+	err = RunCommand(context.Background(), "echo broken >&2; exit 2", nil)
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("error = %v, want the command's output", err)
+	}
+}
+
+func TestFireRetries(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var e Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil || e.Event != EventCycle {
+			t.Errorf("event = %+v, %v", e, err)
+		}
+	}))
+	defer server.Close()
+
+	d := &Dispatcher{Hooks: []Hook{{
+		URL:     server.URL,
+		Timeout: time.Second,
+		Retry:   retry.Policy{MaxAttempts: 4, InitialDelay: time.Millisecond},
+	}}}
+	d.Fire(context.Background(), Event{Event: EventCycle, Switch: "sw1"})
+	if n := attempts.Load(); n != 3 {
+		t.Errorf("attempts = %d, want 3", n)
+	}
+}
+
+func TestFireSkipsUnwantedEvents(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+	}))
+	defer server.Close()
+
+	d := &Dispatcher{Hooks: []Hook{{URL: server.URL, Events: []string{EventCycle}, Timeout: time.Second}}}
+	d.Fire(context.Background(), Event{Event: EventEnable})
+	if attempts.Load() != 0 {
+		t.Error("hook for cycle received an enable event")
+	}
+	if d.Wants(EventEnable) || !d.Wants(EventCycle) {
+		t.Error("Wants does not follow the hook's events")
+	}
+	var none *Dispatcher
+	if none.Wants(EventCycle) {
+		t.Error("nil dispatcher wants events")
+	}
+}
+
+func TestPermanentErrorStopsRetries(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	d := &Dispatcher{Hooks: []Hook{{
+		URL:     server.URL,
+		Timeout: time.Second,
+		Retry:   retry.Policy{MaxAttempts: 4, InitialDelay: time.Millisecond},
+	}}}
+	d.Fire(context.Background(), Event{Event: EventDisable})
+	if n := attempts.Load(); n != 1 {
+		t.Errorf("attempts = %d, want 1", n)
+	}
+	var p permanentError
+	if !errors.As(PostJSON(context.Background(), server.URL, nil, nil, ""), &p) {
+		t.Error("401 is not a permanent error")
+	}
+}
+
+func TestDeliveryAfterBoundContextIsCanceled(t *testing.T) {
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer server.Close()
+
+	// As after Ctrl-C: the switch requests are canceled, the event about
+	// the change they made must still be delivered
+	saved := http.DefaultTransport
+	t.Cleanup(func() { http.DefaultTransport = saved })
+	ctx, cancel := context.WithCancel(context.Background())
+	session.BindDefaultTransport(ctx, 0)
+	cancel()
+
+	if _, err := http.Get(server.URL); err == nil {
+		t.Fatal("bound transport still sends requests")
+	}
+	d := &Dispatcher{Hooks: []Hook{{URL: server.URL, Timeout: time.Second}}}
+	d.Fire(context.Background(), Event{Event: EventDisable, Switch: "sw1"})
+	if n := received.Load(); n != 1 {
+		t.Errorf("hook received %d events, want 1", n)
+	}
+}
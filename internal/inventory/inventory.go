@@ -0,0 +1,150 @@
+// Package inventory describes every managed switch: its model and series,
+// firmware, port count, PoE budget and whether its cached login token is
+// still good. What is learned is cached in the token metadata.
+package inventory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/poe"
+	"netgearcli/internal/probe"
+	"netgearcli/internal/session"
+)
+
+// Token states
+const (
+	// TokenValid is a cached token the switch accepted.
+	TokenValid = "valid"
+	// TokenRenewed means there was no usable token and a fresh login
+	// succeeded.
+	TokenRenewed = "renewed"
+	// TokenUnchecked is a cached token that could not be tried because the
+	// switch did not answer.
+	TokenUnchecked = "unchecked"
+	// TokenNone means there is no token and logging in failed.
+	TokenNone = "none"
+)
+
+// Entry is one switch in the inventory.
+type Entry struct {
+	Name     string  `json:"name"`
+	Address  string  `json:"address"`
+	Model    string  `json:"model,omitempty"`
+	Series   string  `json:"series,omitempty"`
+	Firmware string  `json:"firmware,omitempty"`
+	Ports    int     `json:"ports,omitempty"`
+	Budget   float64 `json:"poe_budget_w,omitempty"`
+	Token    string  `json:"token"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// Collector describes switches.
+type Collector struct {
+	Members []*fleet.Member
+	// Timeout bounds describing one switch. Defaults to 1m.
+	Timeout time.Duration
+	// Logf receives failures that do not fail an entry, such as not being
+	// able to cache what was learned. It may be nil.
+	Logf func(format string, args ...interface{})
+}
+
+// Collect logs in to every member in parallel through its session and
+// describes it. Entries are sorted by name.
+func (c *Collector) Collect(ctx context.Context) []Entry {
+	entries := make([]Entry, len(c.Members))
+	var wg sync.WaitGroup
+	for i, m := range c.Members {
+		wg.Add(1)
+		go func(i int, m *fleet.Member) {
+			defer wg.Done()
+			entries[i] = c.describe(ctx, m)
+		}(i, m)
+	}
+	wg.Wait()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+// describe logs in to one switch, counts its ports and identifies it.
+func (c *Collector) describe(ctx context.Context, m *fleet.Member) Entry {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	sess := m.Session
+	e := Entry{Name: m.Config.Name, Address: m.Config.Address}
+	cached, _ := sess.Metadata()
+
+	hadToken := sess.HasToken()
+	loginsBefore, _ := sess.Logins()
+	var statuses []poe.PortStatus
+	err := m.Locked(ctx, func(ctx context.Context) error {
+		if err := sess.EnsureAuthenticated(ctx); err != nil {
+			return err
+		}
+		var err error
+		statuses, err = sess.Status(ctx)
+		return err
+	})
+	loginsAfter, _ := sess.Logins()
+	switch {
+	case err == nil && loginsAfter == loginsBefore:
+		e.Token = TokenValid
+	case err == nil:
+		e.Token = TokenRenewed
+	case hadToken && sess.HasToken():
+		e.Token = TokenUnchecked
+	default:
+		e.Token = TokenNone
+	}
+
+	// The model is configured, recorded with the token by the library, or
+	// read from the login page
+	e.Model = m.Config.Model
+	if e.Model == "" {
+		e.Model = sess.Model()
+	}
+	e.Series = probe.ModelSeries(e.Model)
+	if e.Model == "" {
+		if id, err := probe.Identify(ctx, sess.HTTPClient(), m.Config.Address); err == nil {
+			e.Model, e.Series = id.Model, id.Series
+		}
+	}
+	e.Budget, _ = poe.ResolveBudget(e.Model, m.Config.PoEBudget)
+
+	if err != nil {
+		e.Error = err.Error()
+		e.Firmware = cached.Firmware
+		e.Ports = cached.Ports
+		return e
+	}
+	e.Ports = len(statuses)
+
+	// Firmware is best effort: keep the last known version if the page
+	// cannot be read
+	e.Firmware = cached.Firmware
+	if e.Series != "" {
+		if fw, err := probe.Firmware(ctx, sess.HTTPClient(), m.Config.Address, e.Series, sess.Token()); err == nil && fw != "" {
+			e.Firmware = fw
+		}
+	}
+
+	err = sess.SaveMetadata(session.Metadata{Model: e.Model, Firmware: e.Firmware, Ports: e.Ports, Updated: time.Now().UTC()})
+	if err != nil {
+		c.logf("Caching what was learned about %s failed: %v", m.Config.Name, err)
+	}
+	return e
+}
+
+func (c *Collector) logf(format string, args ...interface{}) {
+	if c.Logf != nil {
+		c.Logf(format, args...)
+	}
+}
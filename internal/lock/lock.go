@@ -0,0 +1,96 @@
+// Package lock provides an advisory, cross-process file lock so that
+// concurrent invocations against the same switch take turns.
+//
+// The lock is held on an open file descriptor, so the operating system
+// releases it when the process exits, even after a crash.
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrTimeout is returned when the lock could not be taken in time.
+var ErrTimeout = errors.New("timed out waiting for lock")
+
+// pollInterval is how often a held lock is retried.
+const pollInterval = 100 * time.Millisecond
+
+// Lock is a held file lock.
+type Lock struct {
+	file *os.File
+}
+
+// Acquire takes the lock at path, waiting up to timeout for another
+// process to release it. waiting, if non-nil, is called once with the PID
+// of the current holder (0 if unknown) when the lock is found busy.
+func Acquire(ctx context.Context, path string, timeout time.Duration, waiting func(holder int)) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	notified := false
+	for {
+		locked, err := tryLock(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if locked {
+			// Record the holder for anyone who has to wait
+			file.Truncate(0)
+			file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+			return &Lock{file: file}, nil
+		}
+
+		if !notified && waiting != nil {
+			waiting(holder(path))
+			notified = true
+		}
+		if !time.Now().Before(deadline) {
+			file.Close()
+			return nil, fmt.Errorf("%w %s (held by pid %d)", ErrTimeout, path, holder(path))
+		}
+
+		select {
+		case <-ctx.Done():
+			file.Close()
+			return nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// Release unlocks and closes the lock file. The file itself is left in
+// place; removing it would race with a process about to lock it.
+func (l *Lock) Release() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	l.file.Truncate(0)
+	unlock(l.file)
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// holder reads the PID written by the current lock holder.
+func holder(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
+}
@@ -0,0 +1,285 @@
+// Package metrics polls PoE status from a fleet of switches and serves it
+// in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"netgearcli/internal/errs"
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/poe"
+)
+
+// Exporter polls every switch in a fleet and remembers the latest sample.
+type Exporter struct {
+	Fleet    *fleet.Fleet
+	Interval time.Duration
+	// Timeout bounds one poll of one switch. Defaults to Interval.
+	Timeout time.Duration
+	Logf    func(format string, args ...interface{})
+
+	mu       sync.Mutex
+	switches map[string]*switchState
+	// logins reads a member's login counts; tests replace it
+	logins func(m *fleet.Member) (succeeded, failed int64)
+}
+
+// switchState is what the exporter knows about one switch.
+type switchState struct {
+	address  string
+	ports    []poe.PortStatus
+	up       bool
+	last     time.Time
+	duration time.Duration
+	scrapes  int64
+	// errors counts failed polls by error class
+	errors map[string]int64
+}
+
+// Run polls every switch once per Interval until ctx is done. Switches are
+// polled independently so one slow switch does not delay the others.
+func (e *Exporter) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, m := range e.Fleet.Members() {
+		wg.Add(1)
+		go func(m *fleet.Member) {
+			defer wg.Done()
+			ticker := time.NewTicker(e.Interval)
+			defer ticker.Stop()
+			for {
+				e.Poll(ctx, m)
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(m)
+	}
+	wg.Wait()
+}
+
+// Poll reads the PoE status of one switch and records the result.
+func (e *Exporter) Poll(ctx context.Context, m *fleet.Member) {
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = e.Interval
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	var ports []poe.PortStatus
+	err := m.Locked(ctx, func(ctx context.Context) error {
+		var err error
+		ports, err = m.Session.Status(ctx)
+		return err
+	})
+	e.record(m, start, time.Since(start), ports, err)
+}
+
+// record remembers the outcome of one poll that started at start.
+func (e *Exporter) record(m *fleet.Member, start time.Time, elapsed time.Duration, ports []poe.PortStatus, err error) {
+	if err != nil && errs.Class(errs.Classify(err)) == errs.ErrCanceled {
+		// Shutting down, not a switch failure
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	st := e.state(m)
+	st.scrapes++
+	st.last = start
+	st.duration = elapsed
+	if err != nil {
+		st.up = false
+		st.errors[errs.Name(err)]++
+		e.logf("Polling %s failed: %v", m.Config.Name, err)
+		return
+	}
+	st.up = true
+	st.ports = ports
+}
+
+func (e *Exporter) state(m *fleet.Member) *switchState {
+	if e.switches == nil {
+		e.switches = make(map[string]*switchState)
+	}
+	st, ok := e.switches[m.Config.Name]
+	if !ok {
+		st = &switchState{address: m.Config.Address, errors: make(map[string]int64)}
+		e.switches[m.Config.Name] = st
+	}
+	return st
+}
+
+// ServeHTTP serves the latest samples as a Prometheus scrape.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	e.WriteTo(w)
+}
+
+// metric is one metric family in the exposition output.
+type metric struct {
+	name, help, kind string
+	samples          []sample
+}
+
+type sample struct {
+	labels string
+	value  float64
+}
+
+func (m *metric) add(value float64, labels ...string) {
+	m.samples = append(m.samples, sample{labels: formatLabels(labels), value: value})
+}
+
+// WriteTo writes the latest samples in the Prometheus text format.
+func (e *Exporter) WriteTo(w io.Writer) (int64, error) {
+	power := &metric{name: "netgear_poe_port_power_watts", help: "Power delivered on the port.", kind: "gauge"}
+	voltage := &metric{name: "netgear_poe_port_voltage_volts", help: "Output voltage on the port.", kind: "gauge"}
+	current := &metric{name: "netgear_poe_port_current_amperes", help: "Output current on the port.", kind: "gauge"}
+	temperature := &metric{name: "netgear_poe_port_temperature_celsius", help: "Port temperature.", kind: "gauge"}
+	delivering := &metric{name: "netgear_poe_port_delivering", help: "1 if the port is delivering power.", kind: "gauge"}
+	fault := &metric{name: "netgear_poe_port_error", help: "1 if the port reports an error status.", kind: "gauge"}
+	info := &metric{name: "netgear_poe_port_info", help: "Port status and power class as labels; always 1.", kind: "gauge"}
+	up := &metric{name: "netgear_up", help: "1 if the last poll of the switch succeeded.", kind: "gauge"}
+	scrapes := &metric{name: "netgear_scrapes_total", help: "Polls of the switch.", kind: "counter"}
+	scrapeErrors := &metric{name: "netgear_scrape_errors_total", help: "Failed polls of the switch by error class.", kind: "counter"}
+	duration := &metric{name: "netgear_scrape_duration_seconds", help: "How long the last poll took.", kind: "gauge"}
+	last := &metric{name: "netgear_last_scrape_timestamp_seconds", help: "When the last poll started.", kind: "gauge"}
+	loginsTotal := &metric{name: "netgear_logins_total", help: "Successful logins to the switch.", kind: "counter"}
+	loginFailures := &metric{name: "netgear_login_failures_total", help: "Logins that failed after all retries.", kind: "counter"}
+
+	e.mu.Lock()
+	for _, m := range e.Fleet.Members() {
+		name := m.Config.Name
+		succeeded, failed := m.Session.Logins()
+		if e.logins != nil {
+			succeeded, failed = e.logins(m)
+		}
+		loginsTotal.add(float64(succeeded), "switch", name)
+		loginFailures.add(float64(failed), "switch", name)
+
+		st, ok := e.switches[name]
+		if !ok {
+			continue
+		}
+		upValue := 0.0
+		if st.up {
+			upValue = 1
+		}
+		up.add(upValue, "switch", name, "address", st.address)
+		scrapes.add(float64(st.scrapes), "switch", name)
+		classes := make([]string, 0, len(st.errors))
+		for class := range st.errors {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		for _, class := range classes {
+			scrapeErrors.add(float64(st.errors[class]), "switch", name, "class", class)
+		}
+		duration.add(st.duration.Seconds(), "switch", name)
+		last.add(float64(st.last.UnixMilli())/1000, "switch", name)
+
+		// Port samples are only exported while the switch answers, so
+		// stale readings do not look current
+		if !st.up {
+			continue
+		}
+		for _, p := range st.ports {
+			labels := []string{"switch", name, "port", strconv.Itoa(p.Port), "label", p.Name}
+			power.add(p.Power, labels...)
+			voltage.add(p.Voltage, labels...)
+			current.add(p.Current/1000, labels...)
+			temperature.add(p.Temperature, labels...)
+			delivering.add(boolValue(p.Delivering()), labels...)
+			fault.add(boolValue(p.Faulted()), labels...)
+			info.add(1, append(labels, "status", p.Status, "class", p.Class)...)
+		}
+	}
+	e.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, m := range []*metric{power, voltage, current, temperature, delivering, fault, info,
+		up, scrapes, scrapeErrors, duration, last, loginsTotal, loginFailures} {
+		if len(m.samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, s := range m.samples {
+			fmt.Fprintf(bw, "%s%s %s\n", m.name, s.labels, formatValue(s.value))
+		}
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// countingWriter counts the bytes that reach w, for WriteTo's result.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (e *Exporter) logf(format string, args ...interface{}) {
+	if e.Logf != nil {
+		e.Logf(format, args...)
+	}
+}
+
+// formatLabels renders name/value pairs as {a="1",b="2"}.
+func formatLabels(pairs []string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,188 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"netgearcli/internal/config"
+	"netgearcli/internal/errs"
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/poe"
+)
+
+func newFleet(t *testing.T, names ...string) *fleet.Fleet {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	cfg := &config.Config{}
+	for i, name := range names {
+		cfg.Switches = append(cfg.Switches, config.Switch{Name: name, Address: fmt.Sprintf("10.0.0.%d", i+1)})
+	}
+	f, err := fleet.New(cfg, fleet.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func member(t *testing.T, f *fleet.Fleet, name string) *fleet.Member {
+	t.Helper()
+	m, ok := f.Get(name)
+	if !ok {
+		t.Fatalf("no member %s", name)
+	}
+	return m
+}
+
+func TestWriteTo(t *testing.T) {
+	f := newFleet(t, "sw1", "sw2", "sw3")
+	e := &Exporter{Fleet: f, Interval: time.Minute}
+	e.logins = func(m *fleet.Member) (int64, int64) {
+		if m.Config.Name == "sw2" {
+			return 1, 2
+		}
+		return 1, 0
+	}
+	start := time.UnixMilli(1700000000500)
+
+	e.record(member(t, f, "sw1"), start, 1500*time.Millisecond, []poe.PortStatus{
+		{Port: 1, Name: "cam \"front\" \\ door\nA", Status: "Delivering Power", Class: "class4",
+			Voltage: 53, Current: 85, Power: 4.5, Temperature: 40, Error: "No Error"},
+		{Port: 2, Status: "Fault", Class: "class0", Error: "Short Circuit"},
+	}, nil)
+	sw2 := member(t, f, "sw2")
+	e.record(sw2, start, time.Second, nil, fmt.Errorf("status: %w", errs.ErrTimeout))
+	e.record(sw2, start, time.Second, nil, fmt.Errorf("status: %w", errs.ErrUnreachable))
+	e.record(sw2, start.Add(time.Minute), 2*time.Second, nil, fmt.Errorf("status: %w", errs.ErrTimeout))
+	// Shutting down is not a failed poll
+	e.record(sw2, start.Add(2*time.Minute), 0, nil, context.Canceled)
+
+	var b bytes.Buffer
+	n, err := e.WriteTo(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(b.Len()) {
+		t.Errorf("WriteTo = %d, wrote %d bytes", n, b.Len())
+	}
+
+	label := `label="cam \"front\" \\ door\nA"`
+	want := `# HELP netgear_poe_port_power_watts Power delivered on the port.
+# TYPE netgear_poe_port_power_watts gauge
+netgear_poe_port_power_watts{switch="sw1",port="1",` + label + `} 4.5
+netgear_poe_port_power_watts{switch="sw1",port="2",label=""} 0
+# HELP netgear_poe_port_voltage_volts Output voltage on the port.
+# TYPE netgear_poe_port_voltage_volts gauge
+netgear_poe_port_voltage_volts{switch="sw1",port="1",` + label + `} 53
+netgear_poe_port_voltage_volts{switch="sw1",port="2",label=""} 0
+# HELP netgear_poe_port_current_amperes Output current on the port.
+# TYPE netgear_poe_port_current_amperes gauge
+netgear_poe_port_current_amperes{switch="sw1",port="1",` + label + `} 0.085
+netgear_poe_port_current_amperes{switch="sw1",port="2",label=""} 0
+# HELP netgear_poe_port_temperature_celsius Port temperature.
+# TYPE netgear_poe_port_temperature_celsius gauge
+netgear_poe_port_temperature_celsius{switch="sw1",port="1",` + label + `} 40
+netgear_poe_port_temperature_celsius{switch="sw1",port="2",label=""} 0
+# HELP netgear_poe_port_delivering 1 if the port is delivering power.
+# TYPE netgear_poe_port_delivering gauge
+netgear_poe_port_delivering{switch="sw1",port="1",` + label + `} 1
+netgear_poe_port_delivering{switch="sw1",port="2",label=""} 0
+# HELP netgear_poe_port_error 1 if the port reports an error status.
+# TYPE netgear_poe_port_error gauge
+netgear_poe_port_error{switch="sw1",port="1",` + label + `} 0
+netgear_poe_port_error{switch="sw1",port="2",label=""} 1
+# HELP netgear_poe_port_info Port status and power class as labels; always 1.
+# TYPE netgear_poe_port_info gauge
+netgear_poe_port_info{switch="sw1",port="1",` + label + `,status="Delivering Power",class="class4"} 1
+netgear_poe_port_info{switch="sw1",port="2",label="",status="Fault",class="class0"} 1
+# HELP netgear_up 1 if the last poll of the switch succeeded.
+# TYPE netgear_up gauge
+netgear_up{switch="sw1",address="10.0.0.1"} 1
+netgear_up{switch="sw2",address="10.0.0.2"} 0
+# HELP netgear_scrapes_total Polls of the switch.
+# TYPE netgear_scrapes_total counter
+netgear_scrapes_total{switch="sw1"} 1
+netgear_scrapes_total{switch="sw2"} 3
+# HELP netgear_scrape_errors_total Failed polls of the switch by error class.
+# TYPE netgear_scrape_errors_total counter
+netgear_scrape_errors_total{switch="sw2",class="timeout"} 2
+netgear_scrape_errors_total{switch="sw2",class="unreachable"} 1
+# HELP netgear_scrape_duration_seconds How long the last poll took.
+# TYPE netgear_scrape_duration_seconds gauge
+netgear_scrape_duration_seconds{switch="sw1"} 1.5
+netgear_scrape_duration_seconds{switch="sw2"} 2
+# HELP netgear_last_scrape_timestamp_seconds When the last poll started.
+# TYPE netgear_last_scrape_timestamp_seconds gauge
+netgear_last_scrape_timestamp_seconds{switch="sw1"} 1.7000000005e+09
+netgear_last_scrape_timestamp_seconds{switch="sw2"} 1.7000000605e+09
+# HELP netgear_logins_total Successful logins to the switch.
+# TYPE netgear_logins_total counter
+netgear_logins_total{switch="sw1"} 1
+netgear_logins_total{switch="sw2"} 1
+netgear_logins_total{switch="sw3"} 1
+# HELP netgear_login_failures_total Logins that failed after all retries.
+# TYPE netgear_login_failures_total counter
+netgear_login_failures_total{switch="sw1"} 0
+netgear_login_failures_total{switch="sw2"} 2
+netgear_login_failures_total{switch="sw3"} 0
+`
+	if got := b.String(); got != want {
+		t.Errorf("WriteTo wrote:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriteToCountsLargeOutput(t *testing.T) {
+	f := newFleet(t, "sw1")
+	e := &Exporter{Fleet: f}
+	var ports []poe.PortStatus
+	for p := 1; p <= 48; p++ {
+		ports = append(ports, poe.PortStatus{Port: p, Name: fmt.Sprintf("port-%d", p), Status: "Searching"})
+	}
+	e.record(member(t, f, "sw1"), time.Now(), time.Second, ports, nil)
+
+	var b bytes.Buffer
+	n, err := e.WriteTo(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() <= 4096 {
+		t.Fatalf("output is only %d bytes; the test needs more than bufio's buffer", b.Len())
+	}
+	if n != int64(b.Len()) {
+		t.Errorf("WriteTo = %d, wrote %d bytes", n, b.Len())
+	}
+}
+
+func TestStalePortsAreNotExported(t *testing.T) {
+	f := newFleet(t, "sw1")
+	e := &Exporter{Fleet: f}
+	m := member(t, f, "sw1")
+	e.record(m, time.Now(), time.Second, []poe.PortStatus{{Port: 1, Power: 4}}, nil)
+	e.record(m, time.Now(), time.Second, nil, errs.ErrUnreachable)
+
+	var b bytes.Buffer
+	e.WriteTo(&b)
+	if strings.Contains(b.String(), "netgear_poe_port_power_watts") {
+		t.Errorf("ports of a switch that stopped answering are exported:\n%s", b.String())
+	}
+	if !strings.Contains(b.String(), `netgear_up{switch="sw1",address="10.0.0.1"} 0`) {
+		t.Errorf("switch not reported down:\n%s", b.String())
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	f := newFleet(t, "sw1")
+	e := &Exporter{Fleet: f}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), `netgear_logins_total{switch="sw1"} 0`) {
+		t.Errorf("body:\n%s", rec.Body.String())
+	}
+}
@@ -0,0 +1,54 @@
+package monitor
+
+import "math"
+
+// baseline is a fixed-size window of recent power samples for one port.
+type baseline struct {
+	samples []float64
+	next    int
+	full    bool
+}
+
+func newBaseline(size int) *baseline {
+	return &baseline{samples: make([]float64, size)}
+}
+
+func (b *baseline) add(v float64) {
+	b.samples[b.next] = v
+	b.next = (b.next + 1) % len(b.samples)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+func (b *baseline) count() int {
+	if b.full {
+		return len(b.samples)
+	}
+	return b.next
+}
+
+// median of the window; robust against the spikes being looked for
+func (b *baseline) median() float64 {
+	n := b.count()
+	if n == 0 {
+		return math.NaN()
+	}
+	sorted := make([]float64, n)
+	copy(sorted, b.samples[:n])
+	// Insertion sort: windows are small
+	for i := 1; i < n; i++ {
+		for j := i; j > 0 && sorted[j] < sorted[j-1]; j-- {
+			sorted[j], sorted[j-1] = sorted[j-1], sorted[j]
+		}
+	}
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+func (b *baseline) reset() {
+	b.next = 0
+	b.full = false
+}
@@ -0,0 +1,356 @@
+// Package monitor polls PoE status and raises alerts when a port's power
+// draw jumps or drops against its recent baseline, crosses an absolute
+// threshold, or its status changes (for example from "Delivering Power" to
+// a fault).
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"netgearcli/internal/config"
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/hooks"
+	"netgearcli/internal/poe"
+)
+
+// Alert kinds
+const (
+	KindStatusChange  = "status_change"
+	KindFault         = "fault"
+	KindFaultCleared  = "fault_cleared"
+	KindPowerHigh     = "power_high"
+	KindPowerLow      = "power_low"
+	KindPowerNormal   = "power_normal"
+	KindPowerJump     = "power_jump"
+	KindPowerDrop     = "power_drop"
+	KindPollFailed    = "poll_failed"
+	KindPollRecovered = "poll_recovered"
+)
+
+// Alert severities
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Alert is one detected event.
+type Alert struct {
+	Time           time.Time `json:"time"`
+	Switch         string    `json:"switch"`
+	Port           int       `json:"port,omitempty"`
+	Label          string    `json:"label,omitempty"`
+	Kind           string    `json:"kind"`
+	Severity       string    `json:"severity"`
+	Message        string    `json:"message"`
+	Status         string    `json:"status,omitempty"`
+	PreviousStatus string    `json:"previous_status,omitempty"`
+	Power          *float64  `json:"power_w,omitempty"`
+	Baseline       *float64  `json:"baseline_w,omitempty"`
+}
+
+// Defaults for unset configuration
+const (
+	defaultInterval     = 30 * time.Second
+	defaultWindow       = 20
+	defaultMinSamples   = 5
+	defaultDeltaWatts   = 2
+	defaultDeltaPercent = 50
+)
+
+// Monitor polls a fleet and sends alerts to its sinks.
+type Monitor struct {
+	Fleet  *fleet.Fleet
+	Config config.Monitor
+	Sinks  []Sink
+	Logf   func(format string, args ...interface{})
+
+	mu    sync.Mutex
+	ports map[string]*portState
+	down  map[string]bool
+}
+
+// portState is what the monitor remembers about one port between polls.
+type portState struct {
+	baseline *baseline
+	status   string
+	faulted  bool
+	// high, low and deviated are the conditions currently alerted on,
+	// so each is reported once when it starts and once when it ends
+	high, low, deviated bool
+}
+
+// Run polls every switch on the configured interval until ctx is done.
+func (m *Monitor) Run(ctx context.Context) error {
+	interval := time.Duration(m.Config.Interval)
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+
+	var wg sync.WaitGroup
+	for _, member := range m.Fleet.Members() {
+		wg.Add(1)
+		go func(member *fleet.Member) {
+			defer wg.Done()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				m.poll(ctx, member, interval)
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(member)
+	}
+	wg.Wait()
+	return nil
+}
+
+// poll reads one switch and sends any resulting alerts
+func (m *Monitor) poll(ctx context.Context, member *fleet.Member, timeout time.Duration) {
+	pollCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var statuses []poe.PortStatus
+	err := member.Locked(pollCtx, func(ctx context.Context) error {
+		var err error
+		statuses, err = member.Session.Status(ctx)
+		return err
+	})
+	if ctx.Err() != nil {
+		return
+	}
+
+	name := member.Config.Name
+	var alerts []Alert
+	m.mu.Lock()
+	if m.down == nil {
+		m.down = make(map[string]bool)
+	}
+	switch {
+	case err != nil && !m.down[name]:
+		m.down[name] = true
+		alerts = append(alerts, Alert{Time: time.Now(), Switch: name, Kind: KindPollFailed, Severity: SeverityWarning,
+			Message: fmt.Sprintf("cannot read PoE status: %v", err)})
+	case err == nil && m.down[name]:
+		m.down[name] = false
+		alerts = append(alerts, Alert{Time: time.Now(), Switch: name, Kind: KindPollRecovered, Severity: SeverityInfo,
+			Message: "PoE status readable again"})
+	}
+	if err == nil {
+		for _, s := range statuses {
+			alerts = append(alerts, m.evaluate(name, s)...)
+		}
+	} else {
+		m.logf("Polling %s failed: %v", name, err)
+	}
+	m.mu.Unlock()
+
+	for _, a := range alerts {
+		m.send(ctx, a)
+		if a.Kind == KindStatusChange {
+			m.fireHooks(ctx, member, a)
+		}
+	}
+}
+
+// fireHooks tells the fleet's hooks about a detected status change
+func (m *Monitor) fireHooks(ctx context.Context, member *fleet.Member, a Alert) {
+	d := m.Fleet.Options.Hooks
+	if !d.Wants(hooks.EventStatusChange) {
+		return
+	}
+	e := hooks.NewEvent(hooks.EventStatusChange, member.Config.Name, member.Config.Address, []int{a.Port}, hooks.CurrentActor("monitor"))
+	e.Actor.Reason = a.Message
+	e.Before = []hooks.PortState{{Port: a.Port, Name: a.Label, Status: a.PreviousStatus}}
+	after := hooks.PortState{Port: a.Port, Name: a.Label, Status: a.Status}
+	if a.Power != nil {
+		after.Power = *a.Power
+	}
+	e.After = []hooks.PortState{after}
+	d.Fire(ctx, e)
+}
+
+// evaluate updates a port's state with a new sample and returns the alerts
+// it causes. The caller holds m.mu.
+func (m *Monitor) evaluate(sw string, s poe.PortStatus) []Alert {
+	if m.ports == nil {
+		m.ports = make(map[string]*portState)
+	}
+	key := fmt.Sprintf("%s/%d", sw, s.Port)
+	st, seen := m.ports[key]
+	if !seen {
+		st = &portState{baseline: newBaseline(positive(m.Config.Window, defaultWindow)), status: s.Status, faulted: s.Faulted()}
+		m.ports[key] = st
+	}
+
+	now := time.Now()
+	var alerts []Alert
+	alert := func(kind, severity, format string, args ...interface{}) *Alert {
+		alerts = append(alerts, Alert{Time: now, Switch: sw, Port: s.Port, Label: s.Name, Kind: kind, Severity: severity,
+			Message: fmt.Sprintf(format, args...), Status: s.Status})
+		return &alerts[len(alerts)-1]
+	}
+
+	if seen && !strings.EqualFold(s.Status, st.status) {
+		severity := SeverityInfo
+		if strings.EqualFold(st.status, "Delivering Power") {
+			severity = SeverityWarning
+		}
+		a := alert(KindStatusChange, severity, "status changed from %q to %q", st.status, s.Status)
+		a.PreviousStatus = st.status
+		if !s.Delivering() {
+			st.baseline.reset()
+		}
+	}
+	if s.Faulted() && (!st.faulted || !seen) {
+		alert(KindFault, SeverityCritical, "port reports a fault: %s", faultText(s))
+	} else if !s.Faulted() && st.faulted {
+		alert(KindFaultCleared, SeverityInfo, "fault cleared")
+	}
+	st.status, st.faulted = s.Status, s.Faulted()
+
+	if !s.Delivering() {
+		st.high, st.low, st.deviated = false, false, false
+		return alerts
+	}
+
+	limits := m.thresholds(sw, s.Port)
+	power := s.Power
+	withPower := func(a *Alert, baseline float64) {
+		a.Power = &power
+		if !math.IsNaN(baseline) {
+			b := baseline
+			a.Baseline = &b
+		}
+	}
+
+	// Absolute thresholds
+	high := limits.MaxWatts > 0 && power > limits.MaxWatts
+	low := limits.MinWatts > 0 && power < limits.MinWatts
+	if high && !st.high {
+		withPower(alert(KindPowerHigh, SeverityWarning, "drawing %.2fW, above the %.2fW limit", power, limits.MaxWatts), math.NaN())
+	}
+	if low && !st.low {
+		withPower(alert(KindPowerLow, SeverityWarning, "drawing %.2fW, below the %.2fW minimum", power, limits.MinWatts), math.NaN())
+	}
+	if (st.high && !high) || (st.low && !low) {
+		withPower(alert(KindPowerNormal, SeverityInfo, "drawing %.2fW, back within limits", power), math.NaN())
+	}
+	st.high, st.low = high, low
+
+	// Change against the rolling baseline
+	base := st.baseline.median()
+	if st.baseline.count() >= positive(m.Config.MinSamples, defaultMinSamples) {
+		delta := power - base
+		deviated := math.Abs(delta) > limits.DeltaWatts && math.Abs(delta) > base*limits.DeltaPercent/100
+		if deviated && !st.deviated {
+			kind, verb := KindPowerJump, "jumped"
+			if delta < 0 {
+				kind, verb = KindPowerDrop, "dropped"
+			}
+			withPower(alert(kind, SeverityWarning, "draw %s to %.2fW from a baseline of %.2fW", verb, power, base), base)
+		}
+		st.deviated = deviated
+	}
+	st.baseline.add(power)
+	return alerts
+}
+
+// thresholds returns the limits for a port: the first matching ports entry
+// over the monitor-wide values over the defaults
+func (m *Monitor) thresholds(sw string, port int) config.MonitorThresholds {
+	t := m.Config.MonitorThresholds
+	for _, pc := range m.Config.Ports {
+		if pc.Switch != sw || !portMatches(pc.Ports, port) {
+			continue
+		}
+		if pc.MinWatts > 0 {
+			t.MinWatts = pc.MinWatts
+		}
+		if pc.MaxWatts > 0 {
+			t.MaxWatts = pc.MaxWatts
+		}
+		if pc.DeltaWatts > 0 {
+			t.DeltaWatts = pc.DeltaWatts
+		}
+		if pc.DeltaPercent > 0 {
+			t.DeltaPercent = pc.DeltaPercent
+		}
+		break
+	}
+	if t.DeltaWatts <= 0 {
+		t.DeltaWatts = defaultDeltaWatts
+	}
+	if t.DeltaPercent <= 0 {
+		t.DeltaPercent = defaultDeltaPercent
+	}
+	return t
+}
+
+func portMatches(spec string, port int) bool {
+	if spec == "" {
+		return true
+	}
+	ports, err := poe.ParsePorts(strings.Fields(spec))
+	if err != nil {
+		return false
+	}
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the port lists in the configuration.
+func Validate(cfg *config.Monitor) error {
+	for i, pc := range cfg.Ports {
+		if pc.Switch == "" {
+			return fmt.Errorf("monitor ports %d: no switch", i+1)
+		}
+		if _, err := poe.ParsePorts(strings.Fields(pc.Ports)); err != nil {
+			return fmt.Errorf("monitor ports %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (m *Monitor) send(ctx context.Context, a Alert) {
+	m.logf("Alert %s %s port %d %s: %s", a.Severity, a.Switch, a.Port, a.Kind, a.Message)
+	for _, sink := range m.Sinks {
+		sendCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		if err := sink.Send(sendCtx, a); err != nil {
+			m.logf("Sending alert failed: %v", err)
+		}
+		cancel()
+	}
+}
+
+func (m *Monitor) logf(format string, args ...interface{}) {
+	if m.Logf != nil {
+		m.Logf(format, args...)
+	}
+}
+
+func faultText(s poe.PortStatus) string {
+	if s.Error != "" && !strings.EqualFold(s.Error, "No Error") {
+		return s.Error
+	}
+	return s.Status
+}
+
+func positive(v, def int) int {
+	if v > 0 {
+		return v
+	}
+	return def
+}
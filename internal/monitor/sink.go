@@ -0,0 +1,89 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"netgearcli/internal/config"
+	"netgearcli/internal/hooks"
+)
+
+// Sink delivers alerts.
+type Sink interface {
+	Send(ctx context.Context, a Alert) error
+}
+
+// Sinks builds the configured alert sinks. With none configured alerts go
+// to stderr.
+func Sinks(cfg []config.AlertSink) ([]Sink, error) {
+	if len(cfg) == 0 {
+		return []Sink{Writer{W: os.Stderr}}, nil
+	}
+	var sinks []Sink
+	for i, sc := range cfg {
+		switch sc.Type {
+		case "stderr":
+			sinks = append(sinks, Writer{W: os.Stderr})
+		case "webhook":
+			if sc.URL == "" {
+				return nil, fmt.Errorf("alert %d: webhook needs a url", i+1)
+			}
+			sinks = append(sinks, Webhook{URL: sc.URL})
+		case "exec":
+			if sc.Command == "" {
+				return nil, fmt.Errorf("alert %d: exec needs a command", i+1)
+			}
+			sinks = append(sinks, Exec{Command: sc.Command})
+		default:
+			return nil, fmt.Errorf("alert %d: unknown type %q (want stderr, webhook or exec)", i+1, sc.Type)
+		}
+	}
+	return sinks, nil
+}
+
+// Writer prints one line per alert.
+type Writer struct {
+	W io.Writer
+}
+
+func (s Writer) Send(ctx context.Context, a Alert) error {
+	where := a.Switch
+	if a.Port > 0 {
+		where = fmt.Sprintf("%s port %d", a.Switch, a.Port)
+	}
+	_, err := fmt.Fprintf(s.W, "%s %-8s %s: %s\n", a.Time.Format(time.RFC3339), a.Severity, where, a.Message)
+	return err
+}
+
+// Webhook POSTs the alert as JSON, the same way hooks deliver events.
+type Webhook struct {
+	URL string
+}
+
+func (s Webhook) Send(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return hooks.PostJSON(ctx, s.URL, body, nil, "")
+}
+
+// Exec runs a shell command with the alert JSON on stdin.
+type Exec struct {
+	Command string
+}
+
+func (s Exec) Send(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	if err := hooks.RunCommand(ctx, s.Command, body); err != nil {
+		return fmt.Errorf("alert command failed: %w", err)
+	}
+	return nil
+}
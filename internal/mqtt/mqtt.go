@@ -0,0 +1,452 @@
+// Package mqtt is a minimal MQTT 3.1.1 client: enough to publish retained
+// state at QoS 0, subscribe to command topics and keep a connection with a
+// last will alive. It does not queue messages while disconnected; callers
+// reconnect and republish.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Packet types
+const (
+	typeConnect     = 1
+	typeConnack     = 2
+	typePublish     = 3
+	typePuback      = 4
+	typeSubscribe   = 8
+	typeSuback      = 9
+	typePingreq     = 12
+	typePingresp    = 13
+	typeDisconnect  = 14
+	maxRemainingLen = 268435455
+)
+
+// ErrClosed is returned by operations on a closed client.
+var ErrClosed = errors.New("mqtt: connection closed")
+
+// Message is a received or published application message.
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// Options configure a connection.
+type Options struct {
+	// Broker is a URL such as "tcp://broker:1883" or "tls://broker:8883".
+	// A bare host:port is treated as tcp.
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+	// KeepAlive defaults to 30s.
+	KeepAlive time.Duration
+	// Will is published by the broker if the connection drops.
+	Will *Message
+	// TLSConfig is used for tls:// brokers.
+	TLSConfig *tls.Config
+}
+
+// Client is one connection to a broker. Received messages for subscribed
+// topics arrive on Messages until the connection ends.
+type Client struct {
+	conn      net.Conn
+	keepAlive time.Duration
+
+	writeMu  sync.Mutex
+	nextID   uint16
+	messages chan Message
+	done     chan struct{}
+	once     sync.Once
+	err      error
+}
+
+// Dial connects to the broker and completes the MQTT handshake.
+func Dial(ctx context.Context, opts Options) (*Client, error) {
+	network, addr, useTLS, err := parseBroker(opts.Broker)
+	if err != nil {
+		return nil, err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if useTLS {
+		cfg := opts.TLSConfig
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		if cfg.ServerName == "" {
+			cfg = cfg.Clone()
+			cfg.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	return Connect(ctx, conn, opts)
+}
+
+// Connect completes the MQTT handshake over an established connection,
+// which the returned client then owns. It is closed if the handshake
+// fails.
+func Connect(ctx context.Context, conn net.Conn, opts Options) (*Client, error) {
+	keepAlive := opts.KeepAlive
+	if keepAlive <= 0 {
+		keepAlive = 30 * time.Second
+	}
+	c := &Client{
+		conn:      conn,
+		keepAlive: keepAlive,
+		messages:  make(chan Message, 64),
+		done:      make(chan struct{}),
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if err := c.connect(opts); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	go c.readLoop()
+	go c.pingLoop()
+	return c, nil
+}
+
+func parseBroker(broker string) (network, addr string, useTLS bool, err error) {
+	if broker == "" {
+		return "", "", false, fmt.Errorf("mqtt: no broker configured")
+	}
+	u, err := url.Parse(broker)
+	if err != nil || u.Host == "" {
+		// Plain host:port
+		return "tcp", withPort(broker, "1883"), false, nil
+	}
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		return "tcp", withPort(u.Host, "1883"), false, nil
+	case "tls", "ssl", "mqtts":
+		return "tcp", withPort(u.Host, "8883"), true, nil
+	}
+	return "", "", false, fmt.Errorf("mqtt: unsupported broker scheme %q", u.Scheme)
+}
+
+func withPort(host, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// connect sends CONNECT and waits for CONNACK
+func (c *Client) connect(opts Options) error {
+	var flags byte = 0x02 // clean session
+	var payload []byte
+	payload = appendString(payload, opts.ClientID)
+	if opts.Will != nil {
+		flags |= 0x04
+		if opts.Will.Retain {
+			flags |= 0x20
+		}
+		payload = appendString(payload, opts.Will.Topic)
+		payload = appendBytes(payload, opts.Will.Payload)
+	}
+	if opts.Username != "" {
+		flags |= 0x80
+		payload = appendString(payload, opts.Username)
+		if opts.Password != "" {
+			flags |= 0x40
+			payload = appendString(payload, opts.Password)
+		}
+	}
+
+	var body []byte
+	body = appendString(body, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(c.keepAlive/time.Second))
+	body = append(body, payload...)
+	if err := c.write(typeConnect<<4, body); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(c.conn)
+	header, body, err := readPacket(r)
+	if err != nil {
+		return fmt.Errorf("mqtt: waiting for CONNACK: %w", err)
+	}
+	if header>>4 != typeConnack || len(body) != 2 {
+		return fmt.Errorf("mqtt: expected CONNACK, got packet type %d", header>>4)
+	}
+	if code := body[1]; code != 0 {
+		return fmt.Errorf("mqtt: connection refused: %s", connackReason(code))
+	}
+	c.conn = &bufferedConn{Conn: c.conn, r: r}
+	return nil
+}
+
+func connackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "client identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("return code %d", code)
+}
+
+// Publish sends a QoS 0 message.
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	var header byte = typePublish << 4
+	if retain {
+		header |= 0x01
+	}
+	body := appendString(nil, topic)
+	body = append(body, payload...)
+	return c.write(header, body)
+}
+
+// Subscribe asks for messages on filter at QoS 0. Matching messages arrive
+// on Messages.
+func (c *Client) Subscribe(filter string) error {
+	c.writeMu.Lock()
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	id := c.nextID
+	c.writeMu.Unlock()
+
+	body := binary.BigEndian.AppendUint16(nil, id)
+	body = appendString(body, filter)
+	body = append(body, 0)
+	return c.write(typeSubscribe<<4|0x02, body)
+}
+
+// Messages returns the channel of received messages. It is closed when the
+// connection ends.
+func (c *Client) Messages() <-chan Message {
+	return c.messages
+}
+
+// Done is closed when the connection ends; Err then says why.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection ended, or nil while it is up.
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// Close sends DISCONNECT, so the broker does not publish the will, and
+// closes the connection.
+func (c *Client) Close() error {
+	c.write(typeDisconnect<<4, nil)
+	c.fail(ErrClosed)
+	return nil
+}
+
+func (c *Client) fail(err error) {
+	c.once.Do(func() {
+		c.err = err
+		c.conn.Close()
+		close(c.done)
+	})
+}
+
+func (c *Client) write(header byte, body []byte) error {
+	if len(body) > maxRemainingLen {
+		return fmt.Errorf("mqtt: packet too large")
+	}
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+
+	packet := []byte{header}
+	packet = appendLength(packet, len(body))
+	packet = append(packet, body...)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(c.keepAlive))
+	if _, err := c.conn.Write(packet); err != nil {
+		c.fail(err)
+		return err
+	}
+	return nil
+}
+
+func (c *Client) readLoop() {
+	defer close(c.messages)
+	r := bufio.NewReader(c.conn)
+	for {
+		// The broker answers our pings, so silence for longer than the
+		// keep-alive means the connection is dead
+		c.conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2))
+		header, body, err := readPacket(r)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+
+		switch header >> 4 {
+		case typePublish:
+			msg, id, err := parsePublish(header, body)
+			if err != nil {
+				c.fail(err)
+				return
+			}
+			if id != 0 {
+				c.write(typePuback<<4, binary.BigEndian.AppendUint16(nil, id))
+			}
+			select {
+			case c.messages <- msg:
+			case <-c.done:
+				return
+			}
+		case typeSuback:
+			if len(body) >= 3 && body[2] == 0x80 {
+				c.fail(fmt.Errorf("mqtt: subscription refused"))
+				return
+			}
+		case typePingresp, typePuback:
+		default:
+			c.fail(fmt.Errorf("mqtt: unexpected packet type %d", header>>4))
+			return
+		}
+	}
+}
+
+func (c *Client) pingLoop() {
+	ticker := time.NewTicker(c.keepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.write(typePingreq<<4, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func parsePublish(header byte, body []byte) (Message, uint16, error) {
+	topic, rest, err := readString(body)
+	if err != nil {
+		return Message{}, 0, err
+	}
+	var id uint16
+	if qos := (header >> 1) & 0x03; qos > 0 {
+		if len(rest) < 2 {
+			return Message{}, 0, fmt.Errorf("mqtt: short PUBLISH packet")
+		}
+		id = binary.BigEndian.Uint16(rest)
+		rest = rest[2:]
+	}
+	return Message{Topic: topic, Payload: rest, Retain: header&0x01 != 0}, id, nil
+}
+
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, fmt.Errorf("mqtt: malformed remaining length")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+func appendLength(b []byte, n int) []byte {
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+func appendString(b []byte, s string) []byte {
+	return appendBytes(b, []byte(s))
+}
+
+func appendBytes(b, data []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, fmt.Errorf("mqtt: short string")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, fmt.Errorf("mqtt: short string")
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
+
+// bufferedConn keeps bytes read past the CONNACK
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,419 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type packet struct {
+	header byte
+	body   []byte
+}
+
+// fakeBroker is the broker end of a net.Pipe. Packets from the client are
+// read continuously so its writes never block.
+type fakeBroker struct {
+	conn    net.Conn
+	packets chan packet
+}
+
+func newFakeBroker(t *testing.T) (net.Conn, *fakeBroker) {
+	t.Helper()
+	client, server := net.Pipe()
+	b := &fakeBroker{conn: server, packets: make(chan packet, 16)}
+	go func() {
+		defer close(b.packets)
+		r := bufio.NewReader(server)
+		for {
+			header, body, err := readPacket(r)
+			if err != nil {
+				return
+			}
+			b.packets <- packet{header, body}
+		}
+	}()
+	t.Cleanup(func() { server.Close() })
+	return client, b
+}
+
+// expect waits for the next packet, which must be of type typ.
+func (b *fakeBroker) expect(t *testing.T, typ byte) packet {
+	t.Helper()
+	select {
+	case p, ok := <-b.packets:
+		if !ok {
+			t.Fatalf("connection closed waiting for packet type %d", typ)
+		}
+		if p.header>>4 != typ {
+			t.Fatalf("got packet type %d, want %d", p.header>>4, typ)
+		}
+		return p
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for packet type %d", typ)
+	}
+	return packet{}
+}
+
+func (b *fakeBroker) send(t *testing.T, header byte, body []byte) {
+	t.Helper()
+	b.conn.SetWriteDeadline(time.Now().Add(2 * time.Second))
+	if _, err := b.conn.Write(append(appendLength([]byte{header}, len(body)), body...)); err != nil {
+		t.Fatalf("broker write: %v", err)
+	}
+}
+
+// connect completes a handshake with a fake broker.
+func connect(t *testing.T, opts Options) (*Client, *fakeBroker) {
+	t.Helper()
+	conn, broker := newFakeBroker(t)
+	type result struct {
+		c   *Client
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		c, err := Connect(context.Background(), conn, opts)
+		done <- result{c, err}
+	}()
+	broker.expect(t, typeConnect)
+	broker.send(t, typeConnack<<4, []byte{0, 0})
+	r := <-done
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	t.Cleanup(func() { r.c.Close() })
+	return r.c, broker
+}
+
+func TestRemainingLength(t *testing.T) {
+	tests := []struct {
+		n    int
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{16383, []byte{0xff, 0x7f}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+		{2097151, []byte{0xff, 0xff, 0x7f}},
+		{2097152, []byte{0x80, 0x80, 0x80, 0x01}},
+		{maxRemainingLen, []byte{0xff, 0xff, 0xff, 0x7f}},
+	}
+	for _, tt := range tests {
+		got := appendLength(nil, tt.n)
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("appendLength(%d) = % x, want % x", tt.n, got, tt.want)
+		}
+		if tt.n > 1<<16 {
+			continue // the body would be too large to allocate for a test
+		}
+		packet := append([]byte{typePublish << 4}, got...)
+		packet = append(packet, make([]byte, tt.n)...)
+		header, body, err := readPacket(bufio.NewReader(bytes.NewReader(packet)))
+		if err != nil || header != typePublish<<4 || len(body) != tt.n {
+			t.Errorf("readPacket of length %d: header %#x, %d bytes, %v", tt.n, header, len(body), err)
+		}
+	}
+}
+
+func TestReadPacketErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"five length bytes", []byte{0x30, 0xff, 0xff, 0xff, 0xff, 0x7f}, "malformed remaining length"},
+		{"truncated body", []byte{0x30, 0x05, 0x00, 0x01}, "unexpected EOF"},
+		{"truncated length", []byte{0x30, 0x80}, "EOF"},
+		{"empty", nil, "EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := readPacket(bufio.NewReader(bytes.NewReader(tt.data)))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBroker(t *testing.T) {
+	tests := []struct {
+		broker  string
+		addr    string
+		tls     bool
+		wantErr bool
+	}{
+		{broker: "tcp://broker:1884", addr: "broker:1884"},
+		{broker: "mqtt://broker", addr: "broker:1883"},
+		{broker: "tls://broker", addr: "broker:8883", tls: true},
+		{broker: "mqtts://broker:9883", addr: "broker:9883", tls: true},
+		{broker: "broker:1883", addr: "broker:1883"},
+		{broker: "broker", addr: "broker:1883"},
+		{broker: "ws://broker", wantErr: true},
+		{broker: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		_, addr, useTLS, err := parseBroker(tt.broker)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseBroker(%q) succeeded", tt.broker)
+			}
+			continue
+		}
+		if err != nil || addr != tt.addr || useTLS != tt.tls {
+			t.Errorf("parseBroker(%q) = %q, %v, %v; want %q, %v", tt.broker, addr, useTLS, err, tt.addr, tt.tls)
+		}
+	}
+}
+
+func TestConnectPacket(t *testing.T) {
+	conn, broker := newFakeBroker(t)
+	opts := Options{
+		ClientID:  "netgear-test",
+		Username:  "user",
+		Password:  "pass",
+		KeepAlive: 10 * time.Second,
+		Will:      &Message{Topic: "netgear/bridge/availability", Payload: []byte("offline"), Retain: true},
+	}
+	done := make(chan error, 1)
+	go func() {
+		c, err := Connect(context.Background(), conn, opts)
+		if err == nil {
+			c.Close()
+		}
+		done <- err
+	}()
+
+	p := broker.expect(t, typeConnect)
+	body := p.body
+	name, body, _ := readString(body)
+	if name != "MQTT" || body[0] != 4 {
+		t.Fatalf("protocol %q level %d, want MQTT 4", name, body[0])
+	}
+	// user name, password, will retain, will, clean session
+	if flags := body[1]; flags != 0xe6 {
+		t.Errorf("flags = %#x, want 0xe6", flags)
+	}
+	if keepAlive := binary.BigEndian.Uint16(body[2:4]); keepAlive != 10 {
+		t.Errorf("keep-alive = %d, want 10", keepAlive)
+	}
+	rest := body[4:]
+	for _, want := range []string{"netgear-test", "netgear/bridge/availability", "offline", "user", "pass"} {
+		var got string
+		got, rest, _ = readString(rest)
+		if got != want {
+			t.Errorf("payload field = %q, want %q", got, want)
+		}
+	}
+	broker.send(t, typeConnack<<4, []byte{0, 0})
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnectRefused(t *testing.T) {
+	tests := []struct {
+		code byte
+		want string
+	}{
+		{1, "unacceptable protocol version"},
+		{4, "bad user name or password"},
+		{5, "not authorized"},
+		{9, "return code 9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			conn, broker := newFakeBroker(t)
+			done := make(chan error, 1)
+			go func() {
+				_, err := Connect(context.Background(), conn, Options{ClientID: "c"})
+				done <- err
+			}()
+			broker.expect(t, typeConnect)
+			broker.send(t, typeConnack<<4, []byte{0, tt.code})
+			if err := <-done; err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestConnectTimeout(t *testing.T) {
+	conn, broker := newFakeBroker(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := Connect(ctx, conn, Options{ClientID: "c"})
+		done <- err
+	}()
+	broker.expect(t, typeConnect)
+	// No CONNACK
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("Connect succeeded without a CONNACK")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Connect ignored the context deadline")
+	}
+}
+
+func TestPublish(t *testing.T) {
+	c, broker := connect(t, Options{ClientID: "c"})
+	if err := c.Publish("netgear/sw1/port/1/state", []byte("ON"), true); err != nil {
+		t.Fatal(err)
+	}
+	p := broker.expect(t, typePublish)
+	if p.header != typePublish<<4|0x01 {
+		t.Errorf("header = %#x, want retained QoS 0", p.header)
+	}
+	topic, payload, _ := readString(p.body)
+	if topic != "netgear/sw1/port/1/state" || string(payload) != "ON" {
+		t.Errorf("published %q %q", topic, payload)
+	}
+
+	c.Publish("netgear/sw1/port/1/power", []byte("3.5"), false)
+	if p := broker.expect(t, typePublish); p.header != typePublish<<4 {
+		t.Errorf("header = %#x, want QoS 0 without retain", p.header)
+	}
+}
+
+func TestSubscribeAndReceive(t *testing.T) {
+	c, broker := connect(t, Options{ClientID: "c"})
+	for _, filter := range []string{"netgear/+/port/+/set", "other/#"} {
+		if err := c.Subscribe(filter); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, filter := range []string{"netgear/+/port/+/set", "other/#"} {
+		p := broker.expect(t, typeSubscribe)
+		if p.header != typeSubscribe<<4|0x02 {
+			t.Errorf("header = %#x, want %#x", p.header, typeSubscribe<<4|0x02)
+		}
+		id := binary.BigEndian.Uint16(p.body)
+		got, rest, _ := readString(p.body[2:])
+		if id != uint16(i+1) || got != filter || !bytes.Equal(rest, []byte{0}) {
+			t.Errorf("SUBSCRIBE id %d filter %q qos % x", id, got, rest)
+		}
+		broker.send(t, typeSuback<<4, []byte{0, byte(i + 1), 0})
+	}
+
+	// QoS 0, then QoS 1 which must be acknowledged
+	broker.send(t, typePublish<<4|0x01, append(appendString(nil, "netgear/sw1/port/2/set"), "OFF"...))
+	body := appendString(nil, "netgear/sw1/port/3/set")
+	body = binary.BigEndian.AppendUint16(body, 77)
+	broker.send(t, typePublish<<4|0x02, append(body, "CYCLE"...))
+
+	want := []Message{
+		{Topic: "netgear/sw1/port/2/set", Payload: []byte("OFF"), Retain: true},
+		{Topic: "netgear/sw1/port/3/set", Payload: []byte("CYCLE")},
+	}
+	for _, w := range want {
+		select {
+		case msg := <-c.Messages():
+			if msg.Topic != w.Topic || string(msg.Payload) != string(w.Payload) || msg.Retain != w.Retain {
+				t.Errorf("message = %+v, want %+v", msg, w)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no message for %s", w.Topic)
+		}
+	}
+	if p := broker.expect(t, typePuback); binary.BigEndian.Uint16(p.body) != 77 {
+		t.Errorf("PUBACK id = %d, want 77", binary.BigEndian.Uint16(p.body))
+	}
+}
+
+func TestSubscriptionRefused(t *testing.T) {
+	c, broker := connect(t, Options{ClientID: "c"})
+	c.Subscribe("forbidden/#")
+	broker.expect(t, typeSubscribe)
+	broker.send(t, typeSuback<<4, []byte{0, 1, 0x80})
+	select {
+	case <-c.Done():
+		if err := c.Err(); err == nil || !strings.Contains(err.Error(), "subscription refused") {
+			t.Errorf("Err = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("refused subscription did not end the connection")
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	c, broker := connect(t, Options{ClientID: "c", KeepAlive: 200 * time.Millisecond})
+
+	// Pings go out at half the keep-alive; answered, the connection stays up
+	for i := 0; i < 3; i++ {
+		broker.expect(t, typePingreq)
+		broker.send(t, typePingresp<<4, nil)
+	}
+	if err := c.Err(); err != nil {
+		t.Fatalf("connection dropped while pings were answered: %v", err)
+	}
+
+	// Silence for longer than the keep-alive means the broker is gone
+	select {
+	case <-c.Done():
+		var ne net.Error
+		if err := c.Err(); !errors.As(err, &ne) || !ne.Timeout() {
+			t.Errorf("Err = %v, want a timeout", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("silent broker was not detected")
+	}
+	if _, ok := <-c.Messages(); ok {
+		t.Error("Messages still open after the connection ended")
+	}
+}
+
+func TestBrokerDisconnect(t *testing.T) {
+	c, broker := connect(t, Options{ClientID: "c"})
+	broker.conn.Close()
+	select {
+	case <-c.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("closed connection was not detected")
+	}
+	if c.Err() == nil || errors.Is(c.Err(), ErrClosed) {
+		t.Errorf("Err = %v, want the read error", c.Err())
+	}
+	if err := c.Publish("t", nil, false); !errors.Is(err, ErrClosed) {
+		t.Errorf("Publish after disconnect = %v, want ErrClosed", err)
+	}
+}
+
+func TestUnexpectedPacket(t *testing.T) {
+	c, broker := connect(t, Options{ClientID: "c"})
+	broker.send(t, typeConnack<<4, []byte{0, 0})
+	select {
+	case <-c.Done():
+		if err := c.Err(); err == nil || !strings.Contains(err.Error(), "unexpected packet type 2") {
+			t.Errorf("Err = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("unexpected packet was accepted")
+	}
+}
+
+func TestClose(t *testing.T) {
+	c, broker := connect(t, Options{ClientID: "c"})
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if p := broker.expect(t, typeDisconnect); len(p.body) != 0 {
+		t.Errorf("DISCONNECT body % x", p.body)
+	}
+	if !errors.Is(c.Err(), ErrClosed) {
+		t.Errorf("Err = %v, want ErrClosed", c.Err())
+	}
+	// Closing twice is harmless
+	c.Close()
+}
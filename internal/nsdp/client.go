@@ -0,0 +1,160 @@
+package nsdp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// maxMessage bounds the size of a response read.
+const maxMessage = 1 << 16
+
+// Options control Discover.
+type Options struct {
+	// Target is where the request is sent. Defaults to the broadcast
+	// address on port 63322.
+	Target string
+	// Listen is the local address the request is sent from and replies
+	// arrive on. Defaults to port 63321 on every interface, the port
+	// switches answer to.
+	Listen string
+	// Interface is the network interface whose MAC address is sent as the
+	// host MAC. Defaults to the first interface that is up and has one.
+	Interface string
+	// HostMAC overrides the host MAC taken from Interface.
+	HostMAC net.HardwareAddr
+	// Timeout is how long replies are collected. Defaults to 3s.
+	Timeout time.Duration
+}
+
+// Discover broadcasts a read request for the device records and returns
+// every switch that answers before the timeout, sorted by IP address. A
+// switch that answers twice is listed once.
+func Discover(ctx context.Context, opts Options) ([]Device, error) {
+	if opts.Target == "" {
+		opts.Target = net.JoinHostPort(net.IPv4bcast.String(), strconv.Itoa(ServerPort))
+	}
+	if opts.Listen == "" {
+		opts.Listen = ":" + strconv.Itoa(ClientPort)
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 3 * time.Second
+	}
+	if opts.HostMAC == nil {
+		mac, err := hostMAC(opts.Interface)
+		if err != nil {
+			return nil, err
+		}
+		opts.HostMAC = mac
+	}
+
+	target, err := net.ResolveUDPAddr("udp4", opts.Target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target %q: %w", opts.Target, err)
+	}
+	local, err := net.ResolveUDPAddr("udp4", opts.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listen address %q: %w", opts.Listen, err)
+	}
+	conn, err := net.ListenUDP("udp4", local)
+	if err != nil {
+		return nil, fmt.Errorf("listening for NSDP replies: %w", err)
+	}
+	defer conn.Close()
+
+	req := Message{
+		Op:        OpReadRequest,
+		HostMAC:   opts.HostMAC,
+		DeviceMAC: make(net.HardwareAddr, 6),
+		Seq:       uint16(rand.Intn(0x10000)),
+	}
+	for _, typ := range deviceTypes {
+		req.TLVs = append(req.TLVs, TLV{Type: typ})
+	}
+	data, err := req.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteToUDP(data, target); err != nil {
+		return nil, fmt.Errorf("sending NSDP request to %s: %w", target, err)
+	}
+
+	deadline := time.Now().Add(opts.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+	// Unblock the read when ctx is cancelled
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	byMAC := make(map[string]Device)
+	buf := make([]byte, maxMessage)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				break
+			}
+			return devices(byMAC), err
+		}
+		var resp Message
+		if resp.UnmarshalBinary(buf[:n]) != nil {
+			continue
+		}
+		// Replies are broadcast, so other hosts' conversations are heard too
+		if resp.Op != OpReadResponse || resp.Seq != req.Seq || resp.Result != 0 {
+			continue
+		}
+		d := ParseDevice(&resp)
+		byMAC[d.MAC] = d
+	}
+	return devices(byMAC), ctx.Err()
+}
+
+// devices sorts the found devices by IP address.
+func devices(byMAC map[string]Device) []Device {
+	list := make([]Device, 0, len(byMAC))
+	for _, d := range byMAC {
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := net.ParseIP(list[i].IP).To4(), net.ParseIP(list[j].IP).To4()
+		if string(a) != string(b) {
+			return string(a) < string(b)
+		}
+		return list[i].MAC < list[j].MAC
+	})
+	return list
+}
+
+// hostMAC returns the MAC address of the named interface, or of the first
+// interface that is up, is not a loopback and has one.
+func hostMAC(name string) (net.HardwareAddr, error) {
+	if name != "" {
+		ifi, err := net.InterfaceByName(name)
+		if err != nil {
+			return nil, err
+		}
+		if len(ifi.HardwareAddr) != 6 {
+			return nil, fmt.Errorf("interface %s has no MAC address", name)
+		}
+		return ifi.HardwareAddr, nil
+	}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, ifi := range ifaces {
+		if ifi.Flags&net.FlagUp != 0 && ifi.Flags&net.FlagLoopback == 0 && len(ifi.HardwareAddr) == 6 {
+			return ifi.HardwareAddr, nil
+		}
+	}
+	return nil, errors.New("no network interface with a MAC address found")
+}
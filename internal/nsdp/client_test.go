@@ -0,0 +1,155 @@
+package nsdp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// respond plays a switch on a loopback socket: it reads one request and
+// answers it with what reply returns, in order.
+func respond(t *testing.T, reply func(req Message) [][]byte) string {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, maxMessage)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		var req Message
+		if err := req.UnmarshalBinary(buf[:n]); err != nil {
+			t.Errorf("request: %v", err)
+			return
+		}
+		for _, data := range reply(req) {
+			conn.WriteToUDP(data, from)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// deviceReply is a read response from the switch with mac and ip.
+func deviceReply(req Message, mac net.HardwareAddr, ip net.IP, name string) Message {
+	return Message{
+		Op: OpReadResponse, HostMAC: req.HostMAC, DeviceMAC: mac, Seq: req.Seq,
+		TLVs: []TLV{
+			{Type: TypeModel, Value: []byte("GS308EP\x00\x00\x00")},
+			{Type: TypeName, Value: []byte(name)},
+			{Type: TypeMAC, Value: mac},
+			{Type: TypeIP, Value: ip.To4()},
+			{Type: TypeNetmask, Value: []byte{255, 255, 255, 0}},
+			{Type: TypeGateway, Value: []byte{192, 168, 1, 1}},
+			{Type: TypeDHCP, Value: []byte{1}},
+			{Type: TypeFirmware, Value: []byte("1.0.0.16 ")},
+			{Type: TypePortCount, Value: []byte{8}},
+			{Type: TypePortStatus, Value: []byte{2, 0, 0}},
+			{Type: TypePortStatus, Value: []byte{1, 5, 1}},
+			{Type: 0x7777, Value: []byte{1, 2}},
+		},
+	}
+}
+
+func encode(t *testing.T, m Message) []byte {
+	t.Helper()
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDiscover(t *testing.T) {
+	first := net.HardwareAddr{0x28, 0x94, 0x0f, 0, 0, 0x10}
+	second := net.HardwareAddr{0x28, 0x94, 0x0f, 0, 0, 0x20}
+	target := respond(t, func(req Message) [][]byte {
+		if req.Op != OpReadRequest || req.HostMAC.String() != testHost.String() || req.DeviceMAC.String() != "00:00:00:00:00:00" {
+			t.Errorf("request = %+v", req)
+		}
+		var asked []uint16
+		for _, tlv := range req.TLVs {
+			asked = append(asked, tlv.Type)
+		}
+		if !reflect.DeepEqual(asked, deviceTypes) {
+			t.Errorf("request asks for %#04x, want %#04x", asked, deviceTypes)
+		}
+
+		wrongSeq := deviceReply(req, testDevice, net.IPv4(192, 168, 1, 99), "other-host")
+		wrongSeq.Seq++
+		wrongOp := deviceReply(req, testDevice, net.IPv4(192, 168, 1, 98), "request")
+		wrongOp.Op = OpReadRequest
+		rejected := deviceReply(req, testDevice, net.IPv4(192, 168, 1, 97), "rejected")
+		rejected.Result = 0x0700
+		stale := deviceReply(req, first, net.IPv4(192, 168, 1, 20), "old-name")
+		return [][]byte{
+			[]byte("not NSDP at all"),
+			encode(t, wrongSeq),
+			encode(t, wrongOp),
+			encode(t, rejected),
+			encode(t, stale),
+			encode(t, deviceReply(req, second, net.IPv4(192, 168, 1, 5), "lab-b")),
+			// The same switch answering again is listed once
+			encode(t, deviceReply(req, first, net.IPv4(192, 168, 1, 20), "lab-a")),
+		}
+	})
+
+	devices, err := Discover(context.Background(), Options{
+		Target:  target,
+		Listen:  "127.0.0.1:0",
+		HostMAC: testHost,
+		Timeout: 500 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 2 {
+		t.Fatalf("Discover found %+v, want 2 switches", devices)
+	}
+	// Sorted by IP address
+	if devices[0].Name != "lab-b" || devices[1].Name != "lab-a" {
+		t.Errorf("Discover found %s and %s, want lab-b and lab-a", devices[0].Name, devices[1].Name)
+	}
+	want := Device{
+		Model: "GS308EP", Name: "lab-a", MAC: first.String(), IP: "192.168.1.20",
+		Netmask: "255.255.255.0", Gateway: "192.168.1.1", DHCP: true, Firmware: "1.0.0.16",
+		PortCount: 8,
+		Ports:     []PortStatus{{Port: 1, Link: true, Speed: "1000M"}, {Port: 2, Speed: "down"}},
+	}
+	if !reflect.DeepEqual(devices[1], want) {
+		t.Errorf("device = %+v\nwant %+v", devices[1], want)
+	}
+}
+
+func TestDiscoverCancel(t *testing.T) {
+	// A switch that never answers
+	target := respond(t, func(Message) [][]byte { return nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	devices, err := Discover(ctx, Options{Target: target, Listen: "127.0.0.1:0", HostMAC: testHost, Timeout: 10 * time.Second})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+	if len(devices) != 0 {
+		t.Errorf("Discover found %+v", devices)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Discover took %s after cancel", elapsed)
+	}
+}
+
+func TestDiscoverInvalidOptions(t *testing.T) {
+	_, err := Discover(context.Background(), Options{Target: "nowhere", HostMAC: testHost})
+	if err == nil {
+		t.Error("invalid target accepted")
+	}
+}
@@ -0,0 +1,101 @@
+package nsdp
+
+import (
+	"net"
+	"sort"
+	"strings"
+)
+
+// Device is what a switch reported about itself.
+type Device struct {
+	Model    string `json:"model,omitempty"`
+	Name     string `json:"name,omitempty"`
+	MAC      string `json:"mac"`
+	IP       string `json:"ip,omitempty"`
+	Netmask  string `json:"netmask,omitempty"`
+	Gateway  string `json:"gateway,omitempty"`
+	DHCP     bool   `json:"dhcp"`
+	Firmware string `json:"firmware,omitempty"`
+	// PortCount is the number of ports the switch reports having.
+	PortCount int          `json:"port_count,omitempty"`
+	Ports     []PortStatus `json:"ports,omitempty"`
+}
+
+// PortStatus is the link state of one port.
+type PortStatus struct {
+	Port  int    `json:"port"`
+	Link  bool   `json:"link"`
+	Speed string `json:"speed"`
+}
+
+// linkSpeeds are the speed codes of the port status record
+var linkSpeeds = map[byte]string{
+	0: "down",
+	1: "10M half",
+	2: "10M full",
+	3: "100M half",
+	4: "100M full",
+	5: "1000M",
+}
+
+// deviceTypes are the records a discovery asks for.
+var deviceTypes = []uint16{
+	TypeModel, TypeName, TypeMAC, TypeIP, TypeNetmask, TypeGateway,
+	TypeDHCP, TypeFirmware, TypePortCount, TypePortStatus,
+}
+
+// ParseDevice reads the device records of a response. Unknown records are
+// ignored.
+func ParseDevice(m *Message) Device {
+	d := Device{MAC: m.DeviceMAC.String()}
+	for _, t := range m.TLVs {
+		v := t.Value
+		switch t.Type {
+		case TypeModel:
+			d.Model = text(v)
+		case TypeName:
+			d.Name = text(v)
+		case TypeMAC:
+			if len(v) == 6 {
+				d.MAC = net.HardwareAddr(v).String()
+			}
+		case TypeIP:
+			d.IP = ip(v)
+		case TypeNetmask:
+			d.Netmask = ip(v)
+		case TypeGateway:
+			d.Gateway = ip(v)
+		case TypeDHCP:
+			d.DHCP = len(v) > 0 && v[0] != 0
+		case TypeFirmware:
+			d.Firmware = text(v)
+		case TypePortCount:
+			if len(v) > 0 {
+				d.PortCount = int(v[0])
+			}
+		case TypePortStatus:
+			// Port number, speed code and a flags byte
+			if len(v) >= 2 {
+				speed, ok := linkSpeeds[v[1]]
+				if !ok {
+					speed = "unknown"
+				}
+				d.Ports = append(d.Ports, PortStatus{Port: int(v[0]), Link: v[1] != 0, Speed: speed})
+			}
+		}
+	}
+	sort.Slice(d.Ports, func(i, j int) bool { return d.Ports[i].Port < d.Ports[j].Port })
+	return d
+}
+
+// text trims the padding switches put after strings.
+func text(v []byte) string {
+	return strings.TrimSpace(strings.TrimRight(string(v), "\x00"))
+}
+
+func ip(v []byte) string {
+	if len(v) != 4 {
+		return ""
+	}
+	return net.IP(v).String()
+}
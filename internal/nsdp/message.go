@@ -0,0 +1,145 @@
+// Package nsdp is a client for the Netgear Switch Discovery Protocol, the
+// UDP protocol Netgear's Smart Control Center uses to find switches and
+// read their model, addresses, firmware and port status without knowing
+// their IP address.
+//
+// A request is broadcast from port 63321 to port 63322 and switches answer
+// with a broadcast back to port 63321. Each message is a 32-byte header
+// followed by type-length-value records and an end marker.
+package nsdp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Default ports
+const (
+	ClientPort = 63321
+	ServerPort = 63322
+)
+
+// Op is the operation of a message.
+type Op byte
+
+// Operations
+const (
+	OpReadRequest   Op = 1
+	OpReadResponse  Op = 2
+	OpWriteRequest  Op = 3
+	OpWriteResponse Op = 4
+)
+
+// Record types
+const (
+	TypeModel      uint16 = 0x0001
+	TypeName       uint16 = 0x0003
+	TypeMAC        uint16 = 0x0004
+	TypeIP         uint16 = 0x0006
+	TypeNetmask    uint16 = 0x0007
+	TypeGateway    uint16 = 0x0008
+	TypeDHCP       uint16 = 0x000b
+	TypeFirmware   uint16 = 0x000d
+	TypePortStatus uint16 = 0x0c00
+	TypePortCount  uint16 = 0x6000
+	typeEnd        uint16 = 0xffff
+)
+
+const headerLen = 32
+
+var signature = []byte("NSDP")
+
+// TLV is one type-length-value record.
+type TLV struct {
+	Type  uint16
+	Value []byte
+}
+
+// Message is one NSDP request or response.
+type Message struct {
+	Op Op
+	// Result is non-zero when a switch rejects a request.
+	Result uint16
+	// HostMAC is the MAC address of the computer asking.
+	HostMAC net.HardwareAddr
+	// DeviceMAC is the switch asked, or all zeros for every switch.
+	DeviceMAC net.HardwareAddr
+	// Seq matches responses to their request.
+	Seq  uint16
+	TLVs []TLV
+}
+
+// MarshalBinary encodes m with its end marker.
+func (m *Message) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	header := make([]byte, headerLen)
+	header[0] = 1 // protocol version
+	header[1] = byte(m.Op)
+	binary.BigEndian.PutUint16(header[2:4], m.Result)
+	if err := putMAC(header[8:14], m.HostMAC); err != nil {
+		return nil, fmt.Errorf("host MAC: %w", err)
+	}
+	if err := putMAC(header[14:20], m.DeviceMAC); err != nil {
+		return nil, fmt.Errorf("device MAC: %w", err)
+	}
+	binary.BigEndian.PutUint16(header[22:24], m.Seq)
+	copy(header[24:28], signature)
+	b.Write(header)
+
+	for _, t := range m.TLVs {
+		if len(t.Value) > 0xffff {
+			return nil, fmt.Errorf("record %#04x is too long", t.Type)
+		}
+		binary.Write(&b, binary.BigEndian, t.Type)
+		binary.Write(&b, binary.BigEndian, uint16(len(t.Value)))
+		b.Write(t.Value)
+	}
+	binary.Write(&b, binary.BigEndian, typeEnd)
+	binary.Write(&b, binary.BigEndian, uint16(0))
+	return b.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a message, stopping at the end marker.
+func (m *Message) UnmarshalBinary(data []byte) error {
+	if len(data) < headerLen {
+		return errors.New("message too short")
+	}
+	if !bytes.Equal(data[24:28], signature) {
+		return errors.New("not an NSDP message")
+	}
+	*m = Message{
+		Op:        Op(data[1]),
+		Result:    binary.BigEndian.Uint16(data[2:4]),
+		HostMAC:   net.HardwareAddr(bytes.Clone(data[8:14])),
+		DeviceMAC: net.HardwareAddr(bytes.Clone(data[14:20])),
+		Seq:       binary.BigEndian.Uint16(data[22:24]),
+	}
+	for rest := data[headerLen:]; len(rest) >= 4; {
+		typ := binary.BigEndian.Uint16(rest[0:2])
+		n := int(binary.BigEndian.Uint16(rest[2:4]))
+		if typ == typeEnd {
+			return nil
+		}
+		if len(rest) < 4+n {
+			return fmt.Errorf("record %#04x is truncated", typ)
+		}
+		m.TLVs = append(m.TLVs, TLV{Type: typ, Value: bytes.Clone(rest[4 : 4+n])})
+		rest = rest[4+n:]
+	}
+	// Some firmware leaves out the end marker
+	return nil
+}
+
+func putMAC(dst []byte, mac net.HardwareAddr) error {
+	if mac == nil {
+		return nil
+	}
+	if len(mac) != 6 {
+		return fmt.Errorf("%s is not a 6-byte MAC address", mac)
+	}
+	copy(dst, mac)
+	return nil
+}
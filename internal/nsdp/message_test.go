@@ -0,0 +1,157 @@
+package nsdp
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var (
+	testHost   = net.HardwareAddr{0x02, 0, 0, 0, 0, 0x01}
+	testDevice = net.HardwareAddr{0x28, 0x94, 0x0f, 0x01, 0x02, 0x03}
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  Message
+	}{
+		{
+			name: "read request",
+			msg: Message{Op: OpReadRequest, HostMAC: testHost, DeviceMAC: make(net.HardwareAddr, 6), Seq: 0x1234,
+				TLVs: []TLV{{Type: TypeModel, Value: []byte{}}, {Type: TypeName, Value: []byte{}}}},
+		},
+		{
+			name: "read response",
+			msg: Message{Op: OpReadResponse, HostMAC: testHost, DeviceMAC: testDevice, Seq: 7,
+				TLVs: []TLV{
+					{Type: TypeModel, Value: []byte("GS308EP")},
+					{Type: TypeIP, Value: []byte{192, 168, 1, 10}},
+					{Type: TypePortStatus, Value: []byte{1, 5, 1}},
+				}},
+		},
+		{
+			name: "rejected",
+			msg:  Message{Op: OpWriteResponse, Result: 0x0700, HostMAC: testHost, DeviceMAC: testDevice, Seq: 0xffff},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.msg.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasSuffix(data, []byte{0xff, 0xff, 0, 0}) {
+				t.Errorf("no end marker: % x", data)
+			}
+			var got Message
+			if err := got.UnmarshalBinary(data); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.msg) {
+				t.Errorf("round trip = %+v, want %+v", got, tt.msg)
+			}
+		})
+	}
+}
+
+func TestMarshalHeader(t *testing.T) {
+	m := Message{Op: OpReadRequest, HostMAC: testHost, Seq: 0x0102}
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		1, 1, 0, 0, 0, 0, 0, 0, // version, op, result, reserved
+		0x02, 0, 0, 0, 0, 0x01, // host MAC
+		0, 0, 0, 0, 0, 0, // device MAC, all switches
+		0, 0, 0x01, 0x02, // reserved, sequence
+		'N', 'S', 'D', 'P', 0, 0, 0, 0,
+		0xff, 0xff, 0, 0, // end marker
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("MarshalBinary =\n% x\nwant\n% x", data, want)
+	}
+
+	m.HostMAC = net.HardwareAddr{1, 2, 3}
+	if _, err := m.MarshalBinary(); err == nil {
+		t.Error("3-byte host MAC accepted")
+	}
+	m = Message{TLVs: []TLV{{Type: TypeName, Value: make([]byte, 0x10000)}}}
+	if _, err := m.MarshalBinary(); err == nil {
+		t.Error("oversize record accepted")
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	header := func() []byte {
+		m := Message{Op: OpReadResponse, HostMAC: testHost, DeviceMAC: testDevice, Seq: 9}
+		data, _ := m.MarshalBinary()
+		return data[:headerLen]
+	}
+	record := func(typ uint16, value ...byte) []byte {
+		return append([]byte{byte(typ >> 8), byte(typ), 0, byte(len(value))}, value...)
+	}
+	join := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+	tests := []struct {
+		name     string
+		data     []byte
+		wantTLVs []TLV
+		errText  string
+	}{
+		{
+			name:    "short",
+			data:    header()[:20],
+			errText: "too short",
+		},
+		{
+			name:    "bad signature",
+			data:    append(header()[:24], 'X', 'X', 'X', 'X', 0, 0, 0, 0),
+			errText: "not an NSDP message",
+		},
+		{
+			name:    "truncated record",
+			data:    join(header(), record(TypeModel, 'G', 'S'), []byte{0, 3, 0, 8, 'a'}),
+			errText: "record 0x0003 is truncated",
+		},
+		{
+			// Some firmware leaves out the end marker
+			name:     "missing end marker",
+			data:     join(header(), record(TypeModel, 'G', 'S'), record(TypeDHCP, 1)),
+			wantTLVs: []TLV{{Type: TypeModel, Value: []byte("GS")}, {Type: TypeDHCP, Value: []byte{1}}},
+		},
+		{
+			name:     "records after the end marker",
+			data:     join(header(), record(TypeModel, 'G', 'S'), record(typeEnd), record(TypeName, 'x')),
+			wantTLVs: []TLV{{Type: TypeModel, Value: []byte("GS")}},
+		},
+		{
+			name: "header only",
+			data: header(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m Message
+			err := m.UnmarshalBinary(tt.data)
+			if tt.errText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errText) {
+					t.Fatalf("error = %v, want %q", err, tt.errText)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Op != OpReadResponse || m.Seq != 9 || m.DeviceMAC.String() != testDevice.String() {
+				t.Errorf("header = %+v", m)
+			}
+			if !reflect.DeepEqual(m.TLVs, tt.wantTLVs) {
+				t.Errorf("TLVs = %+v, want %+v", m.TLVs, tt.wantTLVs)
+			}
+		})
+	}
+}
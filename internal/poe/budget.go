@@ -0,0 +1,175 @@
+package poe
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ModelBudgets are the total PoE budgets in watts of the switch models the
+// library supports, from Netgear's data sheets.
+var ModelBudgets = map[string]float64{
+	"GS305EP":  63,
+	"GS305EPP": 120,
+	"GS308EP":  62,
+	"GS308EPP": 123,
+	"GS316EP":  180,
+	"GS316EPP": 231,
+}
+
+// MaxPortWatts is the most an 802.3at (PoE+) port supplies. It is the
+// allocation assumed for a port whose class is unknown.
+const MaxPortWatts = 30
+
+// classWatts is the power a switch allocates for each 802.3af/at/bt class,
+// measured at the switch.
+var classWatts = []float64{15.4, 4, 7, 15.4, 30, 45, 60, 75, 90}
+
+// ModelBudget returns the PoE budget of model, ignoring case and any
+// hardware version suffix such as "v2".
+func ModelBudget(model string) (float64, bool) {
+	model = strings.ToUpper(strings.TrimSpace(model))
+	if w, ok := ModelBudgets[model]; ok {
+		return w, true
+	}
+	if i := strings.LastIndex(model, "V"); i > 0 {
+		if w, ok := ModelBudgets[model[:i]]; ok {
+			return w, true
+		}
+	}
+	return 0, false
+}
+
+// ResolveBudget returns override when it is set, otherwise the budget of
+// model.
+func ResolveBudget(model string, override float64) (float64, bool) {
+	if override > 0 {
+		return override, true
+	}
+	return ModelBudget(model)
+}
+
+// ClassWatts returns the allocation for a class as printed by the switch,
+// such as "4", "Class 4" or "class4".
+func ClassWatts(class string) (float64, bool) {
+	digits := strings.TrimLeftFunc(class, func(c rune) bool { return !unicode.IsDigit(c) })
+	n, err := strconv.Atoi(digits)
+	if err != nil || n < 0 || n >= len(classWatts) {
+		return 0, false
+	}
+	return classWatts[n], true
+}
+
+// Allocation is the power the switch sets aside for a port: its user power
+// limit when one is configured, else the maximum for its class, else
+// MaxPortWatts.
+func Allocation(status PortStatus, setting PortSettings) float64 {
+	if strings.EqualFold(setting.LimitType, "user") {
+		if limit := leadingNumber(setting.Limit); limit > 0 {
+			return limit
+		}
+	}
+	if w, ok := ClassWatts(status.Class); ok {
+		return w
+	}
+	return MaxPortWatts
+}
+
+// leadingNumber parses the number at the start of s, such as "15.4" in
+// "15.4 W". It returns 0 if there is none.
+func leadingNumber(s string) float64 {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0
+	}
+	f, _ := strconv.ParseFloat(fields[0], 64)
+	return f
+}
+
+func round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
+
+// Budget is the power accounting of one switch.
+type Budget struct {
+	Model string  `json:"model,omitempty"`
+	Total float64 `json:"budget_w"`
+	// Used is what the ports draw now.
+	Used float64 `json:"used_w"`
+	// Reserved is the headroom held for powered ports between their draw
+	// and their allocation.
+	Reserved float64 `json:"reserved_w"`
+	// Available is what is left for more ports.
+	Available float64      `json:"available_w"`
+	Ports     []PortBudget `json:"ports"`
+}
+
+// PortBudget is one port's share of the budget.
+type PortBudget struct {
+	Port       int     `json:"port"`
+	Name       string  `json:"name,omitempty"`
+	Enabled    bool    `json:"enabled"`
+	Status     string  `json:"status"`
+	Class      string  `json:"class,omitempty"`
+	Draw       float64 `json:"draw_w"`
+	Allocation float64 `json:"allocation_w"`
+
+	// allocation is what enabling the port would set aside, for Project
+	allocation float64
+}
+
+// ComputeBudget accounts for total watts across the ports. Only ports
+// delivering power hold an allocation beyond their draw, and only when
+// their power limit type is "class" or "user"; with "none" the switch
+// allocates what is drawn. An enabled port with nothing attached holds
+// nothing.
+func ComputeBudget(model string, total float64, statuses []PortStatus, settings []PortSettings) Budget {
+	bySetting := make(map[int]PortSettings, len(settings))
+	for _, s := range settings {
+		bySetting[s.Port] = s
+	}
+
+	b := Budget{Model: model, Total: total}
+	for _, st := range statuses {
+		setting, known := bySetting[st.Port]
+		p := PortBudget{
+			Port:       st.Port,
+			Name:       st.Name,
+			Enabled:    !known || setting.Enabled(),
+			Status:     st.Status,
+			Class:      st.Class,
+			Draw:       st.Power,
+			Allocation: st.Power,
+			allocation: Allocation(st, setting),
+		}
+		if st.Delivering() && !strings.EqualFold(setting.LimitType, "none") {
+			p.Allocation = max(p.allocation, p.Draw)
+		}
+		b.Used += p.Draw
+		b.Reserved += p.Allocation - p.Draw
+		b.Ports = append(b.Ports, p)
+	}
+	sort.Slice(b.Ports, func(i, j int) bool { return b.Ports[i].Port < b.Ports[j].Port })
+	b.Used = round2(b.Used)
+	b.Reserved = round2(b.Reserved)
+	b.Available = round2(b.Total - b.Used - b.Reserved)
+	return b
+}
+
+// Project returns the extra allocation needed to enable ports, counting
+// only ports that are disabled now.
+func (b Budget) Project(ports []int) float64 {
+	want := make(map[int]bool, len(ports))
+	for _, p := range ports {
+		want[p] = true
+	}
+	var extra float64
+	for _, p := range b.Ports {
+		if want[p.Port] && !p.Enabled {
+			extra += p.allocation
+		}
+	}
+	return extra
+}
@@ -0,0 +1,60 @@
+// Package poe turns the go-netgear library's printed output back into
+// structured port data.
+//
+// The library commands print their results (JSON when
+// GlobalOptions.OutputFormat is JsonFormat) to standard output instead of
+// returning them, so callers capture that output and parse it here.
+package poe
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// captureMu serialises Capture and Exclusive calls: os.Stdout is
+// process-wide, so anything printed during a capture would be read as part
+// of its output.
+var captureMu sync.Mutex
+
+// Exclusive runs fn, which prints to os.Stdout, while no Capture is in
+// progress, so its output reaches stdout instead of another caller's
+// capture. Every library call that prints must go through Capture or
+// Exclusive.
+func Exclusive(fn func() error) error {
+	captureMu.Lock()
+	defer captureMu.Unlock()
+	return fn()
+}
+
+// Capture runs fn with os.Stdout redirected and returns what it printed.
+func Capture(fn func() error) ([]byte, error) {
+	captureMu.Lock()
+	defer captureMu.Unlock()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	oldStdout := os.Stdout
+	os.Stdout = w
+
+	// Consume pipe output in goroutine to prevent blocking
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		io.Copy(&buf, r)
+		close(done)
+	}()
+
+	runErr := fn()
+
+	w.Close()
+	<-done
+	r.Close()
+	os.Stdout = oldStdout
+
+	return buf.Bytes(), runErr
+}
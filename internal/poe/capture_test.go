@@ -0,0 +1,55 @@
+package poe
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCapture(t *testing.T) {
+	out, err := Capture(func() error {
+		fmt.Print(`[{"port":1}]`)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `[{"port":1}]` {
+		t.Errorf("captured %q", out)
+	}
+}
+
+func TestExclusiveWaitsForCapture(t *testing.T) {
+	stdout := os.Stdout
+	inCapture := make(chan struct{})
+	release := make(chan struct{})
+	captured := make(chan []byte)
+	go func() {
+		out, _ := Capture(func() error {
+			close(inCapture)
+			<-release
+			return nil
+		})
+		captured <- out
+	}()
+	<-inCapture
+
+	ran := make(chan *os.File)
+	go Exclusive(func() error {
+		ran <- os.Stdout
+		return nil
+	})
+	select {
+	case <-ran:
+		t.Fatal("Exclusive ran during a capture")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if out := <-captured; len(out) != 0 {
+		t.Errorf("captured %q", out)
+	}
+	if f := <-ran; f != stdout {
+		t.Error("Exclusive ran with stdout redirected")
+	}
+}
@@ -0,0 +1,221 @@
+package poe
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// PortStatus is one row of PoeStatusCommand output.
+type PortStatus struct {
+	Port        int     `json:"port"`
+	Name        string  `json:"name"`
+	Status      string  `json:"status"`
+	Class       string  `json:"class"`
+	Voltage     float64 `json:"voltage_v"`
+	Current     float64 `json:"current_ma"`
+	Power       float64 `json:"power_w"`
+	Temperature float64 `json:"temperature_c"`
+	Error       string  `json:"error"`
+}
+
+// Delivering reports whether the port is currently powering a device.
+func (s PortStatus) Delivering() bool {
+	return strings.EqualFold(s.Status, "Delivering Power")
+}
+
+// Faulted reports whether the port reports an error, such as an overload
+// or short circuit, rather than "No Error".
+func (s PortStatus) Faulted() bool {
+	switch strings.ToLower(strings.TrimSpace(s.Error)) {
+	case "", "no error", "none", "noerror":
+	default:
+		return true
+	}
+	status := strings.ToLower(s.Status)
+	return strings.Contains(status, "fault") || strings.Contains(status, "overload") ||
+		strings.Contains(status, "short")
+}
+
+// PortSettings is one row of PoeShowSettingsCommand output.
+type PortSettings struct {
+	Port            int    `json:"port"`
+	Name            string `json:"name"`
+	Power           string `json:"power"`
+	Mode            string `json:"mode"`
+	Priority        string `json:"priority"`
+	LimitType       string `json:"limit_type"`
+	Limit           string `json:"limit_w"`
+	DetectionType   string `json:"detection_type"`
+	LongerDetection string `json:"longer_detection"`
+}
+
+// Enabled reports whether PoE is administratively enabled on the port.
+func (s PortSettings) Enabled() bool {
+	switch strings.ToLower(s.Power) {
+	case "enabled", "enable", "on", "true":
+		return true
+	}
+	return false
+}
+
+// Column names vary between library versions and switch series, so each
+// field lists the normalised header names it may appear under.
+var (
+	portKeys    = []string{"portid", "port"}
+	nameKeys    = []string{"portname", "name"}
+	statusKeys  = []string{"status", "portstatus"}
+	classKeys   = []string{"powerclass", "portpwrclass", "class"}
+	voltKeys    = []string{"voltagev", "voltage"}
+	currentKeys = []string{"currentma", "current"}
+	powerKeys   = []string{"powerw", "portpwrw", "power"}
+	tempKeys    = []string{"tempc", "temperaturec", "temperature", "temp"}
+	errorKeys   = []string{"errorstatus", "error"}
+
+	portPowerKeys = []string{"portpower", "portpwr", "power"}
+	modeKeys      = []string{"mode", "powermode", "pwrmode"}
+	prioKeys      = []string{"priority", "portprio"}
+	limitTypeKeys = []string{"limittype"}
+	limitKeys     = []string{"limitw", "powerlimitw", "limit", "pwrlimit"}
+	detectKeys    = []string{"type", "detectiontype", "detectype"}
+	longerKeys    = []string{"longerdetectiontime", "longerdetection"}
+)
+
+// ParseStatus parses PoeStatusCommand JSON output.
+func ParseStatus(data []byte) ([]PortStatus, error) {
+	rows, err := parseRows(data)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]PortStatus, 0, len(rows))
+	for _, row := range rows {
+		port, err := row.port()
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, PortStatus{
+			Port:        port,
+			Name:        row.str(nameKeys),
+			Status:      row.str(statusKeys),
+			Class:       row.str(classKeys),
+			Voltage:     row.num(voltKeys),
+			Current:     row.num(currentKeys),
+			Power:       row.num(powerKeys),
+			Temperature: row.num(tempKeys),
+			Error:       row.str(errorKeys),
+		})
+	}
+	return statuses, nil
+}
+
+// ParseSettings parses PoeShowSettingsCommand JSON output.
+func ParseSettings(data []byte) ([]PortSettings, error) {
+	rows, err := parseRows(data)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := make([]PortSettings, 0, len(rows))
+	for _, row := range rows {
+		port, err := row.port()
+		if err != nil {
+			return nil, err
+		}
+		settings = append(settings, PortSettings{
+			Port:            port,
+			Name:            row.str(nameKeys),
+			Power:           row.str(portPowerKeys),
+			Mode:            row.str(modeKeys),
+			Priority:        row.str(prioKeys),
+			LimitType:       row.str(limitTypeKeys),
+			Limit:           row.str(limitKeys),
+			DetectionType:   row.str(detectKeys),
+			LongerDetection: row.str(longerKeys),
+		})
+	}
+	return settings, nil
+}
+
+// row is one table row keyed by normalised column name.
+type row map[string]interface{}
+
+// parseRows decodes {"<table>": [{"Column": value, ...}, ...]}. The table
+// name is ignored since each command prints a single table.
+func parseRows(data []byte) ([]row, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no output to parse")
+	}
+
+	var tables map[string][]map[string]interface{}
+	if err := json.Unmarshal(data, &tables); err != nil {
+		return nil, fmt.Errorf("failed to parse switch output: %w", err)
+	}
+
+	var rows []row
+	for _, table := range tables {
+		for _, raw := range table {
+			r := make(row, len(raw))
+			for k, v := range raw {
+				r[normalise(k)] = v
+			}
+			rows = append(rows, r)
+		}
+	}
+	return rows, nil
+}
+
+func (r row) port() (int, error) {
+	raw := r.str(portKeys)
+	// Some firmware prefixes the port ID, e.g. "g3".
+	digits := strings.TrimLeftFunc(raw, func(c rune) bool { return !unicode.IsDigit(c) })
+	port, err := strconv.Atoi(digits)
+	if err != nil {
+		return 0, fmt.Errorf("invalid port ID %q in switch output", raw)
+	}
+	return port, nil
+}
+
+func (r row) str(keys []string) string {
+	for _, k := range keys {
+		switch v := r[k].(type) {
+		case string:
+			return strings.TrimSpace(v)
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			return strconv.FormatBool(v)
+		}
+	}
+	return ""
+}
+
+func (r row) num(keys []string) float64 {
+	s := r.str(keys)
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	// Tolerate units in the value, e.g. "3.4 W".
+	if fields := strings.Fields(s); len(fields) > 0 {
+		if f, err := strconv.ParseFloat(fields[0], 64); err == nil {
+			return f
+		}
+	}
+	return 0
+}
+
+// normalise lower-cases a column name and drops everything but letters and
+// digits, so "Temp. (°C)" becomes "tempc".
+func normalise(key string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(key) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,60 @@
+package poe
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParsePorts parses port arguments such as "1", "3,5", "1-8" and
+// "1-8 14-16" into a list of unique port numbers in the order given.
+func ParsePorts(args []string) ([]int, error) {
+	var ports []int
+	seen := make(map[int]bool) // Track seen ports to avoid duplicates
+
+	add := func(port int) {
+		if !seen[port] {
+			ports = append(ports, port)
+			seen[port] = true
+		}
+	}
+
+	for _, arg := range args {
+		// Handle comma-separated lists
+		for _, p := range strings.Split(arg, ",") {
+			p = strings.TrimSpace(p)
+
+			// Check if it's a range (e.g., "1-8")
+			if strings.Contains(p, "-") {
+				rangeParts := strings.SplitN(p, "-", 2)
+
+				start, err := strconv.Atoi(strings.TrimSpace(rangeParts[0]))
+				if err != nil {
+					return nil, fmt.Errorf("invalid port range start: %s", rangeParts[0])
+				}
+
+				end, err := strconv.Atoi(strings.TrimSpace(rangeParts[1]))
+				if err != nil {
+					return nil, fmt.Errorf("invalid port range end: %s", rangeParts[1])
+				}
+
+				if start > end {
+					return nil, fmt.Errorf("invalid port range %s: start must be <= end", p)
+				}
+
+				// Add all ports in the range
+				for port := start; port <= end; port++ {
+					add(port)
+				}
+			} else {
+				// Single port number
+				port, err := strconv.Atoi(p)
+				if err != nil {
+					return nil, fmt.Errorf("invalid port number: %s", p)
+				}
+				add(port)
+			}
+		}
+	}
+	return ports, nil
+}
@@ -0,0 +1,203 @@
+package poe
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"netgearcli/internal/ansi"
+)
+
+// TableOptions control WriteTable.
+type TableOptions struct {
+	// Color highlights status, faults and budget usage with ANSI colors.
+	Color bool
+	// Budget is the switch's PoE budget in watts. Zero leaves it out of the
+	// summary.
+	Budget float64
+}
+
+// column is one table column. Numeric columns are right-aligned.
+type column struct {
+	title string
+	right bool
+}
+
+// Indexes of the columns colored by port state
+const (
+	statusColumn = 3
+	errorColumn  = 9
+)
+
+var tableColumns = []column{
+	{"PORT", true}, {"LABEL", false}, {"ADMIN", false}, {"STATUS", false}, {"CLASS", false},
+	{"V", true}, {"mA", true}, {"W", true}, {"°C", true}, {"ERROR", false},
+}
+
+// WriteTable writes statuses as an aligned table followed by a summary of
+// delivering ports, total draw and remaining budget. settings supplies each
+// port's admin state and power limit, and may be nil.
+func WriteTable(w io.Writer, statuses []PortStatus, settings []PortSettings, opts TableOptions) error {
+	statuses = append([]PortStatus(nil), statuses...)
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Port < statuses[j].Port })
+
+	admin := make(map[int]string, len(settings))
+	for _, s := range settings {
+		admin[s.Port] = "disabled"
+		if s.Enabled() {
+			admin[s.Port] = "enabled"
+		}
+	}
+
+	// Build the cells and the color of each row's status and error
+	rows := make([][]string, len(statuses))
+	colors := make([]string, len(statuses))
+	for i, s := range statuses {
+		state := admin[s.Port]
+		if state == "" {
+			state = "-"
+		}
+		errText := "-"
+		if s.Faulted() {
+			errText = orDash(s.Error)
+		}
+		rows[i] = []string{
+			fmt.Sprint(s.Port),
+			orDash(s.Name),
+			state,
+			orDash(s.Status),
+			orDash(s.Class),
+			fmt.Sprintf("%.1f", s.Voltage),
+			fmt.Sprintf("%.0f", s.Current),
+			fmt.Sprintf("%.2f", s.Power),
+			temperature(s.Temperature),
+			errText,
+		}
+		switch {
+		case s.Faulted():
+			colors[i] = ansi.Red
+		case s.Delivering():
+			colors[i] = ansi.Green
+		case state == "disabled":
+			colors[i] = ansi.Dim
+		}
+	}
+
+	widths := make([]int, len(tableColumns))
+	for c, col := range tableColumns {
+		widths[c] = utf8.RuneCountInString(col.title)
+		for _, row := range rows {
+			widths[c] = max(widths[c], utf8.RuneCountInString(row[c]))
+		}
+	}
+
+	var b strings.Builder
+	header := make([]string, len(tableColumns))
+	for c, col := range tableColumns {
+		header[c] = col.title
+	}
+	writeRow(&b, header, widths, nil, opts.Color, ansi.Bold)
+	for i, row := range rows {
+		// Status takes the row's color, and the error is red for faults
+		cellColors := make([]string, len(tableColumns))
+		cellColors[statusColumn] = colors[i]
+		if colors[i] == ansi.Red {
+			cellColors[errorColumn] = ansi.Red
+		}
+		writeRow(&b, row, widths, cellColors, opts.Color, "")
+	}
+
+	b.WriteString("\n")
+	writeSummary(&b, statuses, settings, opts)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeRow pads each cell to its column width and colors it if asked to.
+// Padding is added outside the color codes so they do not upset alignment.
+func writeRow(b *strings.Builder, cells []string, widths []int, cellColors []string, color bool, rowColor string) {
+	for c, cell := range cells {
+		if c > 0 {
+			b.WriteString("  ")
+		}
+		pad := strings.Repeat(" ", widths[c]-utf8.RuneCountInString(cell))
+		last := c == len(cells)-1
+		if last && !tableColumns[c].right {
+			pad = "" // no trailing spaces
+		}
+
+		style := rowColor
+		if cellColors != nil && cellColors[c] != "" {
+			style = cellColors[c]
+		}
+		if color && style != "" {
+			cell = style + cell + ansi.Reset
+		}
+		if tableColumns[c].right {
+			b.WriteString(pad + cell)
+		} else {
+			b.WriteString(cell + pad)
+		}
+	}
+	b.WriteString("\n")
+}
+
+// writeSummary writes the footer below the table. The remaining budget is
+// the same Available as "netgear budget": powered ports count at their
+// allocation, not only at their draw.
+func writeSummary(b *strings.Builder, statuses []PortStatus, settings []PortSettings, opts TableOptions) {
+	var total float64
+	delivering := 0
+	var faults []string
+	for _, s := range statuses {
+		total += s.Power
+		if s.Delivering() {
+			delivering++
+		}
+		if s.Faulted() {
+			faults = append(faults, fmt.Sprintf("port %d (%s)", s.Port, orDash(s.Error)))
+		}
+	}
+
+	paint := func(style, text string) string {
+		if opts.Color && style != "" {
+			return style + text + ansi.Reset
+		}
+		return text
+	}
+
+	fmt.Fprintf(b, "Ports delivering: %d of %d\n", delivering, len(statuses))
+	fmt.Fprintf(b, "Total power:      %.2f W\n", total)
+	if opts.Budget > 0 {
+		budget := ComputeBudget("", opts.Budget, statuses, settings)
+		allocated := (budget.Used + budget.Reserved) / budget.Total
+		style := ansi.Green
+		switch {
+		case allocated >= 0.9:
+			style = ansi.Red
+		case allocated >= 0.7:
+			style = ansi.Yellow
+		}
+		fmt.Fprintf(b, "Budget remaining: %s of %.0f W (%.0f%% allocated, %.2f W reserved)\n",
+			paint(style, fmt.Sprintf("%.2f W", budget.Available)), budget.Total, allocated*100, budget.Reserved)
+	}
+	if len(faults) > 0 {
+		fmt.Fprintf(b, "Faults:           %s\n", paint(ansi.Red, strings.Join(faults, ", ")))
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func temperature(c float64) string {
+	if c == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f", c)
+}
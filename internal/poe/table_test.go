@@ -0,0 +1,45 @@
+package poe
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteTableBudget(t *testing.T) {
+	statuses := []PortStatus{
+		{Port: 1, Status: "Delivering Power", Class: "class4", Power: 4.5},
+		{Port: 2, Status: "Delivering Power", Class: "class3", Power: 4.0},
+		{Port: 3, Status: "Searching", Class: "class4"},
+	}
+	tests := []struct {
+		name     string
+		settings []PortSettings
+		want     string
+	}{
+		{
+			// Ports 1 and 2 hold their class maximum, 30 W and 15.4 W
+			name: "class allocations",
+			want: "Budget remaining: 17.60 W of 63 W (72% allocated, 36.90 W reserved)",
+		},
+		{
+			name: "user limit and none",
+			settings: []PortSettings{
+				{Port: 1, Power: "enabled", LimitType: "user", Limit: "10.0 W"},
+				{Port: 2, Power: "enabled", LimitType: "none"},
+				{Port: 3, Power: "enabled"},
+			},
+			want: "Budget remaining: 49.00 W of 63 W (22% allocated, 5.50 W reserved)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := WriteTable(&b, statuses, tt.settings, TableOptions{Budget: 63}); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(b.String(), tt.want+"\n") {
+				t.Errorf("summary:\n%s\nwant %q", b.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+// Package probe identifies Netgear PoE switches over HTTP: which series a
+// switch belongs to and its model, from the login page that needs no
+// password, and its firmware version from the system information page once
+// logged in.
+package probe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"netgearcli/internal/poe"
+)
+
+// Switch series. The GS305EP(P) and GS308EP(P) share one web interface and
+// the GS316EP(P) another.
+const (
+	SeriesGS30x = "GS30x"
+	SeriesGS316 = "GS316"
+)
+
+// loginPages are the login page of each series.
+var loginPages = []struct {
+	series string
+	path   string
+}{
+	{SeriesGS30x, "/login.cgi"},
+	{SeriesGS316, "/wmi/login"},
+}
+
+// maxBody bounds how much of a page is read.
+const maxBody = 1 << 20
+
+// Identity is what a probe learned about a switch.
+type Identity struct {
+	Address string `json:"address"`
+	Series  string `json:"series,omitempty"`
+	Model   string `json:"model,omitempty"`
+}
+
+// ModelSeries returns the series of a model such as "GS316EPP", or "" if
+// it is not one the library supports.
+func ModelSeries(model string) string {
+	if _, ok := poe.ModelBudget(model); !ok {
+		return ""
+	}
+	if strings.HasPrefix(strings.ToUpper(model), "GS316") {
+		return SeriesGS316
+	}
+	return SeriesGS30x
+}
+
+// Identify asks address for each series' login page. The first Netgear
+// page found gives the series, and the model is looked for in the page. It
+// returns an error only when the address did not answer at all.
+func Identify(ctx context.Context, client *http.Client, address string) (Identity, error) {
+	id := Identity{Address: address}
+	var lastErr error
+	answered := false
+	for _, page := range loginPages {
+		status, body, err := get(ctx, client, "http://"+address+page.path, nil)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		answered = true
+		// Any web server may answer; only a Netgear page counts
+		model := FindModel(body)
+		if status != http.StatusOK || (model == "" && !strings.Contains(strings.ToUpper(body), "NETGEAR")) {
+			continue
+		}
+		id.Series = page.series
+		id.Model = model
+		if series := ModelSeries(id.Model); series != "" {
+			id.Series = series
+		}
+		return id, nil
+	}
+	if answered {
+		return id, nil
+	}
+	return id, lastErr
+}
+
+// models are the supported models, longest first so "GS316EPP" is found
+// before "GS316EP".
+var models = func() []string {
+	var names []string
+	for name := range poe.ModelBudgets {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) > len(names[j])
+		}
+		return names[i] < names[j]
+	})
+	return names
+}()
+
+// FindModel returns the first supported model named in page, or "".
+func FindModel(page string) string {
+	page = strings.ToUpper(page)
+	for _, name := range models {
+		if strings.Contains(page, name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// firmwarePattern finds the version after a "Firmware Version" label, in
+// an element, an input value or a script variable.
+var firmwarePattern = regexp.MustCompile(`(?is)firmware[ _]?ver(?:sion)?.{0,200}?\b(v?\d+(?:\.\d+){2,3})\b`)
+
+// Firmware reads the firmware version from the system information page of
+// a switch of the given series, using the token of a logged in session. It
+// returns "" without an error when the page does not show a version.
+func Firmware(ctx context.Context, client *http.Client, address, series, token string) (string, error) {
+	var url string
+	header := http.Header{}
+	switch series {
+	case SeriesGS30x:
+		url = "http://" + address + "/switch_info.htm"
+		header.Set("Cookie", "SID="+token)
+	case SeriesGS316:
+		url = "http://" + address + "/iss/specific/sysInfo.html?Gambit=" + token
+	default:
+		return "", fmt.Errorf("unknown series %q", series)
+	}
+	status, body, err := get(ctx, client, url, header)
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", url, http.StatusText(status))
+	}
+	if m := firmwarePattern.FindStringSubmatch(body); m != nil {
+		return strings.TrimPrefix(strings.ToLower(m[1]), "v"), nil
+	}
+	return "", nil
+}
+
+func get(ctx context.Context, client *http.Client, url string, header http.Header) (int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	return resp.StatusCode, string(body), err
+}
@@ -0,0 +1,155 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// pages serves fixed bodies by path; other paths are not found.
+type pages map[string]string
+
+func (p pages) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, ok := p[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write([]byte(body))
+}
+
+func TestIdentify(t *testing.T) {
+	tests := []struct {
+		name       string
+		pages      pages
+		wantSeries string
+		wantModel  string
+	}{
+		{
+			name:       "GS308EPP login page",
+			pages:      pages{"/login.cgi": `<title>NETGEAR GS308EPP</title>`},
+			wantSeries: SeriesGS30x,
+			wantModel:  "GS308EPP",
+		},
+		{
+			name:       "GS316 login page without a model",
+			pages:      pages{"/wmi/login": `<div class="logo">Netgear</div>`},
+			wantSeries: SeriesGS316,
+		},
+		{
+			// The model decides the series over the page that answered
+			name:       "model overrides the page's series",
+			pages:      pages{"/login.cgi": `GS316EP Smart Switch`},
+			wantSeries: SeriesGS316,
+			wantModel:  "GS316EP",
+		},
+		{
+			name:       "longest model wins",
+			pages:      pages{"/wmi/login": `GS316EPP`},
+			wantSeries: SeriesGS316,
+			wantModel:  "GS316EPP",
+		},
+		{
+			name:  "other web server",
+			pages: pages{"/login.cgi": `<h1>Welcome to nginx!</h1>`, "/wmi/login": `<h1>Welcome to nginx!</h1>`},
+		},
+		{
+			name:  "nothing found",
+			pages: pages{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.pages)
+			defer server.Close()
+
+			id, err := Identify(context.Background(), server.Client(), server.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id.Series != tt.wantSeries || id.Model != tt.wantModel {
+				t.Errorf("Identify = %+v, want series %q model %q", id, tt.wantSeries, tt.wantModel)
+			}
+			if id.Address != server.Listener.Addr().String() {
+				t.Errorf("Address = %q", id.Address)
+			}
+		})
+	}
+}
+
+func TestIdentifyNoAnswer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := l.Addr().String()
+	l.Close()
+
+	if _, err := Identify(context.Background(), http.DefaultClient, address); err == nil {
+		t.Error("Identify of a closed port succeeded")
+	}
+}
+
+func TestFirmware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/switch_info.htm":
+			if r.Header.Get("Cookie") != "SID=tok" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`<td>Firmware Version</td><td>V1.0.0.16</td>`))
+		case "/iss/specific/sysInfo.html":
+			if r.URL.Query().Get("Gambit") != "tok" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`var firmware_ver = "1.0.1.4";`))
+		}
+	}))
+	defer server.Close()
+	address := server.Listener.Addr().String()
+
+	tests := []struct {
+		name    string
+		series  string
+		token   string
+		want    string
+		errText string
+	}{
+		{name: "GS30x", series: SeriesGS30x, token: "tok", want: "1.0.0.16"},
+		{name: "GS316", series: SeriesGS316, token: "tok", want: "1.0.1.4"},
+		{name: "bad token", series: SeriesGS30x, token: "old", errText: "Unauthorized"},
+		{name: "unknown series", series: "XS", errText: "unknown series"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Firmware(context.Background(), server.Client(), address, tt.series, tt.token)
+			if tt.errText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errText) {
+					t.Fatalf("error = %v, want %q", err, tt.errText)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Firmware = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFirmwareNotShown(t *testing.T) {
+	server := httptest.NewServer(pages{"/switch_info.htm": `<td>System Name</td>`})
+	defer server.Close()
+
+	got, err := Firmware(context.Background(), server.Client(), server.Listener.Addr().String(), SeriesGS30x, "tok")
+	if err != nil || got != "" {
+		t.Errorf("Firmware = %q, %v, want no version and no error", got, err)
+	}
+}
@@ -0,0 +1,122 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxScanHosts bounds the size of a scanned network, a /16 for IPv4.
+const maxScanHosts = 1 << 16
+
+// ScanOptions control Scan.
+type ScanOptions struct {
+	// Port is the HTTP port probed. Zero means 80.
+	Port int
+	// Concurrency is how many hosts are probed at once. Defaults to 64.
+	Concurrency int
+	// Timeout bounds the probe of one host. Defaults to 2s.
+	Timeout time.Duration
+	// Client sends the requests. Defaults to a client that does not follow
+	// redirects.
+	Client *http.Client
+}
+
+// Hosts lists the addresses in prefix, leaving out the network and
+// broadcast addresses of IPv4 networks larger than a /31.
+func Hosts(prefix netip.Prefix) ([]netip.Addr, error) {
+	prefix = prefix.Masked()
+	bits := prefix.Addr().BitLen() - prefix.Bits()
+	if bits > 16 {
+		return nil, fmt.Errorf("%s has more than %d addresses", prefix, maxScanHosts)
+	}
+	var hosts []netip.Addr
+	for a := prefix.Addr(); prefix.Contains(a); a = a.Next() {
+		hosts = append(hosts, a)
+		if !a.Next().IsValid() {
+			break
+		}
+	}
+	if prefix.Addr().Is4() && bits > 1 {
+		hosts = hosts[1 : len(hosts)-1]
+	}
+	return hosts, nil
+}
+
+// Scan probes every host in prefix concurrently and returns the switches
+// found, sorted by address.
+func Scan(ctx context.Context, prefix netip.Prefix, opts ScanOptions) ([]Identity, error) {
+	hosts, err := Hosts(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 64
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 2 * time.Second
+	}
+	client := opts.Client
+	if client == nil {
+		// A redirect to a login page of another kind would be misread
+		client = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	}
+
+	var (
+		mu    sync.Mutex
+		found []Identity
+		wg    sync.WaitGroup
+	)
+	sem := make(chan struct{}, opts.Concurrency)
+	for _, host := range hosts {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return found, ctx.Err()
+		}
+		wg.Add(1)
+		go func(host netip.Addr) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			hostCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+			defer cancel()
+
+			address := host.String()
+			if opts.Port != 0 && opts.Port != 80 {
+				address = net.JoinHostPort(address, strconv.Itoa(opts.Port))
+			} else if host.Is6() {
+				address = "[" + address + "]"
+			}
+			id, err := Identify(hostCtx, client, address)
+			if err != nil || id.Series == "" {
+				return
+			}
+			mu.Lock()
+			found = append(found, id)
+			mu.Unlock()
+		}(host)
+	}
+	wg.Wait()
+
+	sort.Slice(found, func(i, j int) bool {
+		return addrOf(found[i].Address).Less(addrOf(found[j].Address))
+	})
+	return found, ctx.Err()
+}
+
+// addrOf parses the host of an address with or without a port.
+func addrOf(address string) netip.Addr {
+	if ap, err := netip.ParseAddrPort(address); err == nil {
+		return ap.Addr()
+	}
+	a, _ := netip.ParseAddr(strings.Trim(address, "[]"))
+	return a
+}
@@ -0,0 +1,107 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestHosts(t *testing.T) {
+	tests := []struct {
+		prefix  string
+		count   int
+		first   string
+		last    string
+		wantErr bool
+	}{
+		{prefix: "192.168.1.10/32", count: 1, first: "192.168.1.10", last: "192.168.1.10"},
+		// A point-to-point /31 has no network or broadcast address
+		{prefix: "192.168.1.10/31", count: 2, first: "192.168.1.10", last: "192.168.1.11"},
+		{prefix: "192.168.1.0/30", count: 2, first: "192.168.1.1", last: "192.168.1.2"},
+		{prefix: "192.168.1.77/24", count: 254, first: "192.168.1.1", last: "192.168.1.254"},
+		{prefix: "10.1.0.0/16", count: 65534, first: "10.1.0.1", last: "10.1.255.254"},
+		{prefix: "10.0.0.0/15", wantErr: true},
+		{prefix: "fd00::/120", count: 256, first: "fd00::", last: "fd00::ff"},
+		{prefix: "fd00::/112", count: 65536, first: "fd00::", last: "fd00::ffff"},
+		{prefix: "fd00::/64", wantErr: true},
+		{prefix: "::/0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			hosts, err := Hosts(netip.MustParsePrefix(tt.prefix))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Hosts = %d addresses, want an error", len(hosts))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(hosts) != tt.count {
+				t.Fatalf("Hosts = %d addresses, want %d", len(hosts), tt.count)
+			}
+			if hosts[0].String() != tt.first || hosts[len(hosts)-1].String() != tt.last {
+				t.Errorf("Hosts = %s..%s, want %s..%s", hosts[0], hosts[len(hosts)-1], tt.first, tt.last)
+			}
+		})
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.Handler
+		wantSeries string
+	}{
+		{
+			name:       "switch",
+			handler:    pages{"/wmi/login": `<title>NETGEAR GS316EPP</title>`},
+			wantSeries: SeriesGS316,
+		},
+		{
+			name:    "other web server",
+			handler: pages{"/login.cgi": `<h1>It works!</h1>`, "/wmi/login": `<h1>It works!</h1>`},
+		},
+		{
+			// A redirect to a Netgear page elsewhere is not this host's
+			// login page
+			name: "redirect",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/elsewhere" {
+					w.Write([]byte(`NETGEAR GS308EP`))
+					return
+				}
+				http.Redirect(w, r, "/elsewhere", http.StatusFound)
+			}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+			port := server.Listener.Addr().(*net.TCPAddr).Port
+
+			found, err := Scan(context.Background(), netip.MustParsePrefix("127.0.0.1/32"), ScanOptions{Port: port, Timeout: 5 * time.Second})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantSeries == "" {
+				if len(found) != 0 {
+					t.Errorf("Scan found %+v", found)
+				}
+				return
+			}
+			if len(found) != 1 || found[0].Series != tt.wantSeries {
+				t.Fatalf("Scan found %+v, want one %s switch", found, tt.wantSeries)
+			}
+			if found[0].Address != server.Listener.Addr().String() {
+				t.Errorf("Address = %q, want %q", found[0].Address, server.Listener.Addr().String())
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+// Package report turns recorded PoE history into energy and cost reports
+// that charge power back to the teams whose devices draw it.
+package report
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"netgearcli/internal/config"
+	"netgearcli/internal/history"
+	"netgearcli/internal/poe"
+)
+
+// Unassigned is the team of ports that match no team entry.
+const Unassigned = "unassigned"
+
+// noLabel groups ports without a label when grouping by label.
+const noLabel = "(no label)"
+
+// What an energy report can be grouped by
+const (
+	ByTeam   = "team"
+	ByLabel  = "label"
+	BySwitch = "switch"
+	ByPort   = "port"
+)
+
+// Teams assigns ports to teams from the report section of the config.
+type Teams struct {
+	entries []teamEntry
+}
+
+type teamEntry struct {
+	team   string
+	sw     string
+	ports  map[int]bool
+	labels []string
+}
+
+// NewTeams checks and compiles the team entries.
+func NewTeams(cfg []config.ReportTeam) (*Teams, error) {
+	t := &Teams{}
+	for i, tc := range cfg {
+		if tc.Team == "" {
+			return nil, fmt.Errorf("report team %d: no team name", i+1)
+		}
+		e := teamEntry{team: tc.Team, sw: tc.Switch, labels: tc.Labels}
+		if tc.Ports != "" {
+			ports, err := poe.ParsePorts(strings.Fields(tc.Ports))
+			if err != nil {
+				return nil, fmt.Errorf("report team %s: %w", tc.Team, err)
+			}
+			e.ports = make(map[int]bool, len(ports))
+			for _, p := range ports {
+				e.ports[p] = true
+			}
+		}
+		for _, pattern := range tc.Labels {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("report team %s: label pattern %q: %w", tc.Team, pattern, err)
+			}
+		}
+		t.entries = append(t.entries, e)
+	}
+	return t, nil
+}
+
+// Team returns the team a port is charged to.
+func (t *Teams) Team(sw string, port int, label string) string {
+	if t == nil {
+		return Unassigned
+	}
+	for _, e := range t.entries {
+		if e.matches(sw, port, label) {
+			return e.team
+		}
+	}
+	return Unassigned
+}
+
+func (e *teamEntry) matches(sw string, port int, label string) bool {
+	if e.sw != "" && e.sw != sw {
+		return false
+	}
+	if e.ports != nil && !e.ports[port] {
+		return false
+	}
+	if len(e.labels) == 0 {
+		return true
+	}
+	for _, pattern := range e.labels {
+		if ok, _ := path.Match(pattern, label); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Options control Build.
+type Options struct {
+	From, To time.Time
+	// PricePerKWh is the cost of one kWh. Zero leaves costs out.
+	PricePerKWh float64
+	Currency    string
+	// GroupBy is ByTeam, ByLabel, BySwitch or ByPort.
+	GroupBy string
+	Teams   *Teams
+}
+
+// Energy is an energy report over one period.
+type Energy struct {
+	From        time.Time    `json:"from"`
+	To          time.Time    `json:"to"`
+	PricePerKWh float64      `json:"price_per_kwh,omitempty"`
+	Currency    string       `json:"currency,omitempty"`
+	GroupBy     string       `json:"group_by"`
+	Groups      []Group      `json:"groups,omitempty"`
+	Ports       []PortEnergy `json:"ports"`
+	Total       Group        `json:"total"`
+}
+
+// Group is the energy used by a team, label or switch.
+type Group struct {
+	Name   string  `json:"name"`
+	Ports  int     `json:"ports"`
+	Energy float64 `json:"energy_kwh"`
+	Cost   float64 `json:"cost,omitempty"`
+}
+
+// PortEnergy is the energy used by one port.
+type PortEnergy struct {
+	Team    string  `json:"team"`
+	Switch  string  `json:"switch"`
+	Port    int     `json:"port"`
+	Label   string  `json:"label,omitempty"`
+	Samples int     `json:"samples"`
+	Avg     float64 `json:"avg_w"`
+	Max     float64 `json:"max_w"`
+	Energy  float64 `json:"energy_kwh"`
+	Cost    float64 `json:"cost,omitempty"`
+}
+
+// Costed reports whether the report has a price and so costs.
+func (e *Energy) Costed() bool {
+	return e.PricePerKWh > 0
+}
+
+// Build makes an energy report from per-port history statistics.
+func Build(stats []history.PortStats, opts Options) *Energy {
+	e := &Energy{
+		From:        opts.From,
+		To:          opts.To,
+		PricePerKWh: opts.PricePerKWh,
+		Currency:    opts.Currency,
+		GroupBy:     opts.GroupBy,
+		Total:       Group{Name: "Total"},
+	}
+	groups := make(map[string]*Group)
+	for _, st := range stats {
+		p := PortEnergy{
+			Team:    opts.Teams.Team(st.Switch, st.Port, st.Name),
+			Switch:  st.Switch,
+			Port:    st.Port,
+			Label:   st.Name,
+			Samples: st.Samples,
+			Avg:     st.Avg,
+			Max:     st.Max,
+			Energy:  st.Energy,
+			Cost:    st.Energy * opts.PricePerKWh,
+		}
+		e.Ports = append(e.Ports, p)
+		e.Total.add(p)
+
+		var name string
+		switch opts.GroupBy {
+		case ByTeam:
+			name = p.Team
+		case ByLabel:
+			name = p.Label
+			if name == "" {
+				name = noLabel
+			}
+		case BySwitch:
+			name = p.Switch
+		default:
+			continue
+		}
+		g, ok := groups[name]
+		if !ok {
+			g = &Group{Name: name}
+			groups[name] = g
+		}
+		g.add(p)
+	}
+
+	for _, g := range groups {
+		e.Groups = append(e.Groups, *g)
+	}
+	// Alphabetical, with the catch-all groups last
+	last := func(name string) bool { return name == Unassigned || name == noLabel }
+	sort.Slice(e.Groups, func(i, j int) bool {
+		a, b := e.Groups[i].Name, e.Groups[j].Name
+		if last(a) != last(b) {
+			return last(b)
+		}
+		return a < b
+	})
+	sort.SliceStable(e.Ports, func(i, j int) bool {
+		a, b := e.Ports[i], e.Ports[j]
+		if opts.GroupBy == ByTeam && a.Team != b.Team {
+			if last(a.Team) != last(b.Team) {
+				return last(b.Team)
+			}
+			return a.Team < b.Team
+		}
+		if a.Switch != b.Switch {
+			return a.Switch < b.Switch
+		}
+		return a.Port < b.Port
+	})
+	return e
+}
+
+func (g *Group) add(p PortEnergy) {
+	g.Ports++
+	g.Energy += p.Energy
+	g.Cost += p.Cost
+}
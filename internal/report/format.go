@@ -0,0 +1,143 @@
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// periodLayout formats the start and end of the report period
+const periodLayout = "2006-01-02 15:04"
+
+// costTitle is the heading of the cost column, with the currency if known.
+func (e *Energy) costTitle() string {
+	if e.Currency == "" {
+		return "Cost"
+	}
+	return "Cost (" + e.Currency + ")"
+}
+
+func (e *Energy) groupTitle() string {
+	return strings.ToUpper(e.GroupBy[:1]) + e.GroupBy[1:]
+}
+
+// WriteMarkdown writes the report as a Markdown document: the period and
+// price, a table per group unless grouped by port, and a table per port.
+func WriteMarkdown(w io.Writer, e *Energy) error {
+	var b strings.Builder
+	b.WriteString("# PoE energy report\n\n")
+	fmt.Fprintf(&b, "- Period: %s to %s\n", e.From.Format(periodLayout), e.To.Format(periodLayout))
+	if e.Costed() {
+		fmt.Fprintf(&b, "- Price: %s %s per kWh\n", strconv.FormatFloat(e.PricePerKWh, 'f', -1, 64), e.Currency)
+		fmt.Fprintf(&b, "- Total: %.3f kWh, %.2f %s\n", e.Total.Energy, e.Total.Cost, e.Currency)
+	} else {
+		fmt.Fprintf(&b, "- Total: %.3f kWh\n", e.Total.Energy)
+	}
+
+	if e.GroupBy != ByPort {
+		fmt.Fprintf(&b, "\n## By %s\n\n", e.GroupBy)
+		header := []string{e.groupTitle(), "Ports", "kWh"}
+		right := []bool{false, true, true}
+		if e.Costed() {
+			header = append(header, e.costTitle())
+			right = append(right, true)
+		}
+		row := func(name string, g Group) []string {
+			r := []string{name, strconv.Itoa(g.Ports), fmt.Sprintf("%.3f", g.Energy)}
+			if e.Costed() {
+				r = append(r, fmt.Sprintf("%.2f", g.Cost))
+			}
+			return r
+		}
+		var rows [][]string
+		for _, g := range e.Groups {
+			rows = append(rows, row(markdownEscape(g.Name), g))
+		}
+		rows = append(rows, row("**Total**", e.Total))
+		writeMarkdownTable(&b, header, right, rows)
+	}
+
+	b.WriteString("\n## By port\n\n")
+	header := []string{"Team", "Switch", "Port", "Label", "Avg W", "Max W", "kWh"}
+	right := []bool{false, false, true, false, true, true, true}
+	if e.Costed() {
+		header = append(header, e.costTitle())
+		right = append(right, true)
+	}
+	var rows [][]string
+	for _, p := range e.Ports {
+		row := []string{markdownEscape(p.Team), markdownEscape(p.Switch), strconv.Itoa(p.Port), markdownEscape(p.Label),
+			fmt.Sprintf("%.2f", p.Avg), fmt.Sprintf("%.2f", p.Max), fmt.Sprintf("%.3f", p.Energy)}
+		if e.Costed() {
+			row = append(row, fmt.Sprintf("%.2f", p.Cost))
+		}
+		rows = append(rows, row)
+	}
+	writeMarkdownTable(&b, header, right, rows)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeMarkdownTable(b *strings.Builder, header []string, right []bool, rows [][]string) {
+	b.WriteString("| " + strings.Join(header, " | ") + " |\n|")
+	for _, r := range right {
+		if r {
+			b.WriteString(" ---: |")
+		} else {
+			b.WriteString(" --- |")
+		}
+	}
+	b.WriteString("\n")
+	for _, row := range rows {
+		b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+	}
+}
+
+// markdownEscape keeps labels from breaking table cells.
+func markdownEscape(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+// WriteCSV writes one row per group, or per port when grouped by port, for
+// import into a spreadsheet. Costs are included when the report has a
+// price.
+func WriteCSV(w io.Writer, e *Energy) error {
+	cw := csv.NewWriter(w)
+	from, to := e.From.Format(periodLayout), e.To.Format(periodLayout)
+	energy := func(kwh float64) string { return strconv.FormatFloat(kwh, 'f', 4, 64) }
+	cost := func(c float64) string { return strconv.FormatFloat(c, 'f', 2, 64) }
+
+	if e.GroupBy == ByPort {
+		header := []string{"from", "to", "team", "switch", "port", "label", "samples", "avg_w", "max_w", "energy_kwh"}
+		if e.Costed() {
+			header = append(header, "cost", "currency")
+		}
+		cw.Write(header)
+		for _, p := range e.Ports {
+			row := []string{from, to, p.Team, p.Switch, strconv.Itoa(p.Port), p.Label, strconv.Itoa(p.Samples),
+				strconv.FormatFloat(p.Avg, 'f', 2, 64), strconv.FormatFloat(p.Max, 'f', 2, 64), energy(p.Energy)}
+			if e.Costed() {
+				row = append(row, cost(p.Cost), e.Currency)
+			}
+			cw.Write(row)
+		}
+	} else {
+		header := []string{"from", "to", e.GroupBy, "ports", "energy_kwh"}
+		if e.Costed() {
+			header = append(header, "cost", "currency")
+		}
+		cw.Write(header)
+		for _, g := range e.Groups {
+			row := []string{from, to, g.Name, strconv.Itoa(g.Ports), energy(g.Energy)}
+			if e.Costed() {
+				row = append(row, cost(g.Cost), e.Currency)
+			}
+			cw.Write(row)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
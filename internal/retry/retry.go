@@ -0,0 +1,153 @@
+// Package retry implements the shared retry policy for switch operations:
+// a bounded number of attempts with exponential backoff, jitter and an
+// overall time limit.
+package retry
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"netgearcli/internal/config"
+)
+
+// Policy controls how an operation is retried. The zero value makes a
+// single attempt.
+type Policy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	MaxAttempts int
+	// InitialDelay is the wait before the first retry.
+	InitialDelay time.Duration
+	// MaxDelay caps the wait between attempts. Zero means no cap.
+	MaxDelay time.Duration
+	// Multiplier grows the delay after each retry. Values below 1 mean 1.
+	Multiplier float64
+	// Jitter randomises each delay by up to this fraction (0.2 = ±20%),
+	// so concurrent clients do not retry in lockstep.
+	Jitter float64
+	// MaxElapsed stops retrying once this much time has passed since the
+	// first attempt. Zero means no limit.
+	MaxElapsed time.Duration
+}
+
+// Default is the policy used when nothing is configured. Its first delays
+// (200ms, 500ms, ~1.2s) match the tool's original fixed login retries.
+var Default = Policy{
+	MaxAttempts:  4,
+	InitialDelay: 200 * time.Millisecond,
+	MaxDelay:     5 * time.Second,
+	Multiplier:   2.5,
+	Jitter:       0.2,
+	MaxElapsed:   30 * time.Second,
+}
+
+// Notify is called before each retry with the attempt that failed, its
+// error and the delay about to be waited.
+type Notify func(attempt int, err error, delay time.Duration)
+
+// Do runs fn until it succeeds, retryable reports its error as permanent,
+// the policy is exhausted or ctx is done. A nil retryable retries every
+// error. When more than one attempt was made the final error says how many.
+func (p Policy) Do(ctx context.Context, retryable func(error) bool, notify Notify, fn func() error) error {
+	start := time.Now()
+	attempts := p.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	delay := p.InitialDelay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || (retryable != nil && !retryable(err)) {
+			return err
+		}
+		if attempt >= attempts {
+			return giveUp(attempt, err)
+		}
+
+		wait := p.jitter(delay)
+		if p.MaxElapsed > 0 && time.Since(start)+wait > p.MaxElapsed {
+			return giveUp(attempt, err)
+		}
+		if notify != nil {
+			notify(attempt, err, wait)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w (after attempt %d failed: %v)", ctx.Err(), attempt, err)
+		}
+		delay = p.next(delay)
+	}
+}
+
+// Delay returns the jittered wait after the given failed attempt, for loops
+// such as reconnects that retry forever rather than through Do.
+func (p Policy) Delay(attempt int) time.Duration {
+	delay := p.InitialDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay = p.next(delay)
+	}
+	return p.jitter(delay)
+}
+
+func giveUp(attempts int, err error) error {
+	if attempts == 1 {
+		return err
+	}
+	return fmt.Errorf("giving up after %d attempts: %w", attempts, err)
+}
+
+func (p Policy) next(delay time.Duration) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	delay = time.Duration(float64(delay) * multiplier)
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+func (p Policy) jitter(delay time.Duration) time.Duration {
+	if p.Jitter <= 0 || delay <= 0 {
+		return delay
+	}
+	// Scale by a random factor in [1-Jitter, 1+Jitter).
+	factor := 1 + p.Jitter*(2*rand.Float64()-1)
+	return time.Duration(float64(delay) * factor)
+}
+
+// WithConfig returns p with the fields set in c applied on top.
+func (p Policy) WithConfig(c *config.Retry) Policy {
+	if c == nil {
+		return p
+	}
+	if c.MaxAttempts != nil {
+		p.MaxAttempts = *c.MaxAttempts
+	}
+	if c.InitialDelay != nil {
+		p.InitialDelay = time.Duration(*c.InitialDelay)
+	}
+	if c.MaxDelay != nil {
+		p.MaxDelay = time.Duration(*c.MaxDelay)
+	}
+	if c.Multiplier != nil {
+		p.Multiplier = *c.Multiplier
+	}
+	if c.Jitter != nil {
+		p.Jitter = *c.Jitter
+	}
+	if c.MaxElapsed != nil {
+		p.MaxElapsed = time.Duration(*c.MaxElapsed)
+	}
+	return p
+}
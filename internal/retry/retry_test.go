@@ -0,0 +1,230 @@
+package retry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"netgearcli/internal/config"
+	"netgearcli/internal/errs"
+)
+
+func TestDelaySchedule(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		want   []time.Duration
+	}{
+		{
+			name:   "default without jitter",
+			policy: Policy{InitialDelay: 200 * time.Millisecond, MaxDelay: 5 * time.Second, Multiplier: 2.5},
+			want: []time.Duration{200 * time.Millisecond, 500 * time.Millisecond, 1250 * time.Millisecond,
+				3125 * time.Millisecond, 5 * time.Second, 5 * time.Second},
+		},
+		{
+			name:   "no cap",
+			policy: Policy{InitialDelay: time.Second, Multiplier: 3},
+			want:   []time.Duration{time.Second, 3 * time.Second, 9 * time.Second, 27 * time.Second},
+		},
+		{
+			name:   "constant",
+			policy: Policy{InitialDelay: time.Second, Multiplier: 1},
+			want:   []time.Duration{time.Second, time.Second, time.Second},
+		},
+		{
+			// Below 1 would shrink the delay; it is treated as 1
+			name:   "multiplier below 1",
+			policy: Policy{InitialDelay: time.Second, Multiplier: 0.5},
+			want:   []time.Duration{time.Second, time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, want := range tt.want {
+				if got := tt.policy.Delay(i + 1); got != want {
+					t.Errorf("Delay(%d) = %s, want %s", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestJitterBounds(t *testing.T) {
+	for _, jitter := range []float64{0.1, 0.2, 0.5} {
+		t.Run(fmt.Sprint(jitter), func(t *testing.T) {
+			p := Policy{InitialDelay: time.Second, Multiplier: 2, Jitter: jitter}
+			base := 2 * time.Second
+			low := time.Duration(float64(base) * (1 - jitter))
+			high := time.Duration(float64(base) * (1 + jitter))
+			varied := false
+			for i := 0; i < 1000; i++ {
+				got := p.Delay(2)
+				if got < low || got >= high {
+					t.Fatalf("Delay(2) = %s, want within [%s, %s)", got, low, high)
+				}
+				varied = varied || got != base
+			}
+			if !varied {
+				t.Error("jitter never changed the delay")
+			}
+		})
+	}
+}
+
+// attempts runs p.Do with fn failing with err every time and returns how
+// many attempts were made and the final error.
+func attempts(p Policy, retryable func(error) bool, err error) (int, error) {
+	n := 0
+	final := p.Do(context.Background(), retryable, nil, func() error {
+		n++
+		return err
+	})
+	return n, final
+}
+
+func TestDo(t *testing.T) {
+	failure := errors.New("no answer")
+	fast := Policy{MaxAttempts: 4, InitialDelay: time.Millisecond, Multiplier: 1}
+
+	tests := []struct {
+		name         string
+		policy       Policy
+		wantAttempts int
+		wantText     string
+	}{
+		{name: "exhausted", policy: fast, wantAttempts: 4, wantText: "giving up after 4 attempts: no answer"},
+		{name: "zero value", policy: Policy{}, wantAttempts: 1, wantText: "no answer"},
+		{
+			// The first wait alone would pass MaxElapsed
+			name:         "max elapsed before first retry",
+			policy:       Policy{MaxAttempts: 10, InitialDelay: time.Second, MaxElapsed: 100 * time.Millisecond},
+			wantAttempts: 1,
+			wantText:     "no answer",
+		},
+		{
+			// Retries at 40ms and 80ms; a third at 120ms would pass 100ms
+			name:         "max elapsed after retries",
+			policy:       Policy{MaxAttempts: 10, InitialDelay: 40 * time.Millisecond, Multiplier: 1, MaxElapsed: 100 * time.Millisecond},
+			wantAttempts: 3,
+			wantText:     "giving up after 3 attempts",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := attempts(tt.policy, nil, failure)
+			if n != tt.wantAttempts {
+				t.Errorf("made %d attempts, want %d", n, tt.wantAttempts)
+			}
+			if !errors.Is(err, failure) || !strings.Contains(err.Error(), tt.wantText) {
+				t.Errorf("error = %v, want %q wrapping the failure", err, tt.wantText)
+			}
+		})
+	}
+
+	t.Run("succeeds after retries", func(t *testing.T) {
+		n := 0
+		var notified []int
+		err := fast.Do(context.Background(), nil, func(attempt int, err error, delay time.Duration) {
+			notified = append(notified, attempt)
+		}, func() error {
+			if n++; n < 3 {
+				return failure
+			}
+			return nil
+		})
+		if err != nil || n != 3 {
+			t.Errorf("Do = %v after %d attempts", err, n)
+		}
+		if fmt.Sprint(notified) != "[1 2]" {
+			t.Errorf("notified for attempts %v", notified)
+		}
+	})
+
+	t.Run("canceled while waiting", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		p := Policy{MaxAttempts: 4, InitialDelay: 10 * time.Second}
+		start := time.Now()
+		err := p.Do(ctx, nil, nil, func() error { return failure })
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("error = %v, want context.Canceled", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("Do waited %s after cancel", elapsed)
+		}
+	})
+}
+
+func TestDoRetryableClassification(t *testing.T) {
+	p := Policy{MaxAttempts: 3, InitialDelay: time.Millisecond}
+	tests := []struct {
+		name  string
+		err   error
+		retry bool
+	}{
+		{"connection refused", fmt.Errorf("login: %w", syscall.ECONNREFUSED), true},
+		{"host unreachable", syscall.EHOSTUNREACH, true},
+		{"timeout", fmt.Errorf("status: %w", context.DeadlineExceeded), true},
+		{"switch busy", errs.ErrSwitchBusy, true},
+		{"bad password", fmt.Errorf("login: %w", errs.ErrBadPassword), false},
+		{"canceled", context.Canceled, false},
+		{"unsupported model", errs.ErrUnsupportedModel, false},
+		{"unclassified", errors.New("unexpected response"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errs.Retryable(tt.err); got != tt.retry {
+				t.Errorf("Retryable = %v, want %v", got, tt.retry)
+			}
+			want := 1
+			if tt.retry {
+				want = p.MaxAttempts
+			}
+			n, err := attempts(p, errs.Retryable, tt.err)
+			if n != want {
+				t.Errorf("made %d attempts, want %d", n, want)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("error = %v, want it to wrap %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestWithConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want Policy
+	}{
+		{name: "nil", json: "null", want: Default},
+		{name: "empty", json: "{}", want: Default},
+		{
+			name: "all fields",
+			json: `{"max_attempts": 6, "initial_delay": "1s", "max_delay": "10s", "multiplier": 3, "jitter": 0.1, "max_elapsed": "1m"}`,
+			want: Policy{MaxAttempts: 6, InitialDelay: time.Second, MaxDelay: 10 * time.Second, Multiplier: 3, Jitter: 0.1, MaxElapsed: time.Minute},
+		},
+		{
+			// Zero is a setting, not the absence of one
+			name: "zeros",
+			json: `{"jitter": 0, "multiplier": 1, "max_delay": "0s", "max_elapsed": "0s"}`,
+			want: Policy{MaxAttempts: Default.MaxAttempts, InitialDelay: Default.InitialDelay, Multiplier: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c *config.Retry
+			if err := json.Unmarshal([]byte(tt.json), &c); err != nil {
+				t.Fatal(err)
+			}
+			if got := Default.WithConfig(c); got != tt.want {
+				t.Errorf("WithConfig = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
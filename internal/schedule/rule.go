@@ -0,0 +1,334 @@
+// Package schedule runs timed PoE actions, such as turning classroom access
+// points off at night, from rules in the configuration file.
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"netgearcli/internal/config"
+	"netgearcli/internal/poe"
+)
+
+// Rule is a set of timed actions on some ports of one switch.
+type Rule struct {
+	Name     string
+	Switch   string
+	Ports    []int
+	Location *time.Location
+	Actions  []Action
+}
+
+// Action is one timed action of a rule.
+type Action struct {
+	// Action is "enable", "disable" or "cycle".
+	Action string
+	Hour   int
+	Minute int
+	// Days has an entry per weekday, indexed by time.Weekday.
+	Days [7]bool
+}
+
+// String renders the action in rule syntax, e.g. "disable at 22:00 Mon-Fri".
+func (a Action) String() string {
+	return fmt.Sprintf("%s at %02d:%02d %s", a.Action, a.Hour, a.Minute, formatDays(a.Days))
+}
+
+// Run is one scheduled occurrence of an action.
+type Run struct {
+	Rule   *Rule
+	Action Action
+	At     time.Time
+}
+
+// Rules parses the rules in cfg. Rules without a timezone use cfg's, or
+// the local one.
+func Rules(cfg *config.Schedule) ([]*Rule, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	loc := time.Local
+	if cfg.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(cfg.Timezone); err != nil {
+			return nil, fmt.Errorf("schedule: %w", err)
+		}
+	}
+
+	var rules []*Rule
+	names := make(map[string]bool)
+	for i, rc := range cfg.Rules {
+		if rc.Text != "" {
+			parsed, err := ParseRule(rc.Text)
+			if err != nil {
+				return nil, fmt.Errorf("schedule rule %d: %w", i+1, err)
+			}
+			rc = parsed
+		}
+		rule, err := newRule(rc, loc)
+		if err != nil {
+			return nil, fmt.Errorf("schedule rule %d: %w", i+1, err)
+		}
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("%s-ports-%s", rule.Switch, rc.Ports)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("schedule rule %d: duplicate name %q", i+1, rule.Name)
+		}
+		names[rule.Name] = true
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func newRule(rc config.ScheduleRule, loc *time.Location) (*Rule, error) {
+	if rc.Switch == "" {
+		return nil, fmt.Errorf("no switch")
+	}
+	ports, err := poe.ParsePorts(strings.Fields(rc.Ports))
+	if err != nil {
+		return nil, err
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no ports")
+	}
+	if len(rc.Actions) == 0 {
+		return nil, fmt.Errorf("no actions")
+	}
+	if rc.Timezone != "" {
+		if loc, err = time.LoadLocation(rc.Timezone); err != nil {
+			return nil, err
+		}
+	}
+
+	rule := &Rule{Name: rc.Name, Switch: rc.Switch, Ports: ports, Location: loc}
+	for _, ac := range rc.Actions {
+		action, err := newAction(ac)
+		if err != nil {
+			return nil, err
+		}
+		rule.Actions = append(rule.Actions, action)
+	}
+	return rule, nil
+}
+
+func newAction(ac config.ScheduleAction) (Action, error) {
+	a := Action{Action: strings.ToLower(ac.Action)}
+	if !isAction(a.Action) {
+		return a, fmt.Errorf("unknown action %q (want enable, disable or cycle)", ac.Action)
+	}
+	t, err := time.Parse("15:04", ac.At)
+	if err != nil {
+		return a, fmt.Errorf("invalid time %q: want HH:MM", ac.At)
+	}
+	a.Hour, a.Minute = t.Hour(), t.Minute()
+	if a.Days, err = parseDays(ac.Days); err != nil {
+		return a, err
+	}
+	return a, nil
+}
+
+func isAction(word string) bool {
+	switch strings.ToLower(word) {
+	case "enable", "disable", "cycle":
+		return true
+	}
+	return false
+}
+
+// ParseRule parses a one-line rule:
+//
+//	<switch> ports <ports> <action> at <HH:MM> [days][, <action> at <HH:MM> [days]]...
+//
+// for example "tswitch1 ports 1-8 disable at 22:00 Mon-Fri, enable at 06:30".
+// An action without days uses those of the action before it.
+func ParseRule(text string) (config.ScheduleRule, error) {
+	var rc config.ScheduleRule
+	fields := strings.Fields(text)
+	if len(fields) < 3 || !strings.EqualFold(fields[1], "ports") {
+		return rc, fmt.Errorf("%q: want \"<switch> ports <ports> <action> at <HH:MM> [days]\"", text)
+	}
+	rc.Switch = fields[0]
+
+	i := 2
+	var ports []string
+	for ; i < len(fields) && !isAction(fields[i]); i++ {
+		ports = append(ports, strings.TrimRight(fields[i], ","))
+	}
+	rc.Ports = strings.Join(ports, ",")
+
+	days := ""
+	for i < len(fields) {
+		action := config.ScheduleAction{Action: fields[i]}
+		if i+2 >= len(fields) || !strings.EqualFold(fields[i+1], "at") {
+			return rc, fmt.Errorf("%q: want \"%s at <HH:MM>\"", text, fields[i])
+		}
+		action.At = strings.TrimRight(fields[i+2], ",")
+		i += 3
+
+		var dayWords []string
+		for ; i < len(fields) && !isAction(fields[i]); i++ {
+			if word := strings.Trim(fields[i], ","); word != "" && !strings.EqualFold(word, "on") {
+				dayWords = append(dayWords, word)
+			}
+		}
+		if len(dayWords) > 0 {
+			days = strings.Join(dayWords, ",")
+		}
+		action.Days = days
+		rc.Actions = append(rc.Actions, action)
+	}
+	if len(rc.Actions) == 0 {
+		return rc, fmt.Errorf("%q: no actions", text)
+	}
+	return rc, nil
+}
+
+var dayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// parseDays parses "Mon-Fri", "Sat,Sun", "Fri-Mon", "weekdays", "weekends"
+// or "daily". An empty string means every day.
+func parseDays(s string) ([7]bool, error) {
+	var days [7]bool
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		s = "daily"
+	}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		switch part {
+		case "daily", "everyday", "every day", "all":
+			return [7]bool{true, true, true, true, true, true, true}, nil
+		case "weekdays":
+			part = "mon-fri"
+		case "weekends", "weekend":
+			part = "sat-sun"
+		}
+
+		from, to, isRange := strings.Cut(part, "-")
+		start, err := parseDay(from)
+		if err != nil {
+			return days, err
+		}
+		end := start
+		if isRange {
+			if end, err = parseDay(to); err != nil {
+				return days, err
+			}
+		}
+		// Ranges may wrap around the weekend, e.g. Fri-Mon
+		for d := start; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == end {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func parseDay(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if len(s) >= 3 {
+		for i, name := range dayNames {
+			if strings.HasPrefix(s, name) {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unknown day %q", s)
+}
+
+func formatDays(days [7]bool) string {
+	count := 0
+	for _, on := range days {
+		if on {
+			count++
+		}
+	}
+	switch {
+	case count == 7:
+		return "daily"
+	case days == [7]bool{false, true, true, true, true, true, false}:
+		return "Mon-Fri"
+	case days == [7]bool{true, false, false, false, false, false, true}:
+		return "Sat,Sun"
+	}
+	var names []string
+	for i, on := range days {
+		if on {
+			names = append(names, strings.ToUpper(dayNames[i][:1])+dayNames[i][1:])
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// Next returns the first occurrence of a strictly after t.
+func (a Action) Next(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	for offset := 0; offset <= 7; offset++ {
+		day := t.AddDate(0, 0, offset)
+		at := time.Date(day.Year(), day.Month(), day.Day(), a.Hour, a.Minute, 0, 0, loc)
+		if a.Days[at.Weekday()] && at.After(t) {
+			return at
+		}
+	}
+	return time.Time{}
+}
+
+// Prev returns the last occurrence of a at or before t.
+func (a Action) Prev(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	for offset := 0; offset <= 7; offset++ {
+		day := t.AddDate(0, 0, -offset)
+		at := time.Date(day.Year(), day.Month(), day.Day(), a.Hour, a.Minute, 0, 0, loc)
+		if a.Days[at.Weekday()] && !at.After(t) {
+			return at
+		}
+	}
+	return time.Time{}
+}
+
+// Latest returns the rule's most recent scheduled run at or before t. Only
+// the latest matters after downtime: running a missed "disable" followed by
+// a missed "enable" would just flap the ports.
+func (r *Rule) Latest(t time.Time) (Run, bool) {
+	var latest Run
+	for _, a := range r.Actions {
+		if at := a.Prev(t, r.Location); !at.IsZero() && at.After(latest.At) {
+			latest = Run{Rule: r, Action: a, At: at}
+		}
+	}
+	return latest, !latest.At.IsZero()
+}
+
+// Next returns the rule's first scheduled run after t.
+func (r *Rule) Next(t time.Time) (Run, bool) {
+	var next Run
+	for _, a := range r.Actions {
+		if at := a.Next(t, r.Location); !at.IsZero() && (next.At.IsZero() || at.Before(next.At)) {
+			next = Run{Rule: r, Action: a, At: at}
+		}
+	}
+	return next, !next.At.IsZero()
+}
+
+// PortList renders the rule's ports compactly, e.g. "1-8,12".
+func (r *Rule) PortList() string {
+	var parts []string
+	for i := 0; i < len(r.Ports); {
+		j := i
+		for j+1 < len(r.Ports) && r.Ports[j+1] == r.Ports[j]+1 {
+			j++
+		}
+		if j > i {
+			parts = append(parts, strconv.Itoa(r.Ports[i])+"-"+strconv.Itoa(r.Ports[j]))
+		} else {
+			parts = append(parts, strconv.Itoa(r.Ports[i]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
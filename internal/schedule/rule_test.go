@@ -0,0 +1,268 @@
+package schedule
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"netgearcli/internal/config"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    config.ScheduleRule
+		errText string
+	}{
+		{
+			text: "tswitch1 ports 1-8 disable at 22:00 Mon-Fri, enable at 06:30",
+			want: config.ScheduleRule{Switch: "tswitch1", Ports: "1-8", Actions: []config.ScheduleAction{
+				{Action: "disable", At: "22:00", Days: "Mon-Fri"},
+				// Days carry over to an action without its own
+				{Action: "enable", At: "06:30", Days: "Mon-Fri"},
+			}},
+		},
+		{
+			text: "lab ports 1, 3-4 cycle at 03:00 on Sat Sun",
+			want: config.ScheduleRule{Switch: "lab", Ports: "1,3-4", Actions: []config.ScheduleAction{
+				{Action: "cycle", At: "03:00", Days: "Sat,Sun"},
+			}},
+		},
+		{
+			text: "lab ports 2 enable at 07:00",
+			want: config.ScheduleRule{Switch: "lab", Ports: "2", Actions: []config.ScheduleAction{
+				{Action: "enable", At: "07:00"},
+			}},
+		},
+		{text: "lab 1-8 disable at 22:00", errText: "want"},
+		{text: "lab ports 1-8", errText: "no actions"},
+		{text: "lab ports 1-8 disable 22:00", errText: `want "disable at <HH:MM>"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := ParseRule(tt.text)
+			if tt.errText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errText) {
+					t.Fatalf("error = %v, want %q", err, tt.errText)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRule = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDays(t *testing.T) {
+	tests := []struct {
+		days    string
+		want    string
+		wantErr bool
+	}{
+		{days: "", want: "daily"},
+		{days: "daily", want: "daily"},
+		{days: "Mon-Fri", want: "Mon-Fri"},
+		{days: "weekdays", want: "Mon-Fri"},
+		{days: "weekends", want: "Sat,Sun"},
+		{days: "Sat,Sun", want: "Sat,Sun"},
+		{days: "Fri-Mon", want: "Sun,Mon,Fri,Sat"},
+		{days: "tuesday,Thu", want: "Tue,Thu"},
+		{days: "Wed-Wed", want: "Wed"},
+		{days: "Mon-Funday", wantErr: true},
+		{days: "Mo", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.days, func(t *testing.T) {
+			days, err := parseDays(tt.days)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseDays = %s, want an error", formatDays(days))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := formatDays(days); got != tt.want {
+				t.Errorf("parseDays = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRules(t *testing.T) {
+	cfg := &config.Schedule{
+		Timezone: "Europe/Berlin",
+		Rules: []config.ScheduleRule{
+			{Text: "tswitch1 ports 1-8 disable at 22:00 Mon-Fri, enable at 06:30"},
+			{Name: "lab-night", Switch: "lab", Ports: "3", Timezone: "America/New_York",
+				Actions: []config.ScheduleAction{{Action: "Cycle", At: "3:05", Days: "weekends"}}},
+		},
+	}
+	rules, err := Rules(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("Rules = %d rules", len(rules))
+	}
+	first := rules[0]
+	if first.Name != "tswitch1-ports-1-8" || first.Location.String() != "Europe/Berlin" || first.PortList() != "1-8" {
+		t.Errorf("first rule = %s in %s on ports %s", first.Name, first.Location, first.PortList())
+	}
+	if got := first.Actions[1].String(); got != "enable at 06:30 Mon-Fri" {
+		t.Errorf("action = %q", got)
+	}
+	second := rules[1]
+	if second.Location.String() != "America/New_York" || second.Actions[0].String() != "cycle at 03:05 Sat,Sun" {
+		t.Errorf("second rule = %s in %s: %s", second.Name, second.Location, second.Actions[0])
+	}
+
+	bad := []struct {
+		name    string
+		rule    config.ScheduleRule
+		errText string
+	}{
+		{"no switch", config.ScheduleRule{Ports: "1", Actions: []config.ScheduleAction{{Action: "enable", At: "06:00"}}}, "no switch"},
+		{"no actions", config.ScheduleRule{Switch: "sw", Ports: "1"}, "no actions"},
+		{"bad action", config.ScheduleRule{Switch: "sw", Ports: "1", Actions: []config.ScheduleAction{{Action: "reboot", At: "06:00"}}}, "unknown action"},
+		{"bad time", config.ScheduleRule{Switch: "sw", Ports: "1", Actions: []config.ScheduleAction{{Action: "enable", At: "25:00"}}}, "invalid time"},
+		{"bad timezone", config.ScheduleRule{Switch: "sw", Ports: "1", Timezone: "Mars/Olympus", Actions: []config.ScheduleAction{{Action: "enable", At: "06:00"}}}, "Mars/Olympus"},
+	}
+	for _, tt := range bad {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Rules(&config.Schedule{Rules: []config.ScheduleRule{tt.rule}})
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("error = %v, want %q", err, tt.errText)
+			}
+		})
+	}
+
+	dup := &config.Schedule{Rules: []config.ScheduleRule{
+		{Text: "sw ports 1 enable at 06:00"}, {Text: "sw ports 1 disable at 22:00"},
+	}}
+	if _, err := Rules(dup); err == nil || !strings.Contains(err.Error(), "duplicate name") {
+		t.Errorf("error = %v, want a duplicate name", err)
+	}
+}
+
+func TestNextPrev(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(s string) time.Time {
+		t.Helper()
+		tm, err := time.ParseInLocation("2006-01-02 15:04", s, berlin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	daily := Action{Action: "disable", Hour: 22, Days: [7]bool{true, true, true, true, true, true, true}}
+	weekdays, _ := parseDays("Mon-Fri")
+	early := Action{Action: "enable", Hour: 2, Minute: 30, Days: [7]bool{true, true, true, true, true, true, true}}
+
+	tests := []struct {
+		name     string
+		action   Action
+		from     time.Time
+		wantNext time.Time
+		wantPrev time.Time
+	}{
+		{
+			name:     "later today",
+			action:   daily,
+			from:     at("2026-06-10 12:00"),
+			wantNext: at("2026-06-10 22:00"),
+			wantPrev: at("2026-06-09 22:00"),
+		},
+		{
+			// Next is strictly after, Prev at or before
+			name:     "exactly at the time",
+			action:   daily,
+			from:     at("2026-06-10 22:00"),
+			wantNext: at("2026-06-11 22:00"),
+			wantPrev: at("2026-06-10 22:00"),
+		},
+		{
+			name:     "over the weekend",
+			action:   Action{Action: "disable", Hour: 22, Days: weekdays},
+			from:     at("2026-06-12 23:00"), // Friday
+			wantNext: at("2026-06-15 22:00"), // Monday
+			wantPrev: at("2026-06-12 22:00"),
+		},
+		{
+			// 2026-03-29 02:00 CET jumps to 03:00 CEST: the day is 23
+			// hours long and 22:00 stays 22:00 local time
+			name:     "spring forward",
+			action:   daily,
+			from:     at("2026-03-28 23:00"),
+			wantNext: at("2026-03-29 22:00"),
+			wantPrev: at("2026-03-28 22:00"),
+		},
+		{
+			// 2026-10-25 03:00 CEST falls back to 02:00 CET: a 25-hour day
+			name:     "fall back",
+			action:   daily,
+			from:     at("2026-10-24 23:00"),
+			wantNext: at("2026-10-25 22:00"),
+			wantPrev: at("2026-10-24 22:00"),
+		},
+		{
+			// 02:30 does not exist on the night clocks spring forward; the
+			// run happens an hour later by the wall clock, not a day late
+			name:     "time skipped by spring forward",
+			action:   early,
+			from:     at("2026-03-29 01:00"),
+			wantNext: time.Date(2026, 3, 29, 1, 30, 0, 0, time.UTC),
+			wantPrev: at("2026-03-28 02:30"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.action.Next(tt.from, berlin); !got.Equal(tt.wantNext) {
+				t.Errorf("Next = %s, want %s", got, tt.wantNext)
+			}
+			if got := tt.action.Prev(tt.from, berlin); !got.Equal(tt.wantPrev) {
+				t.Errorf("Prev = %s, want %s", got, tt.wantPrev)
+			}
+		})
+	}
+
+	if d := at("2026-03-29 22:00").Sub(at("2026-03-28 22:00")); d != 23*time.Hour {
+		t.Errorf("spring forward day is %s long", d)
+	}
+	none := Action{Action: "enable", Hour: 6}
+	if got := none.Next(at("2026-06-10 12:00"), berlin); !got.IsZero() {
+		t.Errorf("action without days is next at %s", got)
+	}
+}
+
+func TestRuleLatestAndNext(t *testing.T) {
+	rc, err := ParseRule("sw ports 1-8 disable at 22:00 Mon-Fri, enable at 06:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule, err := newRule(rc, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Saturday noon: the last run was Friday's disable, the next Monday's
+	// enable
+	sat := time.Date(2026, 6, 13, 12, 0, 0, 0, time.UTC)
+	latest, ok := rule.Latest(sat)
+	if !ok || latest.Action.Action != "disable" || !latest.At.Equal(time.Date(2026, 6, 12, 22, 0, 0, 0, time.UTC)) {
+		t.Errorf("Latest = %s at %s", latest.Action, latest.At)
+	}
+	next, ok := rule.Next(sat)
+	if !ok || next.Action.Action != "enable" || !next.At.Equal(time.Date(2026, 6, 15, 6, 30, 0, 0, time.UTC)) {
+		t.Errorf("Next = %s at %s", next.Action, next.At)
+	}
+}
@@ -0,0 +1,262 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/hooks"
+	"netgearcli/internal/session"
+)
+
+// retryFailed is how soon a failed run is tried again while it is still
+// the rule's latest run
+const retryFailed = time.Minute
+
+// Scheduler executes rules against a fleet.
+type Scheduler struct {
+	Fleet *fleet.Fleet
+	Rules []*Rule
+	// StateFile records each rule's last successful run. Empty keeps
+	// state in memory only.
+	StateFile string
+	// CatchUp is how old a missed run may be and still execute. Defaults
+	// to 24h.
+	CatchUp time.Duration
+	// SkipMissed discards runs missed before Run started.
+	SkipMissed bool
+	// Timeout bounds one execution. Defaults to 1m.
+	Timeout time.Duration
+	Logf    func(format string, args ...interface{})
+	// OnRun, if set, is called after every execution.
+	OnRun func(run Run, result *session.PortResult, err error)
+
+	lastRun map[string]time.Time
+}
+
+// DefaultStateFile returns where rule state is kept by default.
+func DefaultStateFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "netgear", "schedule-state.json")
+}
+
+// Run executes rules as they fall due until ctx is done. Runs missed while
+// the scheduler was not running are caught up first: for each rule only
+// its most recent run, and only if it is within CatchUp.
+func (s *Scheduler) Run(ctx context.Context) error {
+	if s.CatchUp <= 0 {
+		s.CatchUp = 24 * time.Hour
+	}
+	if s.Timeout <= 0 {
+		s.Timeout = time.Minute
+	}
+	for _, rule := range s.Rules {
+		if _, ok := s.Fleet.Get(rule.Switch); !ok {
+			return fmt.Errorf("schedule rule %s: unknown switch %s", rule.Name, rule.Switch)
+		}
+	}
+	if err := s.Load(); err != nil {
+		return err
+	}
+
+	if s.SkipMissed {
+		s.skipMissed(time.Now())
+	}
+
+	for {
+		failed := s.runDue(ctx, time.Now())
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		wake, next := s.nextWake(time.Now())
+		if failed && (wake.IsZero() || time.Until(wake) > retryFailed) {
+			wake = time.Now().Add(retryFailed)
+		}
+		if wake.IsZero() {
+			<-ctx.Done()
+			return nil
+		}
+		if next.Rule != nil {
+			s.debugNext(next)
+		}
+
+		// Sleep in bounded steps so a suspended machine or a clock change
+		// does not push a run far past its time
+		wait := time.Until(wake)
+		if wait > time.Minute {
+			wait = time.Minute
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// runDue executes the runs that are due and reports whether any failed
+func (s *Scheduler) runDue(ctx context.Context, now time.Time) bool {
+	failed := false
+	for _, run := range s.due(now) {
+		if err := s.execute(ctx, run); err != nil {
+			if ctx.Err() != nil {
+				return false
+			}
+			failed = true
+			continue
+		}
+		s.lastRun[run.Rule.Name] = run.At
+		s.save()
+	}
+	return failed
+}
+
+// due returns each rule's latest run at or before now that has not
+// happened yet. Runs older than CatchUp are marked as done instead.
+func (s *Scheduler) due(now time.Time) []Run {
+	var runs []Run
+	for _, rule := range s.Rules {
+		run, ok := rule.Latest(now)
+		if !ok || !run.At.After(s.lastRun[rule.Name]) {
+			continue
+		}
+		if age := now.Sub(run.At); age > s.CatchUp {
+			s.logf("Schedule %s: missed %s at %s is older than %s; not running it",
+				rule.Name, run.Action.Action, run.At.Format(time.RFC3339), s.CatchUp)
+			s.lastRun[rule.Name] = run.At
+			s.save()
+			continue
+		}
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// skipMissed marks every rule's latest run at or before now as done
+func (s *Scheduler) skipMissed(now time.Time) {
+	for _, rule := range s.Rules {
+		if run, ok := rule.Latest(now); ok && run.At.After(s.lastRun[rule.Name]) {
+			s.logf("Schedule %s: skipping missed %s (%s)", rule.Name, run.Action, run.At.Format(time.RFC3339))
+			s.lastRun[rule.Name] = run.At
+		}
+	}
+	s.save()
+}
+
+func (s *Scheduler) execute(ctx context.Context, run Run) error {
+	m, _ := s.Fleet.Get(run.Rule.Switch)
+	late := time.Since(run.At).Round(time.Second)
+	if late > time.Minute {
+		s.logf("Schedule %s: %s %s ports %v (catching up run due %s)",
+			run.Rule.Name, run.Action.Action, run.Rule.Switch, run.Rule.Ports, run.At.Format(time.RFC3339))
+	} else {
+		s.logf("Schedule %s: %s %s ports %v", run.Rule.Name, run.Action.Action, run.Rule.Switch, run.Rule.Ports)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+	actor := hooks.CurrentActor("schedule")
+	actor.Reason = fmt.Sprintf("rule %s: %s", run.Rule.Name, run.Action)
+	result, err := m.Change(ctx, run.Action.Action, run.Rule.Ports, actor)
+	if err != nil {
+		s.logf("Schedule %s: %s failed: %v", run.Rule.Name, run.Action.Action, err)
+	} else {
+		s.logf("Schedule %s: %s done", run.Rule.Name, run.Action.Action)
+	}
+	if s.OnRun != nil {
+		s.OnRun(run, result, err)
+	}
+	return err
+}
+
+// nextWake returns the time of the next scheduled run of any rule
+func (s *Scheduler) nextWake(now time.Time) (time.Time, Run) {
+	var next Run
+	for _, rule := range s.Rules {
+		if run, ok := rule.Next(now); ok && (next.At.IsZero() || run.At.Before(next.At)) {
+			next = run
+		}
+	}
+	return next.At, next
+}
+
+// Upcoming returns each rule's next run after t, for listing.
+func (s *Scheduler) Upcoming(t time.Time) []Run {
+	var runs []Run
+	for _, rule := range s.Rules {
+		if run, ok := rule.Next(t); ok {
+			runs = append(runs, run)
+		}
+	}
+	return runs
+}
+
+// LastRun returns when the named rule last ran successfully.
+func (s *Scheduler) LastRun(name string) time.Time {
+	return s.lastRun[name]
+}
+
+func (s *Scheduler) debugNext(next Run) {
+	if s.Fleet.Options.Debug {
+		s.logf("Schedule: next is %s %s at %s", next.Rule.Name, next.Action.Action, next.At.Format(time.RFC3339))
+	}
+}
+
+// Load reads the state file. Run calls it; listings call it to show when
+// rules last ran.
+func (s *Scheduler) Load() error {
+	s.lastRun = make(map[string]time.Time)
+	if s.StateFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.StateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read schedule state: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.lastRun); err != nil {
+		return fmt.Errorf("failed to parse schedule state %s: %w", s.StateFile, err)
+	}
+	return nil
+}
+
+// save writes the state file atomically. Failures are logged, not fatal:
+// the worst case is a run being repeated after a restart.
+func (s *Scheduler) save() {
+	if s.StateFile == "" {
+		return
+	}
+	data, err := json.MarshalIndent(s.lastRun, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(s.StateFile), 0700)
+	}
+	if err == nil {
+		tmp := s.StateFile + ".tmp"
+		if err = os.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, s.StateFile)
+		}
+	}
+	if err != nil {
+		s.logf("Failed to save schedule state: %v", err)
+	}
+}
+
+func (s *Scheduler) logf(format string, args ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
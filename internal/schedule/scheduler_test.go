@@ -0,0 +1,121 @@
+package schedule
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testRules are a nightly disable and an early morning cycle on every day,
+// in UTC.
+func testRules(t *testing.T) []*Rule {
+	t.Helper()
+	var rules []*Rule
+	for _, text := range []string{"sw ports 1-8 disable at 22:00", "sw ports 9 cycle at 03:00"} {
+		rc, err := ParseRule(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc.Name = "sw-ports-" + rc.Ports
+		rule, err := newRule(rc, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// restart returns a scheduler that loaded its state from file, as Run does
+// when the process starts again.
+func restart(t *testing.T, file string) *Scheduler {
+	t.Helper()
+	s := &Scheduler{Rules: testRules(t), StateFile: file, CatchUp: 6 * time.Hour}
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestCatchUpAfterRestart(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "state", "schedule-state.json")
+
+	// Both rules last ran on June 9; the process is down until 05:00 on
+	// June 11, missing two disables and two cycles
+	s := restart(t, file)
+	s.lastRun["sw-ports-1-8"] = time.Date(2026, 6, 9, 22, 0, 0, 0, time.UTC)
+	s.lastRun["sw-ports-9"] = time.Date(2026, 6, 9, 3, 0, 0, 0, time.UTC)
+	s.save()
+
+	now := time.Date(2026, 6, 11, 5, 0, 0, 0, time.UTC)
+	s = restart(t, file)
+	due := s.due(now)
+
+	// Only the latest cycle, two hours ago, is run. The disable at 22:00 is
+	// seven hours old, past CatchUp, and is marked done without running.
+	if len(due) != 1 || due[0].Rule.Name != "sw-ports-9" || !due[0].At.Equal(time.Date(2026, 6, 11, 3, 0, 0, 0, time.UTC)) {
+		t.Fatalf("due = %+v, want the cycle at 03:00", due)
+	}
+	skipped := time.Date(2026, 6, 10, 22, 0, 0, 0, time.UTC)
+	if got := s.LastRun("sw-ports-1-8"); !got.Equal(skipped) {
+		t.Errorf("stale run recorded as %s, want %s", got, skipped)
+	}
+
+	// The skipped run stays skipped after another restart, and the cycle
+	// is still due until it succeeds
+	s = restart(t, file)
+	if got := s.LastRun("sw-ports-1-8"); !got.Equal(skipped) {
+		t.Errorf("after restart the stale run is recorded as %s, want %s", got, skipped)
+	}
+	if due := s.due(now); len(due) != 1 || due[0].Rule.Name != "sw-ports-9" {
+		t.Errorf("after restart due = %+v, want the cycle", due)
+	}
+
+	// Once the cycle is recorded nothing is due until the next run
+	s.lastRun["sw-ports-9"] = due[0].At
+	s.save()
+	s = restart(t, file)
+	if due := s.due(now.Add(time.Hour)); len(due) != 0 {
+		t.Errorf("due = %+v after all runs are recorded", due)
+	}
+	if due := s.due(time.Date(2026, 6, 11, 22, 0, 0, 0, time.UTC)); len(due) != 1 || due[0].Rule.Name != "sw-ports-1-8" {
+		t.Errorf("due = %+v at 22:00, want the disable", due)
+	}
+}
+
+func TestFirstStartRunsLatest(t *testing.T) {
+	// Without any state the latest run within CatchUp is due, so a switch
+	// started at 23:00 still has its ports disabled
+	s := restart(t, "")
+	due := s.due(time.Date(2026, 6, 11, 23, 0, 0, 0, time.UTC))
+	if len(due) != 1 || due[0].Rule.Name != "sw-ports-1-8" {
+		t.Errorf("due = %+v, want the disable at 22:00", due)
+	}
+}
+
+func TestSkipMissed(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "schedule-state.json")
+	now := time.Date(2026, 6, 11, 23, 0, 0, 0, time.UTC)
+
+	s := restart(t, file)
+	s.skipMissed(now)
+	if due := s.due(now); len(due) != 0 {
+		t.Errorf("due = %+v after skipping missed runs", due)
+	}
+	s = restart(t, file)
+	if due := s.due(now); len(due) != 0 {
+		t.Errorf("skipped runs are due again after a restart: %+v", due)
+	}
+}
+
+func TestLoadInvalidState(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "schedule-state.json")
+	if err := os.WriteFile(file, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s := &Scheduler{StateFile: file}
+	if err := s.Load(); err == nil {
+		t.Error("corrupt state file accepted")
+	}
+}
@@ -0,0 +1,108 @@
+package session
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"netgearcli/internal/errs"
+)
+
+// run executes fn, a go-netgear call that cannot take a context itself,
+// and returns as soon as ctx is done. The call is left to finish in the
+// background; BindDefaultTransport makes its HTTP requests fail promptly.
+// The session's next call waits for an abandoned one to return, so two
+// calls on one session never overlap.
+func (s *Session) run(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return errs.Classify(err)
+	}
+	busy := s.busy()
+	select {
+	case busy <- struct{}{}:
+	case <-ctx.Done():
+		return errs.Classify(ctx.Err())
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() { <-busy }()
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return errs.Classify(err)
+	case <-ctx.Done():
+		return errs.Classify(ctx.Err())
+	}
+}
+
+// busy returns the channel holding a slot while a library call runs.
+func (s *Session) busy() chan struct{} {
+	s.callsOnce.Do(func() { s.calls = make(chan struct{}, 1) })
+	return s.calls
+}
+
+// BindDefaultTransport cancels every request sent through
+// http.DefaultTransport once ctx is done, and any single request that takes
+// longer than requestTimeout (zero means no limit). The go-netgear library
+// does not accept a context, so this is how an interrupt or timeout reaches
+// the requests it has in flight.
+func BindDefaultTransport(ctx context.Context, requestTimeout time.Duration) {
+	http.DefaultTransport = &contextTransport{base: http.DefaultTransport, ctx: ctx, timeout: requestTimeout}
+}
+
+// httpTimeout bounds each request sent through HTTPClient.
+const httpTimeout = 30 * time.Second
+
+// HTTPClient returns a client for requests to the session's switch that
+// the library does not make, such as reading its login or firmware page.
+// They go through http.DefaultTransport like the library's own, so
+// BindDefaultTransport cancels them too, and each one is bounded like a
+// library call.
+func (s *Session) HTTPClient() *http.Client {
+	return &http.Client{Transport: http.DefaultTransport, Timeout: httpTimeout}
+}
+
+type contextTransport struct {
+	base    http.RoundTripper
+	ctx     context.Context
+	timeout time.Duration
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqCtx context.Context
+	var cancel context.CancelFunc
+	if t.timeout > 0 {
+		reqCtx, cancel = context.WithTimeout(req.Context(), t.timeout)
+	} else {
+		reqCtx, cancel = context.WithCancel(req.Context())
+	}
+	stop := context.AfterFunc(t.ctx, cancel)
+
+	resp, err := t.base.RoundTrip(req.WithContext(reqCtx))
+	if err != nil {
+		stop()
+		cancel()
+		return nil, err
+	}
+	// The request context must outlive RoundTrip until the body is read.
+	resp.Body = &cancelBody{ReadCloser: resp.Body, release: func() {
+		stop()
+		cancel()
+	}}
+	return resp, nil
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
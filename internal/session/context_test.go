@@ -0,0 +1,72 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"netgearcli/internal/errs"
+)
+
+func TestRunReturnsWhenContextDone(t *testing.T) {
+	s := New("sw1", "")
+	release := make(chan struct{})
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := s.run(ctx, func() error {
+		<-release
+		return nil
+	})
+	if !errors.Is(err, errs.ErrTimeout) && !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v, want a timeout", err)
+	}
+}
+
+func TestRunWaitsForAbandonedCall(t *testing.T) {
+	s := New("sw1", "")
+	release := make(chan struct{})
+	var running atomic.Int32
+	var overlapped atomic.Bool
+	call := func() error {
+		if running.Add(1) > 1 {
+			overlapped.Store(true)
+		}
+		defer running.Add(-1)
+		<-release
+		return nil
+	}
+
+	// Abandon a call that is still running
+	abandonCtx, abandon := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		abandon()
+	}()
+	s.run(abandonCtx, call)
+
+	// A cancelled context gives up waiting for the slot
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.run(ctx, call); err == nil {
+		t.Fatal("run with a cancelled context succeeded")
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.run(context.Background(), call) }()
+	select {
+	case <-done:
+		t.Fatal("next call ran while the abandoned one was still running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if overlapped.Load() {
+		t.Error("calls overlapped")
+	}
+}
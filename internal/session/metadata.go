@@ -0,0 +1,104 @@
+package session
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Metadata is what has been learned about a switch, cached next to its
+// token so later runs need not ask the switch again.
+type Metadata struct {
+	Model    string    `json:"model,omitempty"`
+	Firmware string    `json:"firmware,omitempty"`
+	Ports    int       `json:"ports,omitempty"`
+	Updated  time.Time `json:"updated"`
+}
+
+// MetadataPath returns the metadata file for a given address, next to its
+// token.
+func MetadataPath(configDir string, host string) string {
+	return configPath(configDir, "meta-", host)
+}
+
+// ReadMetadata returns the cached metadata for host, if any.
+func ReadMetadata(configDir string, host string) (Metadata, bool) {
+	var m Metadata
+	data, err := os.ReadFile(MetadataPath(configDir, host))
+	if err != nil || json.Unmarshal(data, &m) != nil {
+		return Metadata{}, false
+	}
+	return m, true
+}
+
+// WriteMetadata replaces the cached metadata for host.
+func WriteMetadata(configDir string, host string, m Metadata) error {
+	path := MetadataPath(configDir, host)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	// Write and rename so a concurrent reader never sees half a file. Each
+	// writer has its own temporary file: runs against the same switch may
+	// save at once.
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// CachedModel returns the model recorded with host's token, else the
+// model in its cached metadata, or "" if neither is known.
+func CachedModel(configDir string, host string) string {
+	if model := TokenModel(configDir, host); model != "" {
+		return model
+	}
+	m, _ := ReadMetadata(configDir, host)
+	return m.Model
+}
+
+// Metadata returns the cached metadata for the session's switch.
+func (s *Session) Metadata() (Metadata, bool) {
+	return ReadMetadata(s.Opts.TokenDir, s.Address)
+}
+
+// SaveMetadata caches m for the session's switch.
+func (s *Session) SaveMetadata(m Metadata) error {
+	return WriteMetadata(s.Opts.TokenDir, s.Address, m)
+}
+
+// HasToken reports whether a token is cached for the session's switch.
+func (s *Session) HasToken() bool {
+	_, err := os.Stat(s.TokenPath())
+	return err == nil
+}
+
+// Token returns the cached token without the model in front of it, or ""
+// if there is none.
+func (s *Session) Token() string {
+	data, err := os.ReadFile(s.TokenPath())
+	if err != nil {
+		return ""
+	}
+	token := strings.TrimSpace(string(data))
+	if _, rest, found := strings.Cut(token, ":"); found {
+		return rest
+	}
+	return token
+}
@@ -0,0 +1,52 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriteMetadataConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	var wg sync.WaitGroup
+	errors := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errors <- WriteMetadata(dir, "sw1", Metadata{Model: "GS308EP", Ports: i + 1, Updated: time.Now()})
+		}(i)
+	}
+	wg.Wait()
+	close(errors)
+	for err := range errors {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	m, ok := ReadMetadata(dir, "sw1")
+	if !ok || m.Model != "GS308EP" || m.Ports < 1 {
+		t.Errorf("ReadMetadata = %+v, %v", m, ok)
+	}
+	entries, err := os.ReadDir(filepath.Dir(MetadataPath(dir, "sw1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if len(names) != 1 {
+		t.Errorf("files left behind: %v", names)
+	}
+	info, err := os.Stat(MetadataPath(dir, "sw1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("mode = %o, want 600", mode)
+	}
+}
@@ -0,0 +1,226 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	go_netgear "github.com/gherlein/go-netgear"
+
+	"netgearcli/internal/errs"
+)
+
+// PortResult records what happened to each port of a multi-port change.
+type PortResult struct {
+	// Changed ports were updated successfully.
+	Changed []int `json:"changed"`
+	// Failed ports returned an error.
+	Failed []int `json:"failed,omitempty"`
+	// Unknown ports were in flight when the operation was interrupted;
+	// the switch may or may not have applied them.
+	Unknown []int `json:"unknown,omitempty"`
+	// Skipped ports were never attempted.
+	Skipped []int `json:"not_changed,omitempty"`
+	// Errors holds the error for each failed or unknown port.
+	Errors map[int]error `json:"-"`
+	// Interrupted is the context error if the change was cut short.
+	Interrupted error `json:"-"`
+}
+
+// Err summarizes the result: nil when every port changed, the failure
+// itself when nothing changed, and an errs.ErrPartial error otherwise.
+// Interruptions keep their cancellation or timeout class.
+func (r *PortResult) Err() error {
+	if len(r.Failed) == 0 && len(r.Unknown) == 0 && len(r.Skipped) == 0 {
+		return nil
+	}
+
+	cause := r.Interrupted
+	if cause == nil && len(r.Failed) > 0 {
+		cause = r.Errors[r.Failed[0]]
+	}
+	if cause == nil {
+		cause = errs.ErrCanceled
+	}
+
+	switch {
+	case errors.Is(cause, errs.ErrCanceled):
+		return fmt.Errorf("interrupted (%s): %w", r, cause)
+	case len(r.Changed) == 0:
+		return fmt.Errorf("%s: %w", r, cause)
+	}
+	return fmt.Errorf("%w (%s): %w", errs.ErrPartial, r, cause)
+}
+
+// String lists the ports in each state, e.g.
+// "changed [1 2], failed [3], not changed [4 5]".
+func (r *PortResult) String() string {
+	var parts []string
+	if len(r.Changed) > 0 {
+		parts = append(parts, fmt.Sprintf("changed %v", r.Changed))
+	}
+	if len(r.Failed) > 0 {
+		parts = append(parts, fmt.Sprintf("failed %v", r.Failed))
+	}
+	if len(r.Unknown) > 0 {
+		parts = append(parts, fmt.Sprintf("unknown %v", r.Unknown))
+	}
+	if len(r.Skipped) > 0 {
+		parts = append(parts, fmt.Sprintf("not changed %v", r.Skipped))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// SetPower enables or disables POE on each port in turn, retrying
+// transient failures, and reports which ports were changed.
+func (s *Session) SetPower(ctx context.Context, ports []int, enabled bool) *PortResult {
+	portPwr, operation := "disable", "Disable"
+	if enabled {
+		portPwr, operation = "enable", "Enable"
+	}
+	return s.eachPort(ctx, ports, func(port int) error {
+		return s.Do(ctx, operation, func(ctx context.Context) error {
+			s.debugf("Running PoeSetConfigCommand on port %d with PortPwr=%q\n", port, portPwr)
+			return s.change(ctx, &go_netgear.PoeSetConfigCommand{
+				Address: s.Address,
+				Ports:   []int{port},
+				PortPwr: portPwr,
+			})
+		})
+	})
+}
+
+// PortConfig holds PoE settings of a port other than its admin state, as
+// the switch reports them in its settings. Empty fields are left as they
+// are.
+type PortConfig struct {
+	Mode          string `json:"mode,omitempty"`
+	Priority      string `json:"priority,omitempty"`
+	LimitType     string `json:"limit_type,omitempty"`
+	Limit         string `json:"limit_w,omitempty"`
+	DetectionType string `json:"detection_type,omitempty"`
+}
+
+// String lists the fields set, e.g. "priority=high limit_w=15.4".
+func (c PortConfig) String() string {
+	var parts []string
+	for _, f := range []struct{ name, value string }{
+		{"mode", c.Mode},
+		{"priority", c.Priority},
+		{"limit_type", c.LimitType},
+		{"limit_w", c.Limit},
+		{"detection_type", c.DetectionType},
+	} {
+		if f.value != "" {
+			parts = append(parts, f.name+"="+f.value)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// SetConfig applies cfg to each port in turn, retrying transient failures,
+// and reports which ports were changed. The admin state is not touched.
+func (s *Session) SetConfig(ctx context.Context, ports []int, cfg PortConfig) *PortResult {
+	return s.eachPort(ctx, ports, func(port int) error {
+		return s.Do(ctx, "Configure", func(ctx context.Context) error {
+			s.debugf("Running PoeSetConfigCommand on port %d with %s\n", port, cfg)
+			return s.change(ctx, &go_netgear.PoeSetConfigCommand{
+				Address:   s.Address,
+				Ports:     []int{port},
+				PwrMode:   cfg.Mode,
+				PortPrio:  cfg.Priority,
+				LimitType: cfg.LimitType,
+				PwrLimit:  cfg.Limit,
+				DetecType: cfg.DetectionType,
+			})
+		})
+	})
+}
+
+// Cycle power cycles ports with a single request, so they all come back
+// together instead of one after another. Cycling is not retried, since a
+// request that timed out may still have cycled the ports, and the ports
+// share one outcome.
+func (s *Session) Cycle(ctx context.Context, ports []int) *PortResult {
+	result := &PortResult{Errors: make(map[int]error)}
+	if err := ctx.Err(); err != nil {
+		result.Interrupted = errs.Classify(err)
+		result.Skipped = append(result.Skipped, ports...)
+		return result
+	}
+
+	err := s.DoOnce(ctx, func(ctx context.Context) error {
+		s.debugf("Running PoeCyclePowerCommand on ports %v\n", ports)
+		return s.change(ctx, &go_netgear.PoeCyclePowerCommand{
+			Address: s.Address,
+			Ports:   ports,
+		})
+	})
+	switch {
+	case err == nil:
+		result.Changed = append(result.Changed, ports...)
+		return result
+	case ctx.Err() != nil:
+		// Interrupted mid-request: the switch may have cycled them
+		result.Interrupted = errs.Classify(ctx.Err())
+		result.Unknown = append(result.Unknown, ports...)
+	default:
+		s.logf("Cycling ports %v on %s failed: %v", ports, s.Address, err)
+		result.Failed = append(result.Failed, ports...)
+	}
+	for _, port := range ports {
+		result.Errors[port] = err
+	}
+	return result
+}
+
+// change runs a library command that changes the switch. What it prints
+// is kept off stdout, where callers report the result themselves, and
+// shown only with debug output.
+func (s *Session) change(ctx context.Context, cmd Command) error {
+	out, err := s.capture(ctx, cmd)
+	if out = bytes.TrimSpace(out); len(out) > 0 {
+		s.debugf("%s\n", out)
+	}
+	return err
+}
+
+// eachPort applies fn to ports one at a time so an interruption or
+// failure can be reported per port. Errors that affect the whole switch
+// (unreachable, authentication, interrupt) stop the remaining ports;
+// anything else is recorded and the next port is tried.
+func (s *Session) eachPort(ctx context.Context, ports []int, fn func(port int) error) *PortResult {
+	result := &PortResult{Errors: make(map[int]error)}
+	for i, port := range ports {
+		if err := ctx.Err(); err != nil {
+			result.Interrupted = errs.Classify(err)
+			result.Skipped = append(result.Skipped, ports[i:]...)
+			break
+		}
+
+		err := fn(port)
+		if err == nil {
+			result.Changed = append(result.Changed, port)
+			continue
+		}
+		result.Errors[port] = err
+
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			// Interrupted mid-request: the switch may have applied it
+			result.Interrupted = errs.Classify(ctxErr)
+			result.Unknown = append(result.Unknown, port)
+			result.Skipped = append(result.Skipped, ports[i+1:]...)
+			break
+		}
+
+		s.logf("Port %d on %s failed: %v", port, s.Address, err)
+		result.Failed = append(result.Failed, port)
+		if errs.Class(err) != nil {
+			result.Skipped = append(result.Skipped, ports[i+1:]...)
+			break
+		}
+	}
+	return result
+}
@@ -0,0 +1,55 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	go_netgear "github.com/gherlein/go-netgear"
+)
+
+// printingCommand prints like a library command does.
+type printingCommand struct{ out string }
+
+func (c printingCommand) Run(*go_netgear.GlobalOptions) error {
+	fmt.Print(c.out)
+	return nil
+}
+
+// stdout runs fn with os.Stdout redirected and returns what reached it.
+func stdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := os.Stdout
+	os.Stdout = w
+	fn()
+	os.Stdout = old
+	w.Close()
+	out, _ := io.ReadAll(r)
+	r.Close()
+	return string(out)
+}
+
+func TestChangeKeepsOutputOffStdout(t *testing.T) {
+	for _, debug := range []bool{false, true} {
+		t.Run(fmt.Sprintf("debug=%v", debug), func(t *testing.T) {
+			s := New("sw1", "")
+			s.Debug = debug
+			got := stdout(t, func() {
+				if err := s.change(context.Background(), printingCommand{`{"result":"ok"}` + "\n"}); err != nil {
+					t.Error(err)
+				}
+			})
+			shown := strings.Contains(got, `{"result":"ok"}`)
+			if shown != debug {
+				t.Errorf("stdout = %q with debug %v", got, debug)
+			}
+		})
+	}
+}
@@ -0,0 +1,376 @@
+// Package session manages an authenticated connection to one switch: the
+// cached token, login with retries, transparent re-login when the token
+// expires, and running go-netgear commands under a context.
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/adler32"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	go_netgear "github.com/gherlein/go-netgear"
+
+	"netgearcli/internal/errs"
+	"netgearcli/internal/lock"
+	"netgearcli/internal/poe"
+	"netgearcli/internal/retry"
+)
+
+// Command is any go-netgear command.
+type Command interface {
+	Run(*go_netgear.GlobalOptions) error
+}
+
+// Session holds what is needed to talk to one switch. Operations on a
+// Session are serialised, since the switches allow a single login session.
+type Session struct {
+	Address  string
+	Password string
+	Opts     *go_netgear.GlobalOptions
+	Retry    retry.Policy
+	Debug    bool
+	// Logf receives activity log lines. It may be nil.
+	Logf func(format string, args ...interface{})
+
+	mu sync.Mutex
+	// calls holds a slot while a library call runs, including one
+	// abandoned when its context was done
+	calls     chan struct{}
+	callsOnce sync.Once
+	// logins and loginFailures count completed logins, for metrics
+	logins        atomic.Int64
+	loginFailures atomic.Int64
+}
+
+// New returns a session for address with JSON output and the default
+// retry policy.
+func New(address, password string) *Session {
+	return &Session{
+		Address:  address,
+		Password: password,
+		Opts:     &go_netgear.GlobalOptions{OutputFormat: go_netgear.JsonFormat},
+		Retry:    retry.Default,
+	}
+}
+
+func (s *Session) logf(format string, args ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+func (s *Session) debugf(format string, args ...interface{}) {
+	if s.Debug {
+		poe.Exclusive(func() error {
+			_, err := fmt.Printf(format, args...)
+			return err
+		})
+	}
+}
+
+// EnsureAuthenticated ensures we have a valid session, logging in if necessary
+func (s *Session) EnsureAuthenticated(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ensureAuthenticated(ctx)
+}
+
+func (s *Session) ensureAuthenticated(ctx context.Context) error {
+	s.logf("Ensuring authentication for %s", s.Address)
+	// Check if cached token exists
+	if s.hasToken() {
+		// Validate the token with a keep-alive check
+		valid, err := s.validateToken(ctx)
+		if err != nil {
+			// The switch could not be asked; logging in would fail the same way
+			s.logf("Token validation failed for %s: %v", s.Address, err)
+			return err
+		}
+		if valid {
+			s.debugf("Using cached token\n")
+			s.logf("Using cached token for %s", s.Address)
+			return nil
+		}
+
+		// Token is invalid, remove it
+		s.debugf("Cached token is invalid, will re-login\n")
+		s.logf("Cached token invalid, re-authenticating to %s", s.Address)
+		s.removeToken()
+	}
+
+	// No valid token, need to login
+	return s.login(ctx)
+}
+
+// login executes the login command under the retry policy
+func (s *Session) login(ctx context.Context) error {
+	if s.Password == "" {
+		s.logf("Login failed: no password available for %s", s.Address)
+		return fmt.Errorf("no password available for authentication: %w", errs.ErrAuthRequired)
+	}
+
+	s.debugf("Logging in to %s...\n", s.Address)
+	s.logf("Logging in to %s", s.Address)
+
+	// Login is retried on any failure except those that will not fix themselves
+	retryable := func(err error) bool {
+		return !errors.Is(err, errs.ErrBadPassword) && !errors.Is(err, errs.ErrUnsupportedModel) &&
+			!errors.Is(err, errs.ErrCanceled)
+	}
+
+	err := s.Retry.Do(ctx, retryable, s.retryNotify("Login"), func() error {
+		loginCmd := &go_netgear.LoginCommand{
+			Address:  s.Address,
+			Password: s.Password,
+		}
+		return s.run(ctx, func() error {
+			return poe.Exclusive(func() error { return loginCmd.Run(s.Opts) })
+		})
+	})
+	if err != nil {
+		s.loginFailures.Add(1)
+		s.logf("Login to %s failed: %v", s.Address, err)
+		s.debugf("Login failed: %v\n", err)
+		return fmt.Errorf("login failed: %w", err)
+	}
+
+	s.logins.Add(1)
+	s.debugf("Login successful\n")
+	s.logf("Login successful to %s", s.Address)
+	return nil
+}
+
+// Logins returns how many logins this session has made and how many failed
+// after exhausting retries.
+func (s *Session) Logins() (succeeded, failed int64) {
+	return s.logins.Load(), s.loginFailures.Load()
+}
+
+// validateToken checks if the current token is still valid by making a lightweight request.
+// It returns an error only when the switch could not be asked at all.
+func (s *Session) validateToken(ctx context.Context) (bool, error) {
+	s.debugf("Validating cached token...\n")
+
+	// Make a lightweight status request; capture the output so the status
+	// JSON is not printed
+	_, err := s.capture(ctx, &go_netgear.PoeStatusCommand{Address: s.Address})
+	switch {
+	case errors.Is(err, errs.ErrAuthRequired):
+		s.debugf("Token validation failed: %v\n", err)
+		return false, nil
+	case errors.Is(err, errs.ErrUnreachable), errors.Is(err, errs.ErrTimeout), errors.Is(err, errs.ErrCanceled):
+		return false, err
+	}
+
+	s.debugf("Token is valid\n")
+	return true, nil
+}
+
+// withAuth executes fn and retries it once with a fresh login if the
+// session has expired.
+func (s *Session) withAuth(ctx context.Context, fn func() error) error {
+	err := errs.Classify(fn())
+	if !errors.Is(err, errs.ErrAuthRequired) {
+		return err
+	}
+
+	s.debugf("Token expired or invalid, re-authenticating...\n")
+	s.logf("Session for %s expired, re-authenticating", s.Address)
+
+	// Remove invalid token
+	s.removeToken()
+
+	if loginErr := s.login(ctx); loginErr != nil {
+		return fmt.Errorf("re-authentication failed: %w", loginErr)
+	}
+
+	// Retry the original operation once; a second auth failure is final
+	if err := errs.Classify(fn()); err != nil {
+		if errors.Is(err, errs.ErrAuthRequired) {
+			return fmt.Errorf("authentication failed even after re-login: %w", err)
+		}
+		return err
+	}
+	return nil
+}
+
+// Do runs fn, a read or idempotent write, with re-login on an expired
+// session and the retry policy for transient failures (unreachable,
+// timeout, switch busy).
+func (s *Session) Do(ctx context.Context, operation string, fn func(ctx context.Context) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Retry.Do(ctx, errs.Retryable, s.retryNotify(operation), func() error {
+		return s.withAuth(ctx, func() error { return fn(ctx) })
+	})
+}
+
+// DoOnce runs fn with re-login on an expired session but without retries,
+// for operations such as power cycling that must not be repeated.
+func (s *Session) DoOnce(ctx context.Context, fn func(ctx context.Context) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.withAuth(ctx, func() error { return fn(ctx) })
+}
+
+// Run runs a library command under ctx, letting it print its output, for
+// commands whose output is what the user asked to see. It waits for
+// captures in progress so the output is not read as theirs.
+func (s *Session) Run(ctx context.Context, cmd Command) error {
+	return s.run(ctx, func() error {
+		return poe.Exclusive(func() error { return cmd.Run(s.Opts) })
+	})
+}
+
+// Capture runs a library command with JSON output and returns what it
+// printed instead of letting it reach stdout.
+func (s *Session) Capture(ctx context.Context, cmd Command) ([]byte, error) {
+	return s.capture(ctx, cmd)
+}
+
+func (s *Session) capture(ctx context.Context, cmd Command) ([]byte, error) {
+	opts := *s.Opts
+	opts.Verbose = false // debug lines would corrupt the JSON
+	opts.OutputFormat = go_netgear.JsonFormat
+
+	var out []byte
+	err := s.run(ctx, func() error {
+		var err error
+		out, err = poe.Capture(func() error { return cmd.Run(&opts) })
+		return err
+	})
+	return out, err
+}
+
+// Status reads and parses the POE status of all ports.
+func (s *Session) Status(ctx context.Context) ([]poe.PortStatus, error) {
+	var statuses []poe.PortStatus
+	err := s.Do(ctx, "Status", func(ctx context.Context) error {
+		out, err := s.Capture(ctx, &go_netgear.PoeStatusCommand{Address: s.Address})
+		if err != nil {
+			return err
+		}
+		statuses, err = poe.ParseStatus(out)
+		return err
+	})
+	return statuses, err
+}
+
+// Settings reads and parses the POE settings of all ports.
+func (s *Session) Settings(ctx context.Context) ([]poe.PortSettings, error) {
+	var settings []poe.PortSettings
+	err := s.Do(ctx, "Settings", func(ctx context.Context) error {
+		out, err := s.Capture(ctx, &go_netgear.PoeShowSettingsCommand{Address: s.Address})
+		if err != nil {
+			return err
+		}
+		settings, err = poe.ParseSettings(out)
+		return err
+	})
+	return settings, err
+}
+
+// retryNotify reports a failed attempt before the retry policy waits
+func (s *Session) retryNotify(operation string) retry.Notify {
+	return func(attempt int, err error, delay time.Duration) {
+		s.debugf("%s attempt %d failed: %v\n", operation, attempt, err)
+		s.debugf("Waiting %v before retry...\n", delay)
+		s.logf("%s attempt %d failed for %s: %v; retrying in %v", operation, attempt, s.Address, err, delay)
+	}
+}
+
+// TokenPath returns the cached token file for the session's switch.
+func (s *Session) TokenPath() string {
+	return TokenPath(s.Opts.TokenDir, s.Address)
+}
+
+// hasToken checks if a cached token file exists
+func (s *Session) hasToken() bool {
+	tokenPath := s.TokenPath()
+	_, err := os.Stat(tokenPath)
+	exists := err == nil
+
+	if exists {
+		s.debugf("Found cached token at %s\n", tokenPath)
+	} else {
+		s.debugf("No cached token found at %s\n", tokenPath)
+	}
+	return exists
+}
+
+// Model returns the switch model recorded with the cached token, else the
+// model in the cached metadata, or "" if neither is known yet.
+func (s *Session) Model() string {
+	return CachedModel(s.Opts.TokenDir, s.Address)
+}
+
+// removeToken deletes the cached token file
+func (s *Session) removeToken() {
+	tokenPath := s.TokenPath()
+	os.Remove(tokenPath)
+	s.debugf("Removed invalid token at %s\n", tokenPath)
+}
+
+// Lock takes the cross-process lock for the session's switch, waiting up
+// to timeout for other processes using the same switch. waiting is called
+// once with the holder's PID if the lock is busy. Call the returned
+// function to release it.
+func (s *Session) Lock(ctx context.Context, timeout time.Duration, waiting func(holder int)) (func(), error) {
+	path := LockPath(s.Opts.TokenDir, s.Address)
+	s.debugf("Acquiring lock %s\n", path)
+
+	l, err := lock.Acquire(ctx, path, timeout, waiting)
+	if err != nil {
+		if errors.Is(err, lock.ErrTimeout) {
+			return nil, fmt.Errorf("%w: %w", errs.ErrSwitchBusy, err)
+		}
+		return nil, errs.Classify(err)
+	}
+	s.logf("Acquired lock for %s", s.Address)
+	return func() { l.Release() }, nil
+}
+
+// TokenPath returns the expected token file path for a given address.
+// This mirrors the logic in the go-netgear library.
+func TokenPath(configDir string, host string) string {
+	return configPath(configDir, "token-", host)
+}
+
+// TokenModel returns the switch model the library stores in front of the
+// cached token ("GS316EPP:<token>"), or "" if it is not known.
+func TokenModel(configDir string, host string) string {
+	data, err := os.ReadFile(TokenPath(configDir, host))
+	if err != nil {
+		return ""
+	}
+	model, _, found := strings.Cut(strings.TrimSpace(string(data)), ":")
+	if !found {
+		return ""
+	}
+	return model
+}
+
+// LockPath returns the lock file for a given address, next to its token.
+func LockPath(configDir string, host string) string {
+	return configPath(configDir, "lock-", host)
+}
+
+func configPath(configDir, prefix, host string) string {
+	// Using adler32 hash to match library behavior
+	hash32 := adler32.New()
+	io.WriteString(hash32, host)
+	hash := fmt.Sprintf("%x", hash32.Sum(nil))
+
+	if configDir == "" {
+		configDir = os.TempDir()
+	}
+	dotConfigDir := configDir + "/.config/ntgrrc"
+	return dotConfigDir + "/" + prefix + hash
+}
@@ -0,0 +1,249 @@
+package snapshot
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"netgearcli/internal/ansi"
+)
+
+// Kinds of change
+const (
+	Changed = "changed"
+	Added   = "added"
+	Removed = "removed"
+	// NotCompared is a switch that was not read for the newer side, such
+	// as one no longer in the config file for diff --live
+	NotCompared = "not_compared"
+)
+
+// Change is one difference between two snapshots. Port is zero for a switch
+// that is only in one of them or could not be read; Field is empty for
+// ports and switches that were added or removed.
+type Change struct {
+	Kind   string `json:"kind"`
+	Switch string `json:"switch"`
+	Port   int    `json:"port,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Field  string `json:"field,omitempty"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// fields are the port fields compared, in the order they are reported.
+// Settings are what an administrator configures, as opposed to delivery
+// state. Power draw is not compared: it changes all the time.
+var fields = []struct {
+	name    string
+	setting bool
+	value   func(Port) string
+}{
+	{"admin", true, func(p Port) string { return p.Admin }},
+	{"status", false, func(p Port) string { return p.Status }},
+	{"error", false, func(p Port) string { return p.Error }},
+	{"priority", true, func(p Port) string { return p.Priority }},
+	{"mode", true, func(p Port) string { return p.Mode }},
+	{"limit_type", true, func(p Port) string { return p.LimitType }},
+	{"limit_w", true, func(p Port) string { return p.Limit }},
+	{"detection_type", true, func(p Port) string { return p.DetectionType }},
+	{"class", false, func(p Port) string { return p.Class }},
+	{"name", true, func(p Port) string { return p.Name }},
+}
+
+// Diff lists what changed from a to b, by switch and port.
+func Diff(a, b *Snapshot) []Change {
+	before := switchMap(a)
+	after := switchMap(b)
+	names := make([]string, 0, len(before)+len(after))
+	for name := range before {
+		names = append(names, name)
+	}
+	for name := range after {
+		if _, ok := before[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var changes []Change
+	for _, name := range names {
+		x, inA := before[name]
+		y, inB := after[name]
+		switch {
+		case !inB:
+			changes = append(changes, Change{Kind: Removed, Switch: name})
+		case !inA:
+			changes = append(changes, Change{Kind: Added, Switch: name})
+		case x.Error != "" || y.Error != "":
+			// Ports cannot be compared, but a switch that stopped or started
+			// answering is itself a change
+			if x.Error != y.Error {
+				changes = append(changes, Change{Kind: Changed, Switch: name, Field: "error", Before: x.Error, After: y.Error})
+			}
+		default:
+			changes = append(changes, diffPorts(name, x.Ports, y.Ports, false)...)
+		}
+	}
+	return changes
+}
+
+// MarkNotCompared reports the named switches as not compared rather than
+// removed, for switches that were left out of the newer side on purpose.
+func MarkNotCompared(changes []Change, names ...string) []Change {
+	for i, c := range changes {
+		if c.Kind != Removed || c.Port != 0 {
+			continue
+		}
+		for _, name := range names {
+			if c.Switch == name {
+				changes[i].Kind = NotCompared
+			}
+		}
+	}
+	return changes
+}
+
+func switchMap(s *Snapshot) map[string]Switch {
+	m := make(map[string]Switch, len(s.Switches))
+	for _, sw := range s.Switches {
+		m[sw.Name] = sw
+	}
+	return m
+}
+
+// DiffSettings lists the settings of one switch's ports that differ from a
+// to b, ignoring delivery state.
+func DiffSettings(sw string, a, b []Port) []Change {
+	return diffPorts(sw, a, b, true)
+}
+
+func diffPorts(sw string, a, b []Port, settingsOnly bool) []Change {
+	before := make(map[int]Port, len(a))
+	for _, p := range a {
+		before[p.Port] = p
+	}
+	after := make(map[int]Port, len(b))
+	for _, p := range b {
+		after[p.Port] = p
+	}
+	numbers := make([]int, 0, len(before)+len(after))
+	for n := range before {
+		numbers = append(numbers, n)
+	}
+	for n := range after {
+		if _, ok := before[n]; !ok {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Ints(numbers)
+
+	var changes []Change
+	for _, n := range numbers {
+		x, inA := before[n]
+		y, inB := after[n]
+		switch {
+		case !inB:
+			changes = append(changes, Change{Kind: Removed, Switch: sw, Port: n, Name: x.Name})
+		case !inA:
+			changes = append(changes, Change{Kind: Added, Switch: sw, Port: n, Name: y.Name})
+		default:
+			for _, f := range fields {
+				if settingsOnly && !f.setting {
+					continue
+				}
+				if vx, vy := f.value(x), f.value(y); vx != vy {
+					changes = append(changes, Change{Kind: Changed, Switch: sw, Port: n, Name: firstNonEmpty(y.Name, x.Name),
+						Field: f.name, Before: vx, After: vy})
+				}
+			}
+		}
+	}
+	return changes
+}
+
+// Side names one of the two sides of a diff: a snapshot file or "live".
+type Side struct {
+	Source string    `json:"source"`
+	Time   time.Time `json:"time"`
+}
+
+// WriteText writes changes grouped by port, one field per line, with the
+// old value in red and the new one in green when color is set.
+func WriteText(w io.Writer, changes []Change, from, to Side, color bool) error {
+	paint := func(style, text string) string {
+		if color {
+			return style + text + ansi.Reset
+		}
+		return text
+	}
+
+	var b strings.Builder
+	stamp := func(s Side) string { return s.Source + "\t" + s.Time.Local().Format(time.DateTime) }
+	fmt.Fprintf(&b, "%s\n%s\n", paint(ansi.Red, "--- "+stamp(from)), paint(ansi.Green, "+++ "+stamp(to)))
+	if len(changes) == 0 {
+		b.WriteString("\nNo differences\n")
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+
+	type key struct {
+		sw   string
+		port int
+	}
+	var last *key
+	ports := make(map[key]bool)
+	skipped := 0
+	for _, c := range changes {
+		k := key{c.Switch, c.Port}
+		if last == nil || *last != k {
+			title := c.Switch
+			if c.Port != 0 {
+				title = fmt.Sprintf("%s port %d", c.Switch, c.Port)
+				if c.Name != "" {
+					title += " (" + c.Name + ")"
+				}
+				ports[k] = true
+			}
+			fmt.Fprintf(&b, "\n%s\n", paint(ansi.Bold, title))
+			last = &k
+		}
+		switch c.Kind {
+		case Added:
+			fmt.Fprintf(&b, "  %s\n", paint(ansi.Green, "+ only in "+to.Source))
+		case Removed:
+			fmt.Fprintf(&b, "  %s\n", paint(ansi.Red, "- only in "+from.Source))
+		case NotCompared:
+			fmt.Fprintf(&b, "  %s\n", paint(ansi.Dim, "not compared"))
+			skipped++
+		default:
+			fmt.Fprintf(&b, "  %-15s %s -> %s\n", c.Field, paint(ansi.Red, quoteEmpty(c.Before)), paint(ansi.Green, quoteEmpty(c.After)))
+		}
+	}
+	fmt.Fprintf(&b, "\n%d change(s) on %d port(s)", len(changes)-skipped, len(ports))
+	if skipped > 0 {
+		fmt.Fprintf(&b, "; %d switch(es) not compared", skipped)
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// quoteEmpty shows an empty value as "" so it is visible.
+func quoteEmpty(s string) string {
+	if s == "" {
+		return `""`
+	}
+	return s
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
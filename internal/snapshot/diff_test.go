@@ -0,0 +1,86 @@
+package snapshot
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	a := &Snapshot{Switches: []Switch{
+		{Name: "gone", Ports: []Port{{Port: 1, Admin: "enabled"}}},
+		{Name: "lab", Ports: []Port{
+			{Port: 1, Name: "cam", Admin: "enabled", Status: "Delivering Power", Power: 4},
+			{Port: 2, Admin: "disabled", Priority: "low"},
+		}},
+		{Name: "offline", Error: "switch unreachable"},
+	}}
+	b := &Snapshot{Switches: []Switch{
+		{Name: "lab", Ports: []Port{
+			// Power draw alone is not a change
+			{Port: 1, Name: "cam", Admin: "enabled", Status: "Delivering Power", Power: 6},
+			{Port: 2, Admin: "enabled", Priority: "high"},
+			{Port: 3, Name: "ap", Admin: "enabled"},
+		}},
+		{Name: "new"},
+		{Name: "offline", Error: "switch unreachable"},
+	}}
+	want := []Change{
+		{Kind: Removed, Switch: "gone"},
+		{Kind: Changed, Switch: "lab", Port: 2, Field: "admin", Before: "disabled", After: "enabled"},
+		{Kind: Changed, Switch: "lab", Port: 2, Field: "priority", Before: "low", After: "high"},
+		{Kind: Added, Switch: "lab", Port: 3, Name: "ap"},
+		{Kind: Added, Switch: "new"},
+	}
+	if got := Diff(a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestMarkNotCompared(t *testing.T) {
+	a := &Snapshot{Switches: []Switch{
+		{Name: "lab", Ports: []Port{{Port: 1, Admin: "enabled"}}},
+		{Name: "retired", Ports: []Port{{Port: 1, Admin: "enabled"}}},
+		{Name: "sold"},
+	}}
+	b := &Snapshot{Switches: []Switch{{Name: "lab", Ports: []Port{{Port: 2, Admin: "enabled"}}}}}
+
+	// A port missing from a switch that was read is still removed
+	got := MarkNotCompared(Diff(a, b), "retired", "lab")
+	want := []Change{
+		{Kind: Removed, Switch: "lab", Port: 1},
+		{Kind: Added, Switch: "lab", Port: 2},
+		{Kind: NotCompared, Switch: "retired"},
+		{Kind: Removed, Switch: "sold"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MarkNotCompared =\n%+v\nwant\n%+v", got, want)
+	}
+
+	var out bytes.Buffer
+	when := time.Date(2026, 3, 4, 9, 0, 0, 0, time.Local)
+	if err := WriteText(&out, got, Side{"before.json", when}, Side{"live", when}, false); err != nil {
+		t.Fatal(err)
+	}
+	wantText := `--- before.json	2026-03-04 09:00:00
++++ live	2026-03-04 09:00:00
+
+lab port 1
+  - only in before.json
+
+lab port 2
+  + only in live
+
+retired
+  not compared
+
+sold
+  - only in before.json
+
+3 change(s) on 2 port(s); 1 switch(es) not compared
+`
+	if out.String() != wantText {
+		t.Errorf("WriteText wrote:\n%s\nwant:\n%s", out.String(), wantText)
+	}
+}
@@ -0,0 +1,185 @@
+// Package snapshot saves the PoE state of switches to a file and compares
+// two snapshots, or a snapshot and the live switches, port by port.
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/poe"
+)
+
+// Version is the snapshot file format version.
+const Version = 1
+
+// Snapshot is the PoE state of some switches at one time.
+type Snapshot struct {
+	Version  int       `json:"version"`
+	Time     time.Time `json:"time"`
+	Switches []Switch  `json:"switches"`
+}
+
+// Switch is one switch in a snapshot. Error is set instead of Ports when
+// the switch could not be read.
+type Switch struct {
+	Name    string `json:"name"`
+	Address string `json:"address,omitempty"`
+	Model   string `json:"model,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Ports   []Port `json:"ports,omitempty"`
+}
+
+// Port is one port's configuration and delivery state.
+type Port struct {
+	Port          int     `json:"port"`
+	Name          string  `json:"name,omitempty"`
+	Admin         string  `json:"admin"`
+	Priority      string  `json:"priority,omitempty"`
+	Mode          string  `json:"mode,omitempty"`
+	LimitType     string  `json:"limit_type,omitempty"`
+	Limit         string  `json:"limit_w,omitempty"`
+	DetectionType string  `json:"detection_type,omitempty"`
+	Status        string  `json:"status,omitempty"`
+	Class         string  `json:"class,omitempty"`
+	Power         float64 `json:"power_w"`
+	Error         string  `json:"error,omitempty"`
+}
+
+// Take reads every member in parallel, each under its switch lock. A switch
+// that cannot be read is recorded with its error; the returned error is
+// the first such failure.
+func Take(ctx context.Context, members []*fleet.Member, timeout time.Duration) (*Snapshot, error) {
+	s := &Snapshot{Version: Version, Time: time.Now().UTC(), Switches: make([]Switch, len(members))}
+	errs := make([]error, len(members))
+	var wg sync.WaitGroup
+	for i, m := range members {
+		wg.Add(1)
+		go func(i int, m *fleet.Member) {
+			defer wg.Done()
+			s.Switches[i], errs[i] = Read(ctx, m, timeout)
+		}(i, m)
+	}
+	wg.Wait()
+
+	sort.Slice(s.Switches, func(i, j int) bool { return s.Switches[i].Name < s.Switches[j].Name })
+	for i, err := range errs {
+		if err != nil {
+			return s, fmt.Errorf("%s: %w", members[i].Config.Name, err)
+		}
+	}
+	return s, nil
+}
+
+// Read reads the settings and status of one switch under its lock.
+func Read(ctx context.Context, m *fleet.Member, timeout time.Duration) (Switch, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	sw := Switch{Name: m.Config.Name, Address: m.Config.Address}
+	var settings []poe.PortSettings
+	var statuses []poe.PortStatus
+	err := m.Locked(ctx, func(ctx context.Context) error {
+		var err error
+		if settings, err = m.Session.Settings(ctx); err != nil {
+			return err
+		}
+		statuses, err = m.Session.Status(ctx)
+		return err
+	})
+	sw.Model = m.Config.Model
+	if sw.Model == "" {
+		sw.Model = m.Session.Model()
+	}
+	if err != nil {
+		sw.Error = err.Error()
+		return sw, err
+	}
+	sw.Ports = Ports(settings, statuses)
+	return sw, nil
+}
+
+// Ports combines settings and status rows into ports sorted by number.
+func Ports(settings []poe.PortSettings, statuses []poe.PortStatus) []Port {
+	byPort := make(map[int]*Port)
+	get := func(n int) *Port {
+		if p, ok := byPort[n]; ok {
+			return p
+		}
+		p := &Port{Port: n}
+		byPort[n] = p
+		return p
+	}
+	for _, s := range settings {
+		p := get(s.Port)
+		p.Name = s.Name
+		p.Admin = "disabled"
+		if s.Enabled() {
+			p.Admin = "enabled"
+		}
+		p.Priority = s.Priority
+		p.Mode = s.Mode
+		p.LimitType = s.LimitType
+		p.Limit = s.Limit
+		p.DetectionType = s.DetectionType
+	}
+	for _, s := range statuses {
+		p := get(s.Port)
+		if p.Name == "" {
+			p.Name = s.Name
+		}
+		p.Status = s.Status
+		p.Class = s.Class
+		p.Power = s.Power
+		if s.Faulted() {
+			p.Error = s.Error
+		}
+	}
+
+	ports := make([]Port, 0, len(byPort))
+	for _, p := range byPort {
+		ports = append(ports, *p)
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Port < ports[j].Port })
+	return ports
+}
+
+// Load reads a snapshot file.
+func Load(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if s.Version != Version {
+		return nil, fmt.Errorf("%s: unsupported snapshot version %d", path, s.Version)
+	}
+	return &s, nil
+}
+
+// Switch returns the named switch.
+func (s *Snapshot) Switch(name string) (Switch, bool) {
+	for _, sw := range s.Switches {
+		if sw.Name == name {
+			return sw, true
+		}
+	}
+	return Switch{}, false
+}
+
+// Names lists the switches in the snapshot.
+func (s *Snapshot) Names() []string {
+	names := make([]string, len(s.Switches))
+	for i, sw := range s.Switches {
+		names[i] = sw.Name
+	}
+	return names
+}
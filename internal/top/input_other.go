@@ -0,0 +1,11 @@
+//go:build !unix
+
+package top
+
+import "os"
+
+// pollableInput returns in unchanged: reads cannot be interrupted here, so
+// the key reader stops at the next key press after the dashboard exits.
+func pollableInput(in *os.File) (*os.File, func()) {
+	return in, func() {}
+}
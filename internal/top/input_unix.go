@@ -0,0 +1,29 @@
+//go:build unix
+
+package top
+
+import (
+	"os"
+	"syscall"
+)
+
+// pollableInput returns a copy of in that Go's poller manages, so closing
+// it wakes a blocked Read, and a func that closes it and puts in back into
+// blocking mode. Stdin is opened blocking; a read on it cannot be
+// interrupted and would outlive the dashboard.
+func pollableInput(in *os.File) (*os.File, func()) {
+	fd, err := syscall.Dup(int(in.Fd()))
+	if err != nil {
+		return in, func() {}
+	}
+	// O_NONBLOCK is shared with in, which is why it must be cleared again
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return in, func() {}
+	}
+	f := os.NewFile(uintptr(fd), in.Name())
+	return f, func() {
+		f.Close()
+		syscall.SetNonblock(int(in.Fd()), false)
+	}
+}
@@ -0,0 +1,55 @@
+//go:build unix
+
+package top
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestClosingPollableInputWakesRead(t *testing.T) {
+	// A blocking descriptor, as stdin is
+	fds := make([]int, 2)
+	if err := syscall.Pipe(fds); err != nil {
+		t.Fatal(err)
+	}
+	in := os.NewFile(uintptr(fds[0]), "stdin")
+	out := os.NewFile(uintptr(fds[1]), "pipe")
+	defer in.Close()
+	defer out.Close()
+
+	f, closeIn := pollableInput(in)
+	read := make(chan error, 1)
+	go func() {
+		_, err := f.Read(make([]byte, 1))
+		read <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	closeIn()
+	select {
+	case err := <-read:
+		if err == nil {
+			t.Error("Read succeeded on a closed input")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Read still blocked after the input was closed")
+	}
+
+	nonblock, err := isNonblock(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonblock {
+		t.Error("input left in non-blocking mode")
+	}
+}
+
+func isNonblock(f *os.File) (bool, error) {
+	flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), syscall.F_GETFL, 0)
+	if errno != 0 {
+		return false, errno
+	}
+	return flags&syscall.O_NONBLOCK != 0, nil
+}
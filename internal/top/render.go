@@ -0,0 +1,253 @@
+package top
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+
+	"netgearcli/internal/ansi"
+	"netgearcli/internal/errs"
+	"netgearcli/internal/poe"
+)
+
+// span is text drawn in one style.
+type span struct {
+	text  string
+	style string
+}
+
+// line is one screen line made of styled spans.
+type line []span
+
+func (l line) add(style, format string, args ...interface{}) line {
+	return append(l, span{text: fmt.Sprintf(format, args...), style: style})
+}
+
+// render draws l cut to width columns. base applies to the whole line; with
+// fill the line is padded so base covers the full width.
+func (l line) render(width int, base string, fill bool) string {
+	var b strings.Builder
+	used := 0
+	for _, s := range l {
+		text := s.text
+		if n := utf8.RuneCountInString(text); used+n > width {
+			text = string([]rune(text)[:width-used])
+		}
+		b.WriteString(base + s.style + text + ansi.Reset)
+		used += utf8.RuneCountInString(text)
+		if used >= width {
+			break
+		}
+	}
+	if fill && used < width {
+		b.WriteString(base + strings.Repeat(" ", width-used) + ansi.Reset)
+	}
+	return b.String()
+}
+
+// draw redraws the whole screen.
+func (d *Dashboard) draw() {
+	width, height, err := term.GetSize(int(d.Out.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		width, height = 100, 30
+	}
+
+	title := d.Title
+	if title == "" {
+		title = "netgear top"
+	}
+	var total float64
+	for _, v := range d.views {
+		for _, p := range v.ports {
+			total += p.Power
+		}
+	}
+	clock := time.Now().Format("15:04:05")
+	left := fmt.Sprintf("%s - %d switch(es), %.1f W total, refresh every %s", title, len(d.views), total, d.Interval)
+	header := []line{
+		line{}.add(ansi.Bold, "%s", left).add("", "%*s", max(width-utf8.RuneCountInString(left), 0), clock),
+		line{}.add(ansi.Dim, "↑/↓ select  tab next switch  e enable  d disable  c cycle  r refresh  q quit"),
+	}
+
+	var body []line
+	selectedLine := -1
+	changedLines := make(map[int]bool)
+	for i, v := range d.views {
+		body = append(body, line{}, d.switchLine(v))
+		if v.err != nil {
+			body = append(body, line{}.add(ansi.Red, "  %s: %v", errs.Name(v.err), v.err))
+		}
+		if len(v.ports) == 0 {
+			if v.err == nil {
+				body = append(body, line{}.add(ansi.Dim, "  waiting for first poll..."))
+			}
+			continue
+		}
+		body = append(body, line{}.add(ansi.Dim, "  %-4s %-16s %-5s %-18s %-6s %8s %-10s  %6s  %s",
+			"PORT", "NAME", "ADMIN", "STATUS", "CLASS", "POWER", "", "TEMP", "ERROR"))
+		for _, p := range v.ports {
+			if (portRef{view: i, port: p.Port}) == d.selected {
+				selectedLine = len(body)
+			}
+			if p.changed {
+				changedLines[len(body)] = true
+			}
+			body = append(body, portLine(p))
+		}
+	}
+
+	var footer line
+	switch {
+	case d.confirm != nil:
+		v := d.views[d.confirm.ref.view]
+		footer = footer.add(ansi.Bold+ansi.Yellow, "%s PoE on %s port %d%s? [y/N]", actionVerb(d.confirm.action),
+			v.member.Config.Name, d.confirm.ref.port, portName(v, d.confirm.ref.port))
+	case d.message != "":
+		footer = footer.add(ansi.Cyan, "%s", d.message)
+	}
+
+	// Scroll the body so the selected port stays on screen
+	rows := height - len(header) - 2
+	if rows < 1 {
+		rows = 1
+	}
+	offset := 0
+	if selectedLine >= rows {
+		offset = selectedLine - rows + 1
+	}
+	end := min(offset+rows, len(body))
+
+	var out strings.Builder
+	out.WriteString("\x1b[H")
+	for _, l := range header {
+		out.WriteString(l.render(width, "", false) + "\x1b[K\r\n")
+	}
+	for n := offset; n < end; n++ {
+		switch {
+		case n == selectedLine:
+			out.WriteString(body[n].render(width, ansi.Reverse, true))
+		case changedLines[n]:
+			out.WriteString(body[n].render(width, ansi.Bold, false))
+		default:
+			out.WriteString(body[n].render(width, "", false))
+		}
+		out.WriteString("\x1b[K\r\n")
+	}
+	out.WriteString("\x1b[J")
+	// The footer sits on the last line
+	fmt.Fprintf(&out, "\x1b[%d;1H%s\x1b[K", height, footer.render(width, "", false))
+	fmt.Fprint(d.Out, out.String())
+}
+
+// switchLine summarizes one switch: power drawn, budget usage, hottest port
+// and when it was last read.
+func (d *Dashboard) switchLine(v *switchView) line {
+	cfg := v.member.Config
+	l := line{}.add(ansi.Bold, "%s", cfg.Name)
+	if cfg.Address != cfg.Name {
+		l = l.add(ansi.Dim, " (%s)", cfg.Address)
+	}
+
+	var watts, hottest float64
+	delivering := 0
+	for _, p := range v.ports {
+		watts += p.Power
+		hottest = max(hottest, p.Temperature)
+		if p.Delivering() {
+			delivering++
+		}
+	}
+	if len(v.ports) > 0 {
+		l = l.add("", "  %d/%d delivering  %.1f W", delivering, len(v.ports), watts)
+		model := cfg.Model
+		if model == "" {
+			model = v.member.Session.Model()
+		}
+		if budget, ok := poe.ResolveBudget(model, cfg.PoEBudget); ok {
+			fraction := watts / budget
+			l = l.add("", " / %.0f W ", budget).
+				add(barStyle(fraction), "%s", bar(fraction, 20)).
+				add("", " %3.0f%%", fraction*100)
+		}
+		if hottest > 0 {
+			l = l.add("", "  max %.0f°C", hottest)
+		}
+	}
+
+	switch {
+	case v.updated.IsZero():
+	case v.err != nil:
+		l = l.add(ansi.Red, "  stale, last read %s ago", since(v.updated))
+	default:
+		l = l.add(ansi.Dim, "  updated %s ago", since(v.updated))
+	}
+	return l
+}
+
+// portLine is one row of the port table.
+func portLine(p portView) line {
+	statusStyle := ""
+	switch {
+	case p.Faulted():
+		statusStyle = ansi.Red
+	case p.Delivering():
+		statusStyle = ansi.Green
+	case p.admin == "off":
+		statusStyle = ansi.Dim
+	}
+
+	name := p.Name
+	if utf8.RuneCountInString(name) > 16 {
+		name = string([]rune(name)[:15]) + "…"
+	}
+	temp := "--"
+	if p.Temperature > 0 {
+		temp = fmt.Sprintf("%.0f°C", p.Temperature)
+	}
+	errText := ""
+	if p.Faulted() {
+		errText = p.Error
+	}
+
+	fraction := p.Power / portBarWatts
+	return line{}.
+		add("", "  %-4d %-16s %-5s ", p.Port, name, p.admin).
+		add(statusStyle, "%-18.18s", p.Status).
+		add("", " %-6s %6.1f W ", p.Class, p.Power).
+		add(barStyle(fraction), "%s", bar(fraction, 10)).
+		add("", "  %6s  ", temp).
+		add(ansi.Red, "%s", errText)
+}
+
+// bar draws fraction (0-1) as a bar of width cells.
+func bar(fraction float64, width int) string {
+	filled := int(fraction*float64(width) + 0.5)
+	filled = min(max(filled, 0), width)
+	return strings.Repeat("█", filled) + strings.Repeat("░", width-filled)
+}
+
+func barStyle(fraction float64) string {
+	switch {
+	case fraction >= 0.9:
+		return ansi.Red
+	case fraction >= 0.7:
+		return ansi.Yellow
+	}
+	return ansi.Green
+}
+
+func portName(v *switchView, port int) string {
+	for _, p := range v.ports {
+		if p.Port == port && p.Name != "" {
+			return " (" + p.Name + ")"
+		}
+	}
+	return ""
+}
+
+func since(t time.Time) string {
+	return time.Since(t).Round(time.Second).String()
+}
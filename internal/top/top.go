@@ -0,0 +1,469 @@
+// Package top is a full-screen terminal dashboard of the PoE ports on one
+// or more switches. It refreshes every few seconds, draws per-port power
+// bars and the switch's budget usage, highlights ports that changed, and can
+// enable, disable or power cycle the selected port after confirmation.
+package top
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+
+	"netgearcli/internal/errs"
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/hooks"
+	"netgearcli/internal/poe"
+)
+
+// portBarWatts is the full scale of a port's power bar: the 802.3at (PoE+)
+// per-port maximum.
+const portBarWatts = 30
+
+// Dashboard shows live PoE status for its members until the user quits.
+type Dashboard struct {
+	Members  []*fleet.Member
+	Interval time.Duration
+	// Timeout bounds one poll of one switch. Defaults to 30s.
+	Timeout time.Duration
+	// Actor is recorded for changes made from the dashboard.
+	Actor hooks.Actor
+	// Title is shown in the top line, e.g. "netgear top".
+	Title string
+	In    *os.File
+	Out   *os.File
+
+	views    []*switchView
+	selected portRef
+	// moved is set once the user moves the selection
+	moved   bool
+	confirm *pending
+	message string
+	refresh []chan struct{}
+}
+
+// HeldLog collects log output while the dashboard owns the terminal, where
+// anything written to stderr would scribble over the screen. Point loggers
+// at it before Run and Flush it to stderr once Run has returned.
+type HeldLog struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (h *HeldLog) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.buf.Write(p)
+}
+
+// Flush writes everything held so far to w.
+func (h *HeldLog) Flush(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.buf.WriteTo(w)
+	return err
+}
+
+// Logf formats a line into the held log, for the Logf hooks of the
+// dispatcher and audit log.
+func (h *HeldLog) Logf(format string, args ...interface{}) {
+	line := fmt.Sprintf(format, args...)
+	if !strings.HasSuffix(line, "\n") {
+		line += "\n"
+	}
+	h.Write([]byte(line))
+}
+
+// switchView is what the dashboard knows about one switch.
+type switchView struct {
+	member  *fleet.Member
+	ports   []portView
+	err     error
+	updated time.Time
+}
+
+// portView is one port's latest status and whether it changed in the last
+// refresh.
+type portView struct {
+	poe.PortStatus
+	admin   string
+	changed bool
+}
+
+// portRef identifies a port on the screen.
+type portRef struct {
+	view int
+	port int
+}
+
+// pending is a change awaiting confirmation.
+type pending struct {
+	action string
+	ref    portRef
+}
+
+// pollResult is one switch's poll.
+type pollResult struct {
+	view     int
+	statuses []poe.PortStatus
+	settings []poe.PortSettings
+	err      error
+}
+
+// Special keys; other keys are their rune
+const (
+	keyUp   = -1
+	keyDown = -2
+	keyEsc  = 27
+	keyTab  = '\t'
+	keyCtlC = 3
+)
+
+// Run takes over the terminal and shows the dashboard until the user quits
+// or ctx is done.
+func (d *Dashboard) Run(ctx context.Context) error {
+	if len(d.Members) == 0 {
+		return errors.New("no switches to show")
+	}
+	if d.In == nil {
+		d.In = os.Stdin
+	}
+	if d.Out == nil {
+		d.Out = os.Stdout
+	}
+	if !term.IsTerminal(int(d.In.Fd())) || !term.IsTerminal(int(d.Out.Fd())) {
+		return fmt.Errorf("%w: the dashboard needs a terminal", errs.ErrUsage)
+	}
+	if d.Interval <= 0 {
+		d.Interval = 5 * time.Second
+	}
+
+	oldState, err := term.MakeRaw(int(d.In.Fd()))
+	if err != nil {
+		return err
+	}
+	// Alternate screen, hidden cursor; both restored on the way out
+	fmt.Fprint(d.Out, "\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Fprint(d.Out, "\x1b[?25h\x1b[?1049l")
+		term.Restore(int(d.In.Fd()), oldState)
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	d.views = make([]*switchView, len(d.Members))
+	d.refresh = make([]chan struct{}, len(d.Members))
+	polls := make(chan pollResult)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+	for i, m := range d.Members {
+		d.views[i] = &switchView{member: m}
+		d.refresh[i] = make(chan struct{}, 1)
+		wg.Add(1)
+		go func(i int, m *fleet.Member) {
+			defer wg.Done()
+			d.pollLoop(ctx, i, m, polls)
+		}(i, m)
+	}
+
+	// Closing the input on the way out stops the key reader, so it does
+	// not go on taking keys from stdin after Run returns
+	in, closeIn := pollableInput(d.In)
+	defer closeIn()
+	keys := make(chan int)
+	go d.readKeys(ctx, in, keys)
+
+	changes := make(chan string)
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+
+	d.draw()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case r := <-polls:
+			d.update(r)
+		case msg := <-changes:
+			d.message = msg
+		case k, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			if !d.handleKey(ctx, k, changes) {
+				return nil
+			}
+		case <-tick.C:
+		}
+		d.draw()
+	}
+}
+
+// pollLoop polls one switch every Interval, or sooner when asked to.
+func (d *Dashboard) pollLoop(ctx context.Context, i int, m *fleet.Member, polls chan<- pollResult) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		r := d.poll(ctx, m)
+		r.view = i
+		select {
+		case polls <- r:
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.refresh[i]:
+		}
+	}
+}
+
+// poll reads the status and settings of one switch.
+func (d *Dashboard) poll(ctx context.Context, m *fleet.Member) pollResult {
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var r pollResult
+	r.err = m.Locked(ctx, func(ctx context.Context) error {
+		var err error
+		if r.settings, err = m.Session.Settings(ctx); err != nil {
+			return err
+		}
+		r.statuses, err = m.Session.Status(ctx)
+		return err
+	})
+	return r
+}
+
+// update applies a poll, marking ports whose state changed.
+func (d *Dashboard) update(r pollResult) {
+	v := d.views[r.view]
+	v.err = r.err
+	if r.err != nil {
+		return
+	}
+	v.updated = time.Now()
+
+	previous := make(map[int]portView, len(v.ports))
+	for _, p := range v.ports {
+		previous[p.Port] = p
+	}
+	admin := make(map[int]string, len(r.settings))
+	for _, s := range r.settings {
+		admin[s.Port] = "off"
+		if s.Enabled() {
+			admin[s.Port] = "on"
+		}
+	}
+
+	ports := make([]portView, 0, len(r.statuses))
+	for _, s := range r.statuses {
+		p := portView{PortStatus: s, admin: admin[s.Port]}
+		if old, ok := previous[s.Port]; ok {
+			p.changed = old.Status != p.Status || old.admin != p.admin || old.Error != p.Error ||
+				abs(old.Power-p.Power) >= 1
+		}
+		ports = append(ports, p)
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Port < ports[j].Port })
+	v.ports = ports
+
+	// Until the user moves, keep the first port selected as switches report
+	if !d.moved {
+		if refs := d.rows(); len(refs) > 0 {
+			d.selected = refs[0]
+		}
+	}
+}
+
+// rows lists every port on screen, in display order.
+func (d *Dashboard) rows() []portRef {
+	var refs []portRef
+	for i, v := range d.views {
+		for _, p := range v.ports {
+			refs = append(refs, portRef{view: i, port: p.Port})
+		}
+	}
+	return refs
+}
+
+// handleKey acts on a key press. It returns false to quit.
+func (d *Dashboard) handleKey(ctx context.Context, k int, changes chan<- string) bool {
+	if d.confirm != nil {
+		p := d.confirm
+		d.confirm = nil
+		if k == 'y' || k == 'Y' {
+			d.message = fmt.Sprintf("%s %s port %d...", actionDoing(p.action), d.views[p.ref.view].member.Config.Name, p.ref.port)
+			go d.change(ctx, p, changes)
+		} else {
+			d.message = "Canceled"
+		}
+		return k != keyCtlC
+	}
+
+	switch k {
+	case 'q', 'Q', keyCtlC:
+		return false
+	case keyUp, 'k':
+		d.move(-1)
+	case keyDown, 'j':
+		d.move(1)
+	case keyTab:
+		d.nextSwitch()
+	case 'r':
+		for _, ch := range d.refresh {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+		d.message = "Refreshing"
+	case 'e', 'd', 'c':
+		if d.selected.port == 0 {
+			return true
+		}
+		action := map[int]string{'e': hooks.EventEnable, 'd': hooks.EventDisable, 'c': hooks.EventCycle}[k]
+		d.confirm = &pending{action: action, ref: d.selected}
+	case keyEsc:
+		d.message = ""
+	}
+	return true
+}
+
+func (d *Dashboard) move(delta int) {
+	d.moved = true
+	refs := d.rows()
+	for i, ref := range refs {
+		if ref == d.selected {
+			if j := i + delta; j >= 0 && j < len(refs) {
+				d.selected = refs[j]
+			}
+			return
+		}
+	}
+}
+
+// nextSwitch selects the first port of the next switch with ports.
+func (d *Dashboard) nextSwitch() {
+	d.moved = true
+	for step := 1; step <= len(d.views); step++ {
+		i := (d.selected.view + step) % len(d.views)
+		if ports := d.views[i].ports; len(ports) > 0 {
+			d.selected = portRef{view: i, port: ports[0].Port}
+			return
+		}
+	}
+}
+
+// change runs a confirmed change and reports how it went.
+func (d *Dashboard) change(ctx context.Context, p *pending, changes chan<- string) {
+	m := d.views[p.ref.view].member
+	changeCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	_, err := m.Change(changeCtx, p.action, []int{p.ref.port}, d.Actor)
+	msg := fmt.Sprintf("%s port %d on %s: done", actionDone(p.action), p.ref.port, m.Config.Name)
+	if err != nil {
+		msg = fmt.Sprintf("Failed to %s port %d on %s: %v", p.action, p.ref.port, m.Config.Name, err)
+	}
+	select {
+	case changes <- msg:
+	case <-ctx.Done():
+		return
+	}
+	select {
+	case d.refresh[p.ref.view] <- struct{}{}:
+	default:
+	}
+}
+
+// readKeys decodes key presses from the raw terminal. It closes keys when
+// the input ends and stops once ctx is done.
+func (d *Dashboard) readKeys(ctx context.Context, r io.Reader, keys chan<- int) {
+	defer close(keys)
+	send := func(k int) bool {
+		select {
+		case keys <- k:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	buf := make([]byte, 32)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return
+		}
+		in := buf[:n]
+		for len(in) > 0 {
+			// Arrow keys arrive as ESC [ A and ESC [ B
+			if len(in) >= 3 && in[0] == keyEsc && in[1] == '[' {
+				switch {
+				case in[2] == 'A' && !send(keyUp):
+					return
+				case in[2] == 'B' && !send(keyDown):
+					return
+				}
+				in = in[3:]
+				continue
+			}
+			if !send(int(in[0])) {
+				return
+			}
+			in = in[1:]
+		}
+	}
+}
+
+func actionVerb(action string) string {
+	switch action {
+	case hooks.EventEnable:
+		return "Enable"
+	case hooks.EventDisable:
+		return "Disable"
+	}
+	return "Power cycle"
+}
+
+func actionDoing(action string) string {
+	switch action {
+	case hooks.EventEnable:
+		return "Enabling"
+	case hooks.EventDisable:
+		return "Disabling"
+	}
+	return "Power cycling"
+}
+
+func actionDone(action string) string {
+	switch action {
+	case hooks.EventEnable:
+		return "Enabled"
+	case hooks.EventDisable:
+		return "Disabled"
+	}
+	return "Power cycled"
+}
+
+func abs(f float64) float64 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
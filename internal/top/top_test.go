@@ -0,0 +1,49 @@
+package top
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadKeys(t *testing.T) {
+	d := &Dashboard{}
+	keys := make(chan int)
+	go d.readKeys(context.Background(), strings.NewReader("j\x1b[A\x1b[B\x1b[C\tq"), keys)
+	var got []int
+	for k := range keys {
+		got = append(got, k)
+	}
+	// The right arrow is not used and is dropped
+	want := []int{'j', keyUp, keyDown, keyTab, 'q'}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("keys = %v, want %v", got, want)
+	}
+}
+
+func TestReadKeysStopsWithContext(t *testing.T) {
+	d := &Dashboard{}
+	ctx, cancel := context.WithCancel(context.Background())
+	r, w := io.Pipe()
+	keys := make(chan int)
+	done := make(chan struct{})
+	go func() {
+		d.readKeys(ctx, r, keys)
+		close(done)
+	}()
+
+	// A key pressed as the dashboard exits is not waited on by anyone
+	w.Write([]byte("q"))
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("readKeys still running after its context was canceled")
+	}
+	if _, ok := <-keys; ok {
+		t.Error("keys not closed")
+	}
+}
@@ -0,0 +1,120 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Probe checks whether a powered device is responding.
+type Probe interface {
+	Check(ctx context.Context) error
+	String() string
+}
+
+// ParseProbe parses a check URL: "tcp://host:port", "icmp://host" or an
+// http(s) URL.
+func ParseProbe(check string) (Probe, error) {
+	u, err := url.Parse(check)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid check %q: want tcp://host:port, icmp://host or an http(s) URL", check)
+	}
+	switch u.Scheme {
+	case "tcp":
+		if u.Port() == "" {
+			return nil, fmt.Errorf("invalid check %q: tcp needs a port", check)
+		}
+		return TCPProbe{Address: u.Host}, nil
+	case "icmp", "ping":
+		return ICMPProbe{Host: u.Hostname()}, nil
+	case "http", "https":
+		return HTTPProbe{URL: check}, nil
+	}
+	return nil, fmt.Errorf("invalid check %q: unsupported scheme %q", check, u.Scheme)
+}
+
+// TCPProbe succeeds when a TCP connection can be opened.
+type TCPProbe struct {
+	Address string
+}
+
+func (p TCPProbe) Check(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", p.Address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func (p TCPProbe) String() string {
+	return "tcp://" + p.Address
+}
+
+// HTTPProbe succeeds when a GET returns a 2xx or 3xx status.
+type HTTPProbe struct {
+	URL string
+}
+
+// probeClient does not follow redirects; a redirect means the device is up
+var probeClient = &http.Client{
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+func (p HTTPProbe) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := probeClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("%s returned %s", p.URL, resp.Status)
+	}
+	return nil
+}
+
+func (p HTTPProbe) String() string {
+	return p.URL
+}
+
+// ICMPProbe sends one echo request with the system ping command, which
+// has the privileges raw ICMP sockets need.
+type ICMPProbe struct {
+	Host string
+}
+
+func (p ICMPProbe) Check(ctx context.Context) error {
+	count := "-c"
+	if runtime.GOOS == "windows" {
+		count = "-n"
+	}
+	out, err := exec.CommandContext(ctx, "ping", count, "1", p.Host).CombinedOutput()
+	if ctx.Err() != nil {
+		return fmt.Errorf("ping %s: %w", p.Host, ctx.Err())
+	}
+	if err != nil {
+		if line := lastLine(out); line != "" {
+			return fmt.Errorf("ping %s: %v: %s", p.Host, err, line)
+		}
+		return fmt.Errorf("ping %s: %w", p.Host, err)
+	}
+	return nil
+}
+
+func (p ICMPProbe) String() string {
+	return "icmp://" + p.Host
+}
+
+func lastLine(out []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
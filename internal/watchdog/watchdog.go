@@ -0,0 +1,257 @@
+// Package watchdog power cycles switch ports whose devices stop
+// responding, such as cameras that hang while still drawing power.
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"netgearcli/internal/config"
+	"netgearcli/internal/fleet"
+	"netgearcli/internal/hooks"
+	"netgearcli/internal/poe"
+	"netgearcli/internal/session"
+)
+
+// Target is one watched device.
+type Target struct {
+	Name             string
+	Switch           string
+	Port             int
+	Probe            Probe
+	Interval         time.Duration
+	Timeout          time.Duration
+	Failures         int
+	BootGrace        time.Duration
+	Cooldown         time.Duration
+	MaxCyclesPerHour int
+}
+
+// Targets builds the watched devices from cfg, filling unset fields from
+// the watchdog-wide settings and then the defaults.
+func Targets(cfg *config.Watchdog) ([]*Target, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	var targets []*Target
+	for i, tc := range cfg.Targets {
+		if tc.Switch == "" || tc.Port < 1 {
+			return nil, fmt.Errorf("watchdog target %d: switch and port are required", i+1)
+		}
+		probe, err := ParseProbe(tc.Check)
+		if err != nil {
+			return nil, fmt.Errorf("watchdog target %d: %w", i+1, err)
+		}
+		t := &Target{
+			Name:             tc.Name,
+			Switch:           tc.Switch,
+			Port:             tc.Port,
+			Probe:            probe,
+			Interval:         pick(tc.Interval, cfg.Interval, 30*time.Second),
+			Timeout:          pick(tc.Timeout, cfg.Timeout, 5*time.Second),
+			Failures:         pickInt(tc.Failures, cfg.Failures, 3),
+			BootGrace:        pick(tc.BootGrace, cfg.BootGrace, 2*time.Minute),
+			Cooldown:         pick(tc.Cooldown, cfg.Cooldown, 10*time.Minute),
+			MaxCyclesPerHour: pickInt(tc.MaxCyclesPerHour, cfg.MaxCyclesPerHour, 3),
+		}
+		if t.Name == "" {
+			t.Name = fmt.Sprintf("%s port %d", t.Switch, t.Port)
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// pick returns the target's setting, else the watchdog-wide one, else def
+func pick(target, shared config.Duration, def time.Duration) time.Duration {
+	switch {
+	case target > 0:
+		return time.Duration(target)
+	case shared > 0:
+		return time.Duration(shared)
+	}
+	return def
+}
+
+func pickInt(values ...int) int {
+	for _, v := range values {
+		if v > 0 {
+			return v
+		}
+	}
+	return 0
+}
+
+// Watchdog checks every target on its interval and cycles the port after
+// too many consecutive failures.
+type Watchdog struct {
+	Fleet   *fleet.Fleet
+	Targets []*Target
+	// DryRun logs the cycles that would happen without doing them.
+	DryRun bool
+	Logf   func(format string, args ...interface{})
+	// OnCycle, if set, is called after every cycle attempt.
+	OnCycle func(t *Target, reason error, result *session.PortResult, err error)
+}
+
+// Run watches every target until ctx is done.
+func (w *Watchdog) Run(ctx context.Context) error {
+	for _, t := range w.Targets {
+		if _, ok := w.Fleet.Get(t.Switch); !ok {
+			return fmt.Errorf("watchdog target %s: unknown switch %s", t.Name, t.Switch)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, t := range w.Targets {
+		wg.Add(1)
+		go func(t *Target) {
+			defer wg.Done()
+			w.watch(ctx, t)
+		}(t)
+	}
+	wg.Wait()
+	return nil
+}
+
+// watch is the check loop for one target
+func (w *Watchdog) watch(ctx context.Context, t *Target) {
+	m, _ := w.Fleet.Get(t.Switch)
+	failures := 0
+	var cycles []time.Time // recent cycles, for the hourly limit
+	var lastErr error
+	held := false // a cycle is due but rate limited; logged once
+
+	for {
+		wait := t.Interval
+		checkCtx, cancel := context.WithTimeout(ctx, t.Timeout)
+		err := t.Probe.Check(checkCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		switch {
+		case err == nil:
+			if failures > 0 {
+				w.logf("Watchdog %s: %s responding again after %d failed checks", t.Name, t.Probe, failures)
+			}
+			failures = 0
+			held = false
+		default:
+			failures++
+			lastErr = err
+			if !held {
+				w.logf("Watchdog %s: check failed (%d in a row, cycling at %d): %v", t.Name, failures, t.Failures, err)
+			}
+		}
+
+		if failures >= t.Failures {
+			now := time.Now()
+			cycles = since(cycles, now.Add(-time.Hour))
+			switch {
+			case len(cycles) > 0 && now.Sub(cycles[len(cycles)-1]) < t.Cooldown:
+				if !held {
+					w.logf("Watchdog %s: not cycling; last cycle was %s ago (cooldown %s)",
+						t.Name, now.Sub(cycles[len(cycles)-1]).Round(time.Second), t.Cooldown)
+				}
+				held = true
+			case len(cycles) >= t.MaxCyclesPerHour:
+				if !held {
+					w.logf("Watchdog %s: not cycling; already cycled %d times in the last hour", t.Name, len(cycles))
+				}
+				held = true
+			default:
+				if reason := w.cycleBlocked(ctx, m, t); reason != "" {
+					if ctx.Err() != nil {
+						return
+					}
+					if !held {
+						w.logf("Watchdog %s: not cycling; %s", t.Name, reason)
+					}
+					held = true
+					break
+				}
+				w.cycle(ctx, m, t, lastErr)
+				cycles = append(cycles, now)
+				failures = 0
+				held = false
+				wait = t.BootGrace
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// cycleBlocked returns why the target's port must not be cycled, or "". A
+// port an operator disabled is left alone, since cycling would turn it back
+// on, and so is one whose settings cannot be read.
+func (w *Watchdog) cycleBlocked(ctx context.Context, m *fleet.Member, t *Target) string {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	var settings []poe.PortSettings
+	err := m.Locked(ctx, func(ctx context.Context) error {
+		var err error
+		settings, err = m.Session.Settings(ctx)
+		return err
+	})
+	if err != nil {
+		return fmt.Sprintf("could not read the settings of %s: %v", t.Switch, err)
+	}
+	for _, s := range settings {
+		if s.Port == t.Port {
+			if !s.Enabled() {
+				return fmt.Sprintf("%s port %d is disabled", t.Switch, t.Port)
+			}
+			return ""
+		}
+	}
+	return fmt.Sprintf("%s has no port %d", t.Switch, t.Port)
+}
+
+// cycle power cycles the target's port
+func (w *Watchdog) cycle(ctx context.Context, m *fleet.Member, t *Target, reason error) {
+	if w.DryRun {
+		w.logf("Watchdog %s: would cycle %s port %d (dry run)", t.Name, t.Switch, t.Port)
+		return
+	}
+	w.logf("Watchdog %s: cycling %s port %d after %d failed checks", t.Name, t.Switch, t.Port, t.Failures)
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	actor := hooks.CurrentActor("watchdog")
+	actor.Reason = fmt.Sprintf("%s: %d failed checks of %s: %v", t.Name, t.Failures, t.Probe, reason)
+	result, err := m.Change(ctx, hooks.EventCycle, []int{t.Port}, actor)
+	if err != nil {
+		w.logf("Watchdog %s: cycling %s port %d failed: %v", t.Name, t.Switch, t.Port, err)
+	} else {
+		w.logf("Watchdog %s: cycled %s port %d", t.Name, t.Switch, t.Port)
+	}
+	if w.OnCycle != nil {
+		w.OnCycle(t, reason, result, err)
+	}
+}
+
+// since drops times before cutoff
+func since(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+func (w *Watchdog) logf(format string, args ...interface{}) {
+	if w.Logf != nil {
+		w.Logf(format, args...)
+	}
+}
@@ -51,7 +51,17 @@ echo "Ports: 1 2 3 4 5 6 7 8"
 echo ""
 
 # Execute the poe-management command
-"$POE_MANAGEMENT" "$SWITCH_NAME" "$POE_ACTION" 1 2 3 4 5 6 7 8
+STATUS=0
+"$POE_MANAGEMENT" "$SWITCH_NAME" "$POE_ACTION" 1 2 3 4 5 6 7 8 || STATUS=$?
+
+# Exit codes are documented in README.md
+case "$STATUS" in
+    0) ;;
+    3) echo "Error: authentication to $SWITCH_NAME failed"; exit $STATUS ;;
+    4) echo "Error: $SWITCH_NAME is unreachable"; exit $STATUS ;;
+    5) echo "Error: only some ports on $SWITCH_NAME were changed"; exit $STATUS ;;
+    *) echo "Error: poe-management exited with status $STATUS"; exit $STATUS ;;
+esac
 
 echo ""
 echo "POE control completed for switch $SWITCH_NAME"
\ No newline at end of file